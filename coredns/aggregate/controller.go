@@ -0,0 +1,190 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/log"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// ServiceAggregatesGVR identifies the ServiceAggregate resource. A ServiceAggregate declares a logical clusterset
+// service, named by the ServiceAggregate's name and namespace, that's backed by the union of the exported services
+// listed in its spec.services field. Each entry specifies the service's name and, optionally, its namespace which
+// defaults to the ServiceAggregate's namespace, eg:
+//
+//	apiVersion: lighthouse.submariner.io/v1alpha1
+//	kind: ServiceAggregate
+//	metadata:
+//	  name: db
+//	  namespace: shared
+//	spec:
+//	  services:
+//	  - name: db-east
+//	    namespace: team-a
+//	  - name: db-west
+//	    namespace: team-b
+var ServiceAggregatesGVR = schema.GroupVersionResource{
+	Group:    "lighthouse.submariner.io",
+	Version:  "v1alpha1",
+	Resource: "serviceaggregates",
+}
+
+type NewClientsetFunc func(c *rest.Config) (dynamic.Interface, error)
+
+// NewClientset is an indirection hook for unit tests to supply fake client sets.
+var NewClientset NewClientsetFunc
+
+// The Controller watches ServiceAggregates to resolve an aggregate service name to the services it aggregates.
+type Controller struct {
+	// Indirection hook for unit tests to supply fake client sets.
+	NewClientset NewClientsetFunc
+	informer     cache.Controller
+	store        cache.Store
+	stopCh       chan struct{}
+}
+
+func NewController() *Controller {
+	return &Controller{
+		NewClientset: getNewClientsetFunc(),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func getNewClientsetFunc() NewClientsetFunc {
+	if NewClientset != nil {
+		return NewClientset
+	}
+
+	return dynamic.NewForConfig
+}
+
+func (c *Controller) Start(kubeConfig *rest.Config) error {
+	client, err := c.getCheckedClient(kubeConfig)
+	if apierrors.IsNotFound(err) {
+		klog.Warningf("ServiceAggregate resource not found, service aggregates won't be served")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("Starting ServiceAggregate Controller")
+
+	// nolint:wrapcheck // Let the caller wrap these errors.
+	c.store, c.informer = cache.NewInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.Watch(context.TODO(), options)
+		},
+	}, &unstructured.Unstructured{}, 0, cache.ResourceEventHandlerFuncs{})
+
+	go c.informer.Run(c.stopCh)
+
+	if ok := cache.WaitForCacheSync(c.stopCh, c.informer.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for informer cache to sync")
+	}
+
+	return nil
+}
+
+func (c *Controller) Stop() {
+	close(c.stopCh)
+
+	klog.Infof("ServiceAggregate Controller stopped")
+}
+
+func (c *Controller) getCheckedClient(kubeConfig *rest.Config) (dynamic.ResourceInterface, error) {
+	clientSet, err := c.NewClientset(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating client set")
+	}
+
+	client := clientSet.Resource(ServiceAggregatesGVR).Namespace(v1.NamespaceAll)
+	_, err = client.List(context.TODO(), metav1.ListOptions{})
+
+	return client, errors.Wrap(err, "error listing resources")
+}
+
+// GetServices returns the services aggregated by the ServiceAggregate with the given name and namespace, if one exists.
+func (c *Controller) GetServices(name, namespace string) ([]types.NamespacedName, bool) {
+	if c.store == nil {
+		return nil, false
+	}
+
+	key := namespace + "/" + name
+
+	obj, exists, err := c.store.GetByKey(key)
+	if err != nil {
+		klog.V(log.DEBUG).Infof("Error trying to get ServiceAggregate for key %q", key)
+		return nil, false
+	}
+
+	if !exists {
+		return nil, false
+	}
+
+	entries, _, err := unstructured.NestedSlice(obj.(*unstructured.Unstructured).Object, "spec", "services")
+	if err != nil {
+		klog.Errorf("Error retrieving the services from ServiceAggregate %q: %v", key, err)
+		return nil, false
+	}
+
+	services := make([]types.NamespacedName, 0, len(entries))
+
+	for _, entry := range entries {
+		entryMap, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		service := types.NamespacedName{Namespace: namespace}
+
+		service.Name, _, _ = unstructured.NestedString(entryMap, "name")
+		if service.Name == "" {
+			klog.Errorf("Service name missing from entry %#v in ServiceAggregate %q", entryMap, key)
+			continue
+		}
+
+		if ns, _, _ := unstructured.NestedString(entryMap, "namespace"); ns != "" {
+			service.Namespace = ns
+		}
+
+		services = append(services, service)
+	}
+
+	return services, true
+}
@@ -0,0 +1,140 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregate_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/fake"
+	"github.com/submariner-io/lighthouse/coredns/aggregate"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	fakeClient "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+)
+
+const (
+	aggregateName      = "db"
+	aggregateNamespace = "shared"
+)
+
+var _ = Describe("ServiceAggregate controller", func() {
+	var (
+		controller *aggregate.Controller
+		dynClient  *fakeClient.FakeDynamicClient
+		client     dynamic.ResourceInterface
+		reactor    *fake.FailingReactor
+	)
+
+	BeforeEach(func() {
+		dynClient = fakeClient.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			aggregate.ServiceAggregatesGVR: "ServiceAggregateList",
+		})
+
+		client = dynClient.Resource(aggregate.ServiceAggregatesGVR).Namespace(aggregateNamespace)
+		reactor = fake.NewFailingReactorForResource(&dynClient.Fake, "serviceaggregates")
+	})
+
+	JustBeforeEach(func() {
+		controller = aggregate.NewController()
+		controller.NewClientset = func(c *rest.Config) (dynamic.Interface, error) {
+			return dynClient, nil
+		}
+
+		Expect(controller.Start(&rest.Config{})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		controller.Stop()
+	})
+
+	getServices := func() []types.NamespacedName {
+		services, found := controller.GetServices(aggregateName, aggregateNamespace)
+		if !found {
+			return nil
+		}
+
+		return services
+	}
+
+	When("a ServiceAggregate is created", func() {
+		JustBeforeEach(func() {
+			_, err := client.Create(context.TODO(), newServiceAggregate(
+				map[string]interface{}{"name": "db-east", "namespace": "team-a"},
+				map[string]interface{}{"name": "db-local"},
+				map[string]interface{}{"namespace": "team-c"},
+			), metav1.CreateOptions{})
+			Expect(err).To(Succeed())
+		})
+
+		It("should return the aggregated services", func() {
+			Eventually(getServices, 5).Should(Equal([]types.NamespacedName{
+				{Namespace: "team-a", Name: "db-east"},
+				{Namespace: aggregateNamespace, Name: "db-local"},
+			}))
+		})
+	})
+
+	When("no ServiceAggregate exists", func() {
+		It("should return not found", func() {
+			_, found := controller.GetServices(aggregateName, aggregateNamespace)
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	When("the ServiceAggregate resource doesn't exist", func() {
+		BeforeEach(func() {
+			reactor.SetFailOnList(errors.NewNotFound(schema.GroupResource{}, ""))
+		})
+
+		It("should return not found", func() {
+			_, found := controller.GetServices(aggregateName, aggregateNamespace)
+			Expect(found).To(BeFalse())
+		})
+	})
+})
+
+func newServiceAggregate(services ...interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(aggregate.ServiceAggregatesGVR.GroupVersion().String())
+	obj.SetKind("ServiceAggregate")
+	obj.SetName(aggregateName)
+	obj.SetNamespace(aggregateNamespace)
+	Expect(unstructured.SetNestedSlice(obj.Object, services, "spec", "services")).To(Succeed())
+
+	return obj
+}
+
+func init() {
+	klog.InitFlags(nil)
+}
+
+func TestAggregate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ServiceAggregate Suite")
+}
@@ -20,6 +20,7 @@ package endpointslice
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/pkg/errors"
 	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
@@ -125,6 +126,10 @@ func (c *Controller) Start(kubeConfig *rest.Config) error {
 
 	go c.epsInformer.Run(c.stopCh)
 
+	if ok := cache.WaitForCacheSync(c.stopCh, c.epsInformer.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for informer cache to sync")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,155 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpointslice
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("EndpointSlice Map drain window", func() {
+	const (
+		service1   = "service1"
+		namespace1 = "namespace1"
+		clusterID1 = "clusterID1"
+		readyIP    = "100.96.157.101"
+		drainingIP = "100.96.157.102"
+		window     = 10 * time.Second
+	)
+
+	var (
+		epMap      *Map
+		start      time.Time
+		current    time.Time
+		randResult float64
+	)
+
+	BeforeEach(func() {
+		start = time.Now()
+		current = start
+		randResult = 0.5
+
+		now = func() time.Time {
+			return current
+		}
+
+		randFloat64 = func() float64 {
+			return randResult
+		}
+
+		epMap = NewMap()
+		epMap.SetDrainWindow(window)
+		epMap.Put(newTerminatingEndpointSlice(namespace1, service1, clusterID1, readyIP, drainingIP))
+	})
+
+	AfterEach(func() {
+		now = time.Now
+		randFloat64 = rand.Float64
+	})
+
+	getIPs := func() []string {
+		records, found := epMap.GetDNSRecords("", "", namespace1, service1, nil)
+		Expect(found).To(BeTrue())
+
+		ips := []string{}
+		for i := range records {
+			ips = append(ips, records[i].IP)
+		}
+
+		sort.Strings(ips)
+
+		return ips
+	}
+
+	It("should ramp the terminating endpoint's weight down to zero over the window", func() {
+		Expect(epMap.drainWeight(start, start)).To(Equal(1.0))
+		Expect(epMap.drainWeight(start, start.Add(window/4))).To(BeNumerically("~", 0.75))
+		Expect(epMap.drainWeight(start, start.Add(window/2))).To(BeNumerically("~", 0.5))
+		Expect(epMap.drainWeight(start, start.Add(window*3/4))).To(BeNumerically("~", 0.25))
+		Expect(epMap.drainWeight(start, start.Add(window))).To(Equal(0.0))
+		Expect(epMap.drainWeight(start, start.Add(2*window))).To(Equal(0.0))
+	})
+
+	It("should include the terminating endpoint with decreasing likelihood until the window expires", func() {
+		Expect(getIPs()).To(Equal([]string{readyIP, drainingIP}))
+
+		current = start.Add(window * 4 / 10)
+		Expect(getIPs()).To(Equal([]string{readyIP, drainingIP}))
+
+		current = start.Add(window * 6 / 10)
+		Expect(getIPs()).To(Equal([]string{readyIP}))
+
+		randResult = 0
+		current = start.Add(window)
+		Expect(getIPs()).To(Equal([]string{readyIP}))
+	})
+
+	When("the EndpointSlice is updated while an endpoint is terminating", func() {
+		It("should retain the time the endpoint started terminating", func() {
+			current = start.Add(window * 6 / 10)
+			epMap.Put(newTerminatingEndpointSlice(namespace1, service1, clusterID1, readyIP, drainingIP))
+			Expect(getIPs()).To(Equal([]string{readyIP}))
+		})
+	})
+
+	When("no drain window is configured", func() {
+		BeforeEach(func() {
+			epMap.SetDrainWindow(0)
+		})
+
+		It("should always include the terminating endpoint", func() {
+			current = start.Add(2 * window)
+			Expect(getIPs()).To(Equal([]string{readyIP, drainingIP}))
+		})
+	})
+})
+
+func newTerminatingEndpointSlice(namespace, name, clusterID, readyIP, terminatingIP string) *discovery.EndpointSlice {
+	terminating := true
+
+	return &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelManagedBy:          lhconstants.LabelValueManagedBy,
+				lhconstants.LabelSourceNamespace:  namespace,
+				lhconstants.MCSLabelSourceCluster: clusterID,
+				lhconstants.MCSLabelServiceName:   name,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Endpoints: []discovery.Endpoint{
+			{
+				Addresses: []string{readyIP},
+			},
+			{
+				Addresses:  []string{terminatingIP},
+				Conditions: discovery.EndpointConditions{Terminating: &terminating},
+			},
+		},
+	}
+}
@@ -19,7 +19,11 @@ limitations under the License.
 package endpointslice
 
 import (
+	"encoding/json"
+	"math/rand"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/submariner-io/admiral/pkg/log"
 	"github.com/submariner-io/lighthouse/coredns/serviceimport"
@@ -32,18 +36,43 @@ import (
 type endpointInfo struct {
 	key         string
 	clusterInfo map[string]*clusterInfo
+	// sliceInfo maps each cluster to the clusterInfo of each of its EndpointSlices, keyed by name, which are merged
+	// into the cluster's clusterInfo as a service's endpoints may be split across multiple EndpointSlices.
+	sliceInfo map[string]map[string]*clusterInfo
 }
 
 type clusterInfo struct {
 	hostRecords map[string][]serviceimport.DNSRecord
 	recordList  []serviceimport.DNSRecord
+	// terminating maps the IPs of terminating endpoints to the time they were first observed as terminating.
+	terminating map[string]time.Time
+	// readiness maps endpoint IPs to their readiness state, used to apply readiness hysteresis.
+	readiness map[string]readinessState
+}
+
+// readinessState tracks an endpoint's readiness as last observed in its EndpointSlice, when that observation was
+// first made and the readiness in effect prior to it.
+type readinessState struct {
+	ready    bool
+	observed bool
+	since    time.Time
 }
 
 type Map struct {
-	epMap map[string]*endpointInfo
-	mutex sync.RWMutex
+	epMap       map[string]*endpointInfo
+	mutex       sync.RWMutex
+	drainWindow time.Duration
+	minReady    time.Duration
+	minNotReady time.Duration
+	labelPrefix string
 }
 
+// Hooks for unit tests.
+var (
+	now         = time.Now
+	randFloat64 = rand.Float64 // nolint:gosec // A cryptographically secure generator isn't needed for load spreading.
+)
+
 func (m *Map) GetDNSRecords(hostname, cluster, namespace, name string, checkCluster func(string) bool) ([]serviceimport.DNSRecord, bool) {
 	key := keyFunc(name, namespace)
 
@@ -69,7 +98,7 @@ func (m *Map) GetDNSRecords(hostname, cluster, namespace, name string, checkClus
 
 		for clusterID, info := range clusterInfos {
 			if checkCluster == nil || checkCluster(clusterID) {
-				records = append(records, info.recordList...)
+				records = append(records, m.activeRecords(info)...)
 			}
 		}
 
@@ -77,7 +106,7 @@ func (m *Map) GetDNSRecords(hostname, cluster, namespace, name string, checkClus
 	case clusterInfos[cluster] == nil:
 		return nil, false
 	case hostname == "":
-		return clusterInfos[cluster].recordList, true
+		return m.activeRecords(clusterInfos[cluster]), true
 	case clusterInfos[cluster].hostRecords == nil:
 		return nil, false
 	default:
@@ -86,14 +115,153 @@ func (m *Map) GetDNSRecords(hostname, cluster, namespace, name string, checkClus
 	}
 }
 
+// SetDrainWindow configures the window over which terminating endpoints are gradually removed from answers. A
+// terminating endpoint's weight ramps down linearly from 1 to 0 over the window, starting when it's first observed as
+// terminating, and is included in an answer with a probability equal to its weight. If zero, the default, terminating
+// endpoints are treated like any other. This must be called before the Map is used.
+func (m *Map) SetDrainWindow(window time.Duration) {
+	m.drainWindow = window
+}
+
+func (m *Map) DrainWindow() time.Duration {
+	return m.drainWindow
+}
+
+// SetLabelPrefix sets the prefix of the keys of the Lighthouse labels and annotations read from the EndpointSlices,
+// which must be the agents' LabelPrefix, or constants.DefaultLabelPrefix if empty. It must be set before the map is
+// populated.
+func (m *Map) SetLabelPrefix(prefix string) {
+	m.labelPrefix = prefix
+}
+
+func (m *Map) LabelPrefix() string {
+	return m.labelPrefix
+}
+
+// labelKey returns the given Lighthouse label or annotation key under the map's label prefix.
+func (m *Map) labelKey(key string) string {
+	return constants.WithLabelPrefix(m.labelPrefix, key)
+}
+
+// SetReadinessHysteresis configures hysteresis for endpoint readiness to dampen flapping. If enabled, endpoints that
+// aren't ready are excluded from answers, however an endpoint transitioning to ready must remain continuously ready for
+// minReady before it's included and one transitioning to not ready must remain continuously not ready for minNotReady
+// before it's excluded. Transition times are taken from when a readiness change is first observed in the endpoint's
+// EndpointSlice. If both durations are zero, the default, endpoint readiness doesn't affect answers. This must be
+// called before the Map is used.
+func (m *Map) SetReadinessHysteresis(minReady, minNotReady time.Duration) {
+	m.minReady = minReady
+	m.minNotReady = minNotReady
+}
+
+func (m *Map) ReadinessHysteresis() (minReady, minNotReady time.Duration) {
+	return m.minReady, m.minNotReady
+}
+
+func (m *Map) readinessHysteresisEnabled() bool {
+	return m.minReady > 0 || m.minNotReady > 0
+}
+
+func (m *Map) activeRecords(info *clusterInfo) []serviceimport.DNSRecord {
+	return m.drainRecords(info, m.readyRecords(info))
+}
+
+func (m *Map) readyRecords(info *clusterInfo) []serviceimport.DNSRecord {
+	if !m.readinessHysteresisEnabled() {
+		return info.recordList
+	}
+
+	t := now()
+	records := make([]serviceimport.DNSRecord, 0, len(info.recordList))
+
+	for i := range info.recordList {
+		if state, ok := info.readiness[info.recordList[i].IP]; !ok || m.effectiveReadiness(state, t) {
+			records = append(records, info.recordList[i])
+		}
+	}
+
+	return records
+}
+
+// effectiveReadiness returns the readiness in effect at the given time for an endpoint in the given state, ie the
+// observed readiness once it has held for the applicable minimum duration, otherwise the prior readiness.
+func (m *Map) effectiveReadiness(state readinessState, t time.Time) bool {
+	if state.observed == state.ready {
+		return state.ready
+	}
+
+	minDuration := m.minNotReady
+	if state.observed {
+		minDuration = m.minReady
+	}
+
+	if t.Sub(state.since) >= minDuration {
+		return state.observed
+	}
+
+	return state.ready
+}
+
+func (m *Map) drainRecords(info *clusterInfo, recordList []serviceimport.DNSRecord) []serviceimport.DNSRecord {
+	if m.drainWindow == 0 || len(info.terminating) == 0 {
+		return recordList
+	}
+
+	t := now()
+	records := make([]serviceimport.DNSRecord, 0, len(recordList))
+
+	for i := range recordList {
+		since, ok := info.terminating[recordList[i].IP]
+		if !ok || randFloat64() < m.drainWeight(since, t) {
+			records = append(records, recordList[i])
+		}
+	}
+
+	return records
+}
+
+// drainWeight returns the weight, in the range [0, 1], of an endpoint that started terminating at the given time.
+func (m *Map) drainWeight(since, t time.Time) float64 {
+	elapsed := t.Sub(since)
+	if elapsed >= m.drainWindow {
+		return 0
+	}
+
+	if elapsed < 0 {
+		return 1
+	}
+
+	return 1 - float64(elapsed)/float64(m.drainWindow)
+}
+
 func NewMap() *Map {
 	return &Map{
 		epMap: make(map[string]*endpointInfo),
 	}
 }
 
+// getEndpointMetadata returns the per-endpoint metadata, keyed by address, published in the given EndpointSlice's
+// EndpointMetadataAnnotation.
+func (m *Map) getEndpointMetadata(es *discovery.EndpointSlice) map[string]map[string]string {
+	annotation := m.labelKey(constants.EndpointMetadataAnnotation)
+
+	value, ok := es.Annotations[annotation]
+	if !ok {
+		return nil
+	}
+
+	metadata := map[string]map[string]string{}
+
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		klog.Errorf("Error parsing the %q annotation from EndpointSlice %q: %v", annotation, es.Name, err)
+		return nil
+	}
+
+	return metadata
+}
+
 func (m *Map) Put(es *discovery.EndpointSlice) {
-	key, ok := getKey(es)
+	key, ok := m.getKey(es)
 	if !ok {
 		klog.Warningf("Failed to get key labels from %#v", es.ObjectMeta)
 		return
@@ -103,7 +271,7 @@ func (m *Map) Put(es *discovery.EndpointSlice) {
 
 	// Remove this after 0.12 (this handles old map entries with pre-MCS labels)
 	if !ok {
-		cluster, ok = es.Labels[constants.LighthouseLabelSourceCluster]
+		cluster, ok = es.Labels[m.labelKey(constants.LighthouseLabelSourceCluster)]
 	}
 
 	if !ok {
@@ -119,12 +287,17 @@ func (m *Map) Put(es *discovery.EndpointSlice) {
 		epInfo = &endpointInfo{
 			key:         key,
 			clusterInfo: make(map[string]*clusterInfo),
+			sliceInfo:   make(map[string]map[string]*clusterInfo),
 		}
 	}
 
-	epInfo.clusterInfo[cluster] = &clusterInfo{
+	prevInfo := epInfo.clusterInfo[cluster]
+
+	info := &clusterInfo{
 		recordList:  make([]serviceimport.DNSRecord, 0),
 		hostRecords: make(map[string][]serviceimport.DNSRecord),
+		terminating: make(map[string]time.Time),
+		readiness:   make(map[string]readinessState),
 	}
 
 	mcsPorts := make([]mcsv1a1.ServicePort, len(es.Ports))
@@ -139,6 +312,8 @@ func (m *Map) Put(es *discovery.EndpointSlice) {
 		mcsPorts[i] = mcsPort
 	}
 
+	metadata := m.getEndpointMetadata(es)
+
 	for _, endpoint := range es.Endpoints {
 		var records []serviceimport.DNSRecord
 
@@ -153,29 +328,134 @@ func (m *Map) Put(es *discovery.EndpointSlice) {
 				record.HostName = *endpoint.Hostname
 			}
 
+			if endpoint.NodeName != nil {
+				record.NodeName = *endpoint.NodeName
+			}
+
+			record.Metadata = metadata[address]
+
 			records = append(records, record)
+
+			if endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating {
+				info.terminating[address] = prevInfo.terminatingSince(address)
+			}
+
+			if m.readinessHysteresisEnabled() {
+				info.readiness[address] = m.nextReadinessState(prevInfo, address,
+					endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready)
+			}
 		}
 
 		if endpoint.Hostname != nil {
-			epInfo.clusterInfo[cluster].hostRecords[*endpoint.Hostname] = records
+			info.hostRecords[*endpoint.Hostname] = records
 		}
 
-		epInfo.clusterInfo[cluster].recordList = append(epInfo.clusterInfo[cluster].recordList, records...)
+		info.recordList = append(info.recordList, records...)
 	}
 
-	klog.V(log.DEBUG).Infof("Adding clusterInfo %#v for EndpointSlice %q in %q", epInfo.clusterInfo[cluster], es.Name, cluster)
+	klog.V(log.DEBUG).Infof("Adding clusterInfo %#v for EndpointSlice %q in %q", info, es.Name, cluster)
+
+	if epInfo.sliceInfo[cluster] == nil {
+		epInfo.sliceInfo[cluster] = make(map[string]*clusterInfo)
+	}
+
+	epInfo.sliceInfo[cluster][es.Name] = info
+	epInfo.clusterInfo[cluster] = mergeClusterInfos(epInfo.sliceInfo[cluster])
 
 	m.epMap[key] = epInfo
 }
 
+// mergeClusterInfos merges the given clusterInfos, keyed by EndpointSlice name, in name order so the records are
+// consistently ordered.
+func mergeClusterInfos(sliceInfos map[string]*clusterInfo) *clusterInfo {
+	if len(sliceInfos) == 1 {
+		for _, info := range sliceInfos {
+			return info
+		}
+	}
+
+	names := make([]string, 0, len(sliceInfos))
+	for name := range sliceInfos {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	merged := &clusterInfo{
+		recordList:  make([]serviceimport.DNSRecord, 0),
+		hostRecords: make(map[string][]serviceimport.DNSRecord),
+		terminating: make(map[string]time.Time),
+		readiness:   make(map[string]readinessState),
+	}
+
+	for _, name := range names {
+		info := sliceInfos[name]
+
+		merged.recordList = append(merged.recordList, info.recordList...)
+
+		for hostname, records := range info.hostRecords {
+			merged.hostRecords[hostname] = append(merged.hostRecords[hostname], records...)
+		}
+
+		for ip, since := range info.terminating {
+			merged.terminating[ip] = since
+		}
+
+		for ip, state := range info.readiness {
+			merged.readiness[ip] = state
+		}
+	}
+
+	return merged
+}
+
+// terminatingSince returns the time the given endpoint IP was first observed as terminating or the current time if
+// it wasn't previously terminating.
+func (c *clusterInfo) terminatingSince(ip string) time.Time {
+	if c != nil {
+		if since, ok := c.terminating[ip]; ok {
+			return since
+		}
+	}
+
+	return now()
+}
+
+// nextReadinessState returns the readiness state for the given endpoint IP that results from observing the given
+// readiness. An endpoint that wasn't previously known is considered to have been in the observed state already.
+func (m *Map) nextReadinessState(prevInfo *clusterInfo, ip string, observed bool) readinessState {
+	t := now()
+
+	var (
+		prev readinessState
+		ok   bool
+	)
+
+	if prevInfo != nil {
+		prev, ok = prevInfo.readiness[ip]
+	}
+
+	if !ok {
+		return readinessState{ready: observed, observed: observed, since: t}
+	}
+
+	ready := m.effectiveReadiness(prev, t)
+
+	if observed == prev.observed {
+		return readinessState{ready: ready, observed: observed, since: prev.since}
+	}
+
+	return readinessState{ready: ready, observed: observed, since: t}
+}
+
 func (m *Map) Remove(es *discovery.EndpointSlice) {
-	key, ok := getKey(es)
+	key, ok := m.getKey(es)
 	if ok {
 		cluster, ok := es.Labels[constants.MCSLabelSourceCluster]
 
 		// Remove this after 0.12 (this handles old map entries with pre-MCS labels)
 		if !ok {
-			cluster, ok = es.Labels[constants.LighthouseLabelSourceCluster]
+			cluster, ok = es.Labels[m.labelKey(constants.LighthouseLabelSourceCluster)]
 		}
 
 		if !ok {
@@ -190,8 +470,16 @@ func (m *Map) Remove(es *discovery.EndpointSlice) {
 			return
 		}
 
-		klog.V(log.DEBUG).Infof("Adding endpointInfo %#v for %s in %s", epInfo.clusterInfo[cluster], es.Name, cluster)
-		delete(epInfo.clusterInfo, cluster)
+		klog.V(log.DEBUG).Infof("Removing EndpointSlice %s in %s from endpointInfo %#v", es.Name, cluster, epInfo.clusterInfo[cluster])
+
+		delete(epInfo.sliceInfo[cluster], es.Name)
+
+		if len(epInfo.sliceInfo[cluster]) == 0 {
+			delete(epInfo.sliceInfo, cluster)
+			delete(epInfo.clusterInfo, cluster)
+		} else {
+			epInfo.clusterInfo[cluster] = mergeClusterInfos(epInfo.sliceInfo[cluster])
+		}
 	}
 }
 
@@ -203,18 +491,18 @@ func (m *Map) get(key string) *endpointInfo {
 	return endpointInfo
 }
 
-func getKey(es *discovery.EndpointSlice) (string, bool) {
+func (m *Map) getKey(es *discovery.EndpointSlice) (string, bool) {
 	name, ok := es.Labels[constants.MCSLabelServiceName]
 
 	if !ok {
-		name, ok = es.Labels[constants.LighthouseLabelSourceName]
+		name, ok = es.Labels[m.labelKey(constants.LighthouseLabelSourceName)]
 	}
 
 	if !ok {
 		return "", false
 	}
 
-	namespace, ok := es.Labels[constants.LabelSourceNamespace]
+	namespace, ok := es.Labels[m.labelKey(constants.LabelSourceNamespace)]
 
 	if !ok {
 		return "", false
@@ -110,6 +110,71 @@ var _ = Describe("EndpointSlice Map", func() {
 		})
 	})
 
+	When("an EndpointSlice publishes endpoint metadata", func() {
+		It("should return the metadata with each endpoint's record", func() {
+			es := newEndpointSlice(namespace1, service1, clusterID1, []string{endpointIP, endpointIP2})
+			es.Annotations = map[string]string{
+				lhconstants.EndpointMetadataAnnotation: `{"` + endpointIP + `":{"zone":"zone-a","version":"v2"}}`,
+			}
+			endpointSliceMap.Put(es)
+
+			metadata := map[string]map[string]string{}
+			for _, record := range getRecords("", "", namespace1, service1) {
+				metadata[record.IP] = record.Metadata
+			}
+
+			Expect(metadata).To(Equal(map[string]map[string]string{
+				endpointIP:  {"zone": "zone-a", "version": "v2"},
+				endpointIP2: nil,
+			}))
+		})
+	})
+
+	When("the EndpointSlices are labeled under a custom label prefix", func() {
+		const prefix = "lighthouse.example.io/"
+
+		It("should read the service's namespace and endpoint metadata from the prefixed keys", func() {
+			endpointSliceMap.SetLabelPrefix(prefix)
+
+			es := newEndpointSlice(namespace1, service1, clusterID1, []string{endpointIP})
+			delete(es.Labels, lhconstants.LabelSourceNamespace)
+			es.Labels[lhconstants.WithLabelPrefix(prefix, lhconstants.LabelSourceNamespace)] = namespace1
+			es.Annotations = map[string]string{
+				lhconstants.WithLabelPrefix(prefix, lhconstants.EndpointMetadataAnnotation): `{"` + endpointIP + `":{"zone":"zone-a"}}`,
+			}
+			endpointSliceMap.Put(es)
+
+			records := getRecords("", clusterID1, namespace1, service1)
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].IP).To(Equal(endpointIP))
+			Expect(records[0].Metadata).To(Equal(map[string]string{"zone": "zone-a"}))
+
+			endpointSliceMap.Remove(es)
+
+			_, found := endpointSliceMap.GetDNSRecords("", clusterID1, namespace1, service1, checkCluster)
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	When("a headless service's endpoints in a cluster are split across multiple EndpointSlices", func() {
+		It("should return the IPs from all the EndpointSlices", func() {
+			es1 := newEndpointSlice(namespace1, service1, clusterID1, []string{endpointIP})
+			endpointSliceMap.Put(es1)
+			es2 := newEndpointSlice(namespace1, service1, clusterID1, []string{endpointIP2})
+			es2.Name = service1 + ".1"
+			endpointSliceMap.Put(es2)
+			es3 := newEndpointSlice(namespace1, service1, clusterID2, []string{endpointIP3})
+			endpointSliceMap.Put(es3)
+
+			expectIPs("", clusterID1, []string{endpointIP, endpointIP2})
+			expectIPs("", "", []string{endpointIP, endpointIP2, endpointIP3})
+
+			endpointSliceMap.Remove(es2)
+
+			expectIPs("", clusterID1, []string{endpointIP})
+		})
+	})
+
 	When("a headless service is present in multiple connected clusters with one disconnected", func() {
 		It("should consistently return all the IPs from the connected clusters", func() {
 			es1 := newEndpointSlice(namespace1, service1, clusterID1, []string{endpointIP})
@@ -0,0 +1,186 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpointslice
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("EndpointSlice Map readiness hysteresis", func() {
+	const (
+		service1    = "service1"
+		namespace1  = "namespace1"
+		clusterID1  = "clusterID1"
+		stableIP    = "100.96.157.101"
+		flappingIP  = "100.96.157.102"
+		minReady    = 10 * time.Second
+		minNotReady = 20 * time.Second
+	)
+
+	var (
+		epMap   *Map
+		start   time.Time
+		current time.Time
+	)
+
+	put := func(flappingReady bool) {
+		epMap.Put(newReadinessEndpointSlice(namespace1, service1, clusterID1, stableIP, flappingIP, flappingReady))
+	}
+
+	at := func(d time.Duration) {
+		current = start.Add(d)
+	}
+
+	getIPs := func() []string {
+		records, found := epMap.GetDNSRecords("", "", namespace1, service1, nil)
+		Expect(found).To(BeTrue())
+
+		ips := []string{}
+		for i := range records {
+			ips = append(ips, records[i].IP)
+		}
+
+		sort.Strings(ips)
+
+		return ips
+	}
+
+	BeforeEach(func() {
+		start = time.Now()
+		current = start
+
+		now = func() time.Time {
+			return current
+		}
+
+		epMap = NewMap()
+		epMap.SetReadinessHysteresis(minReady, minNotReady)
+	})
+
+	AfterEach(func() {
+		now = time.Now
+	})
+
+	When("an endpoint is initially ready", func() {
+		BeforeEach(func() {
+			put(true)
+		})
+
+		It("should include it immediately", func() {
+			Expect(getIPs()).To(Equal([]string{stableIP, flappingIP}))
+		})
+
+		It("should exclude it only after it's continuously not ready for the minimum duration", func() {
+			at(time.Second)
+			put(false)
+			Expect(getIPs()).To(Equal([]string{stableIP, flappingIP}))
+
+			at(time.Second + minNotReady - time.Millisecond)
+			Expect(getIPs()).To(Equal([]string{stableIP, flappingIP}))
+
+			at(time.Second + minNotReady)
+			Expect(getIPs()).To(Equal([]string{stableIP}))
+		})
+
+		It("should dampen flapping", func() {
+			for i := 0; i < 10; i++ {
+				at(time.Duration(i) * 5 * time.Second)
+				put(i%2 == 1)
+				Expect(getIPs()).To(Equal([]string{stableIP, flappingIP}))
+
+				at(time.Duration(i)*5*time.Second + 4*time.Second)
+				Expect(getIPs()).To(Equal([]string{stableIP, flappingIP}))
+			}
+		})
+	})
+
+	When("an endpoint is initially not ready", func() {
+		BeforeEach(func() {
+			put(false)
+		})
+
+		It("should exclude it immediately", func() {
+			Expect(getIPs()).To(Equal([]string{stableIP}))
+		})
+
+		It("should include it only after it's continuously ready for the minimum duration", func() {
+			at(time.Second)
+			put(true)
+			Expect(getIPs()).To(Equal([]string{stableIP}))
+
+			at(time.Second + minReady)
+			put(true)
+			Expect(getIPs()).To(Equal([]string{stableIP, flappingIP}))
+		})
+
+		It("should dampen flapping", func() {
+			for i := 0; i < 10; i++ {
+				at(time.Duration(i) * 5 * time.Second)
+				put(i%2 == 0)
+				Expect(getIPs()).To(Equal([]string{stableIP}))
+			}
+		})
+	})
+
+	When("readiness hysteresis isn't configured", func() {
+		BeforeEach(func() {
+			epMap.SetReadinessHysteresis(0, 0)
+			put(false)
+		})
+
+		It("should include endpoints that aren't ready", func() {
+			Expect(getIPs()).To(Equal([]string{stableIP, flappingIP}))
+		})
+	})
+})
+
+func newReadinessEndpointSlice(namespace, name, clusterID, readyIP, otherIP string, otherReady bool) *discovery.EndpointSlice {
+	ready := true
+
+	return &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelManagedBy:          lhconstants.LabelValueManagedBy,
+				lhconstants.LabelSourceNamespace:  namespace,
+				lhconstants.MCSLabelSourceCluster: clusterID,
+				lhconstants.MCSLabelServiceName:   name,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Endpoints: []discovery.Endpoint{
+			{
+				Addresses:  []string{readyIP},
+				Conditions: discovery.EndpointConditions{Ready: &ready},
+			},
+			{
+				Addresses:  []string{otherIP},
+				Conditions: discovery.EndpointConditions{Ready: &otherReady},
+			},
+		},
+	}
+}
@@ -18,6 +18,7 @@ require (
 	k8s.io/client-go v0.21.11
 	k8s.io/klog v1.0.0
 	sigs.k8s.io/mcs-api v0.1.0
+	sigs.k8s.io/yaml v1.2.0
 )
 
 // Local project
@@ -0,0 +1,135 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const podIPIndex = "podIP"
+
+type NewClientsetFunc func(kubeConfig *rest.Config) (kubernetes.Interface, error)
+
+// NewClientset is an indirection hook for unit tests to supply fake client sets.
+var NewClientset NewClientsetFunc
+
+// The Controller watches the local pods to resolve a client's source IP to the node it's running on.
+type Controller struct {
+	// Indirection hook for unit tests to supply fake client sets.
+	NewClientset NewClientsetFunc
+	podInformer  cache.Controller
+	podIndexer   cache.Indexer
+	stopCh       chan struct{}
+}
+
+func NewController() *Controller {
+	return &Controller{
+		NewClientset: getNewClientsetFunc(),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func getNewClientsetFunc() NewClientsetFunc {
+	if NewClientset != nil {
+		return NewClientset
+	}
+
+	return func(c *rest.Config) (kubernetes.Interface, error) {
+		return kubernetes.NewForConfig(c) // nolint:wrapcheck // Let the caller wrap it.
+	}
+}
+
+func (c *Controller) Start(kubeConfig *rest.Config) error {
+	klog.Infof("Starting Node Controller")
+
+	clientSet, err := c.NewClientset(kubeConfig)
+	if err != nil {
+		return errors.Wrap(err, "error creating client set")
+	}
+
+	// nolint:wrapcheck // Let the caller wrap these errors.
+	c.podIndexer, c.podInformer = cache.NewIndexerInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return clientSet.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return clientSet.CoreV1().Pods(metav1.NamespaceAll).Watch(context.TODO(), options)
+			},
+		},
+		&v1.Pod{},
+		0,
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{podIPIndex: indexByPodIP},
+	)
+
+	go c.podInformer.Run(c.stopCh)
+
+	return nil
+}
+
+func (c *Controller) Stop() {
+	close(c.stopCh)
+
+	klog.Infof("Node Controller stopped")
+}
+
+// GetNodeName returns the name of the node running the pod with the given IP. Pods using the host network share the
+// node's IP so the node is resolved for those as well.
+func (c *Controller) GetNodeName(ip string) (string, bool) {
+	objs, err := c.podIndexer.ByIndex(podIPIndex, ip)
+	if err != nil {
+		klog.V(log.DEBUG).Infof("Error looking up pod for IP %q: %v", ip, err)
+		return "", false
+	}
+
+	for _, obj := range objs {
+		if nodeName := obj.(*v1.Pod).Spec.NodeName; nodeName != "" {
+			return nodeName, true
+		}
+	}
+
+	return "", false
+}
+
+func indexByPodIP(obj interface{}) ([]string, error) {
+	pod := obj.(*v1.Pod)
+
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, podIP := range pod.Status.PodIPs {
+		ips = append(ips, podIP.IP)
+	}
+
+	if len(ips) == 0 && pod.Status.PodIP != "" {
+		ips = append(ips, pod.Status.PodIP)
+	}
+
+	return ips, nil
+}
@@ -0,0 +1,75 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lighthouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DumpPath is the HTTP path on which the service map dump is served.
+	DumpPath = "/dump"
+
+	// DumpFormatParam is the query parameter that selects the dump format.
+	DumpFormatParam = "format"
+
+	DumpFormatJSON = "json"
+	DumpFormatYAML = "yaml"
+)
+
+// ServeDump writes a dump of the plugin's service map, for debugging. The format is selected by the DumpFormatParam
+// query parameter and is JSON by default.
+func (lh *Lighthouse) ServeDump(w http.ResponseWriter, r *http.Request) {
+	var (
+		data        []byte
+		err         error
+		contentType string
+	)
+
+	services := lh.ServiceImports.Dump()
+
+	switch format := r.URL.Query().Get(DumpFormatParam); format {
+	case "", DumpFormatJSON:
+		contentType = "application/json"
+		data, err = json.MarshalIndent(services, "", "  ")
+	case DumpFormatYAML:
+		contentType = "application/yaml"
+		data, err = yaml.Marshal(services)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported %s %q", DumpFormatParam, format), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("Error serializing the service map dump: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if _, err := w.Write(data); err != nil {
+		log.Errorf("Error writing the service map dump: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lighthouse_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lighthouse "github.com/submariner-io/lighthouse/coredns/plugin"
+	"github.com/submariner-io/lighthouse/coredns/serviceimport"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("Service map dump", func() {
+	var (
+		lh       *lighthouse.Lighthouse
+		recorder *httptest.ResponseRecorder
+		expected []serviceimport.ServiceDump
+	)
+
+	BeforeEach(func() {
+		lh = &lighthouse.Lighthouse{
+			ServiceImports: serviceimport.NewMap(clusterID),
+		}
+
+		lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID2, serviceIP2, portName1, portNumber1, protocol1,
+			mcsv1a1.ClusterSetIP))
+		lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID, serviceIP, portName1, portNumber1, protocol1,
+			mcsv1a1.ClusterSetIP))
+
+		expected = []serviceimport.ServiceDump{
+			{
+				Namespace: namespace1,
+				Name:      service1,
+				Clusters: []serviceimport.ClusterDump{
+					{
+						Cluster: clusterID,
+						IP:      serviceIP,
+						Ports:   []mcsv1a1.ServicePort{{Name: portName1, Protocol: protocol1, Port: portNumber1}},
+						Weight:  1,
+					},
+					{
+						Cluster: clusterID2,
+						IP:      serviceIP2,
+						Ports:   []mcsv1a1.ServicePort{{Name: portName1, Protocol: protocol1, Port: portNumber1}},
+						Weight:  1,
+					},
+				},
+			},
+		}
+
+		recorder = httptest.NewRecorder()
+	})
+
+	serveDump := func(target string) {
+		lh.ServeDump(recorder, httptest.NewRequest(http.MethodGet, target, http.NoBody))
+	}
+
+	When("no format is requested", func() {
+		It("should return JSON", func() {
+			serveDump(lighthouse.DumpPath)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var actual []serviceimport.ServiceDump
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &actual)).To(Succeed())
+			Expect(actual).To(Equal(expected))
+		})
+	})
+
+	When("the JSON format is requested", func() {
+		It("should return JSON", func() {
+			serveDump(lighthouse.DumpPath + "?format=json")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var actual []serviceimport.ServiceDump
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &actual)).To(Succeed())
+			Expect(actual).To(Equal(expected))
+		})
+	})
+
+	When("the YAML format is requested", func() {
+		It("should return YAML", func() {
+			serveDump(lighthouse.DumpPath + "?format=yaml")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/yaml"))
+			Expect(json.Valid(recorder.Body.Bytes())).To(BeFalse())
+
+			var actual []serviceimport.ServiceDump
+			Expect(yaml.Unmarshal(recorder.Body.Bytes(), &actual)).To(Succeed())
+			Expect(actual).To(Equal(expected))
+		})
+	})
+
+	When("an unsupported format is requested", func() {
+		It("should return a bad request error", func() {
+			serveDump(lighthouse.DumpPath + "?format=xml")
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(ContainSubstring(`unsupported format "xml"`))
+		})
+	})
+})
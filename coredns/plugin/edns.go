@@ -0,0 +1,58 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lighthouse
+
+import (
+	"github.com/miekg/dns"
+)
+
+const (
+	// SessionAffinityOptionCode is the EDNS0 local option code that carries a session identifier. The option data is
+	// an opaque byte string, at most MaxSessionIDLength bytes long, that the client or an upstream resolver sets to the
+	// same value for all queries belonging to a session. Queries carrying the option consistently resolve to the same
+	// cluster for a ClusterSetIP service while that cluster remains available.
+	SessionAffinityOptionCode = dns.EDNS0LOCALSTART
+
+	// MaxSessionIDLength is the maximum length of a session identifier. Longer identifiers are ignored.
+	MaxSessionIDLength = 64
+)
+
+// sessionIDFromRequest returns the session identifier carried in the request's EDNS0 session affinity option, if any.
+func sessionIDFromRequest(r *dns.Msg) string {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+
+	for _, o := range opt.Option {
+		local, ok := o.(*dns.EDNS0_LOCAL)
+		if !ok || local.Code != SessionAffinityOptionCode {
+			continue
+		}
+
+		if len(local.Data) == 0 || len(local.Data) > MaxSessionIDLength {
+			log.Debugf("Ignoring session affinity option with invalid length %d", len(local.Data))
+			return ""
+		}
+
+		return string(local.Data)
+	}
+
+	return ""
+}
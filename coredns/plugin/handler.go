@@ -22,11 +22,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
 	"github.com/submariner-io/lighthouse/coredns/serviceimport"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 const PluginName = "lighthouse"
@@ -42,6 +46,14 @@ func (lh *Lighthouse) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns
 	// zone:  example.org.
 	// Matches will return zone in all lower cases
 	zone := plugin.Zones(lh.Zones).Matches(qname)
+	if zone == "" {
+		zone = plugin.Zones(lh.LegacyZones).Matches(qname)
+		if zone != "" {
+			log.Debugf("Request for %q matches legacy zone %q", qname, zone)
+			incLegacyZoneQueryCounter(zone)
+		}
+	}
+
 	if zone == "" {
 		log.Debugf("Request does not match configured zones %v", lh.Zones)
 		return lh.nextOrFailure(ctx, state.Name(), w, r, dns.RcodeNotZone, "No matching zone found")
@@ -64,31 +76,78 @@ func (lh *Lighthouse) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns
 		return lh.nextOrFailure(ctx, state.Name(), w, r, dns.RcodeNameError, "Only services supported")
 	}
 
+	pReq.sessionID = sessionIDFromRequest(r)
+
+	if lh.MaxConcurrentAnswers > 0 {
+		if !lh.acquireAnswerSlot(ctx) {
+			incOverLimitCounter(lh.OverLimitPolicy)
+			log.Debugf("Too many concurrent queries - failing %q with policy %q", qname, lh.OverLimitPolicy)
+
+			return dns.RcodeServerFailure, lh.error("too many concurrent queries")
+		}
+
+		defer lh.releaseAnswerSlot()
+	}
+
 	return lh.getDNSRecord(ctx, zone, state, w, r, pReq)
 }
 
+// acquireAnswerSlot returns true if one of the MaxConcurrentAnswers answer slots was acquired according to the
+// OverLimitPolicy. If so, the slot must be released via releaseAnswerSlot.
+func (lh *Lighthouse) acquireAnswerSlot(ctx context.Context) bool {
+	lh.answerSlotsOnce.Do(func() {
+		lh.answerSlots = make(chan struct{}, lh.MaxConcurrentAnswers)
+	})
+
+	select {
+	case lh.answerSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if lh.OverLimitPolicy != OverLimitQueue {
+		return false
+	}
+
+	timer := time.NewTimer(lh.OverLimitQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case lh.answerSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (lh *Lighthouse) releaseAnswerSlot() {
+	<-lh.answerSlots
+}
+
 func (lh *Lighthouse) getDNSRecord(ctx context.Context, zone string, state *request.Request, w dns.ResponseWriter,
 	r *dns.Msg, pReq *recordRequest,
 ) (int, error) {
-	var isHeadless bool
 	var (
 		dnsRecords []serviceimport.DNSRecord
-		found      bool
-		record     *serviceimport.DNSRecord
+		isHeadless bool
 	)
 
-	record, found = lh.getClusterIPForSvc(pReq)
-	if !found {
-		dnsRecords, found = lh.EndpointSlices.GetDNSRecords(pReq.hostname, pReq.cluster, pReq.namespace,
-			pReq.service, lh.ClusterStatus.IsConnected)
+	if services, ok := lh.getAggregatedServices(pReq); ok {
+		dnsRecords, isHeadless = lh.getAggregateRecords(pReq, services)
+	} else {
+		var found bool
+
+		dnsRecords, isHeadless, found = lh.getServiceRecords(pReq)
 		if !found {
 			log.Debugf("No record found for %q", state.QName())
 			return lh.nextOrFailure(ctx, state.Name(), w, r, dns.RcodeNameError, "record not found")
 		}
+	}
 
-		isHeadless = true
-	} else if record != nil && record.IP != "" {
-		dnsRecords = append(dnsRecords, *record)
+	if lh.RecordLastQuery {
+		setLastQueryTimestamp(pReq.service, pReq.namespace)
 	}
 
 	if len(dnsRecords) == 0 {
@@ -96,9 +155,23 @@ func (lh *Lighthouse) getDNSRecord(ctx context.Context, zone string, state *requ
 		return lh.emptyResponse(state)
 	}
 
-	if state.QType() == dns.TypeAAAA {
-		log.Debugf("Returning empty response for TypeAAAA query")
-		return lh.emptyResponse(state)
+	if state.QType() == dns.TypeA || state.QType() == dns.TypeAAAA {
+		dnsRecords = filterRecordsByFamily(dnsRecords, state.QType() == dns.TypeAAAA)
+		if len(dnsRecords) == 0 {
+			return lh.missingFamilyResponse(state, pReq)
+		}
+	}
+
+	if isHeadless && pReq.hostname == "" && lh.NodeResolver != nil {
+		dnsRecords = lh.preferNodeLocalRecords(dnsRecords, state.IP())
+	}
+
+	if isHeadless && pReq.hostname == "" && lh.MaxEndpointsPerCluster > 0 {
+		dnsRecords = lh.capRecordsPerCluster(dnsRecords)
+	}
+
+	if lh.SortAnswers {
+		sortRecords(dnsRecords)
 	}
 
 	// Count records
@@ -109,9 +182,12 @@ func (lh *Lighthouse) getDNSRecord(ctx context.Context, zone string, state *requ
 
 	records := make([]dns.RR, 0)
 
-	if state.QType() == dns.TypeA {
+	switch state.QType() {
+	case dns.TypeA:
 		records = lh.createARecords(dnsRecords, state)
-	} else if state.QType() == dns.TypeSRV {
+	case dns.TypeAAAA:
+		records = lh.createAAAARecords(dnsRecords, state)
+	case dns.TypeSRV:
 		records = lh.createSRVRecords(dnsRecords, state, pReq, zone, isHeadless)
 	}
 
@@ -126,8 +202,20 @@ func (lh *Lighthouse) getDNSRecord(ctx context.Context, zone string, state *requ
 	a.SetReply(r)
 	a.Authoritative = true
 	a.Answer = append(a.Answer, records...)
+
+	if isHeadless && lh.TruncateOversizedHeadless && state.Proto() == "udp" && a.Len() > state.Size() {
+		log.Debugf("Answer for %q exceeds the UDP message size %d - setting the TC bit", state.QName(), state.Size())
+
+		a.Answer = nil
+		a.Truncated = true
+	}
+
 	log.Debugf("Responding to query with '%s'", a.Answer)
 
+	if lh.LogSampleRate > 0 && lh.sampleLog() {
+		lh.logResolution(state, pReq, dnsRecords, isHeadless)
+	}
+
 	wErr := w.WriteMsg(a)
 	if wErr != nil {
 		// Error writing reply msg
@@ -138,6 +226,117 @@ func (lh *Lighthouse) getDNSRecord(ctx context.Context, zone string, state *requ
 	return dns.RcodeSuccess, nil
 }
 
+// getServiceRecords returns the records of the service requested by pReq and whether the service is headless.
+func (lh *Lighthouse) getServiceRecords(pReq *recordRequest) (dnsRecords []serviceimport.DNSRecord, isHeadless, found bool) {
+	record, found := lh.getClusterIPForSvc(pReq)
+	if found {
+		if record != nil && record.IP != "" {
+			dnsRecords = append(dnsRecords, *record)
+		}
+
+		return dnsRecords, false, true
+	}
+
+	dnsRecords, found = lh.EndpointSlices.GetDNSRecords(pReq.hostname, pReq.cluster, pReq.namespace,
+		pReq.service, lh.ClusterStatus.IsConnected)
+	if !found {
+		return nil, false, false
+	}
+
+	if pReq.cluster == "" && lh.ServiceImports.IsClusterSetLocal(pReq.namespace, pReq.service) {
+		dnsRecords = filterRecordsByCluster(dnsRecords, lh.ClusterStatus.LocalClusterID())
+	}
+
+	return dnsRecords, true, true
+}
+
+// getAggregatedServices returns the services aggregated under the name requested by pReq, if ServiceAggregates is
+// configured and the name is an aggregate. An aggregate takes precedence over a service of the same name.
+func (lh *Lighthouse) getAggregatedServices(pReq *recordRequest) ([]types.NamespacedName, bool) {
+	if lh.ServiceAggregates == nil {
+		return nil, false
+	}
+
+	return lh.ServiceAggregates.GetServices(pReq.service, pReq.namespace)
+}
+
+// getAggregateRecords returns the union of the records of the given aggregated services for the request. The
+// aggregate is treated as headless if any of its services is headless.
+func (lh *Lighthouse) getAggregateRecords(pReq *recordRequest, services []types.NamespacedName,
+) (dnsRecords []serviceimport.DNSRecord, isHeadless bool) {
+	for _, service := range services {
+		serviceReq := *pReq
+		serviceReq.namespace = service.Namespace
+		serviceReq.service = service.Name
+
+		records, headless, found := lh.getServiceRecords(&serviceReq)
+		if !found {
+			log.Debugf("Aggregated service %q of %s/%s not found", service, pReq.namespace, pReq.service)
+			continue
+		}
+
+		dnsRecords = append(dnsRecords, records...)
+		isHeadless = isHeadless || headless
+	}
+
+	return dnsRecords, isHeadless
+}
+
+// missingFamilyResponse responds to an A or AAAA query for which the service has no records of the requested IP family.
+// This is only an error if the service requires dual-stack, otherwise the response is empty.
+func (lh *Lighthouse) missingFamilyResponse(state *request.Request, pReq *recordRequest) (int, error) {
+	if lh.ServiceImports.GetIPFamilyPolicy(pReq.namespace, pReq.service) == corev1.IPFamilyPolicyRequireDualStack {
+		log.Warningf("Service %s/%s requires dual-stack but has no records for query type %s", pReq.namespace, pReq.service,
+			dns.TypeToString[state.QType()])
+
+		return dns.RcodeServerFailure, lh.error("no records for the IP family required by the service")
+	}
+
+	log.Debugf("Returning empty response for query type %s", dns.TypeToString[state.QType()])
+
+	return lh.emptyResponse(state)
+}
+
+// sampleLog returns true for the fraction of calls configured by LogSampleRate.
+func (lh *Lighthouse) sampleLog() bool {
+	return rand.Float64() < lh.LogSampleRate // nolint:gosec // A cryptographically secure generator isn't needed for sampling.
+}
+
+func (lh *Lighthouse) logResolution(state *request.Request, pReq *recordRequest, dnsRecords []serviceimport.DNSRecord,
+	isHeadless bool,
+) {
+	clusters := make([]string, 0, len(dnsRecords))
+	ips := make([]string, 0, len(dnsRecords))
+	seen := map[string]bool{}
+
+	for i := range dnsRecords {
+		ips = append(ips, dnsRecords[i].IP)
+
+		if !seen[dnsRecords[i].ClusterName] {
+			seen[dnsRecords[i].ClusterName] = true
+			clusters = append(clusters, dnsRecords[i].ClusterName)
+		}
+	}
+
+	log.Infof("Resolved %q type %s: clusters %v, answer IPs %v, strategy %q", state.QName(), dns.TypeToString[state.QType()],
+		clusters, ips, lh.resolutionStrategy(pReq, dnsRecords, isHeadless))
+}
+
+func (lh *Lighthouse) resolutionStrategy(pReq *recordRequest, dnsRecords []serviceimport.DNSRecord, isHeadless bool) string {
+	switch {
+	case isHeadless:
+		return "headless"
+	case pReq.cluster != "":
+		return "cluster-specific"
+	case len(dnsRecords) > 0 && dnsRecords[0].ClusterName == lh.ClusterStatus.LocalClusterID():
+		return "local-cluster"
+	case pReq.sessionID != "":
+		return "session-affinity"
+	default:
+		return "load-balanced"
+	}
+}
+
 func (lh *Lighthouse) emptyResponse(state *request.Request) (int, error) {
 	a := new(dns.Msg)
 	a.SetReply(state.Req)
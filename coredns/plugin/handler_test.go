@@ -19,8 +19,14 @@ limitations under the License.
 package lighthouse_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	golog "log"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/pkg/fall"
@@ -29,6 +35,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	lighthouse "github.com/submariner-io/lighthouse/coredns/plugin"
 	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
 	"github.com/submariner-io/lighthouse/coredns/endpointslice"
@@ -36,6 +43,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
@@ -48,6 +56,7 @@ const (
 	localClusterID = "local"
 	clusterID      = "cluster1"
 	clusterID2     = "cluster2"
+	clusterID3     = "cluster3"
 	endpointIP     = "100.96.157.101"
 	endpointIP2    = "100.96.157.102"
 	portName1      = "http"
@@ -67,6 +76,18 @@ var _ = Describe("Lighthouse DNS plugin Handler", func() {
 	Context("Headless services", testHeadlessService)
 	Context("Local services", testLocalService)
 	Context("SRV  records", testSRVMultiplePorts)
+	Context("Session affinity", testSessionAffinity)
+	Context("IP family policy", testIPFamilyPolicy)
+	Context("Sampled resolution logging", testSampledLogging)
+	Context("Per-cluster endpoint cap", testMaxEndpointsPerCluster)
+	Context("Node-local preference", testNodeLocal)
+	Context("Concurrent answer limit", testConcurrentAnswerLimit)
+	Context("Clusterset-local traffic policy", testClusterSetLocal)
+	Context("Service aggregates", testServiceAggregates)
+	Context("Last query recording", testLastQueryRecording)
+	Context("Sorted answers", testSortAnswers)
+	Context("Legacy zones", testLegacyZones)
+	Context("Oversized headless answers", testTruncateOversizedHeadless)
 })
 
 type FailingResponseWriter struct {
@@ -116,6 +137,45 @@ func (m *MockLocalServices) GetIP(name, namespace string) (*serviceimport.DNSRec
 	return record, found
 }
 
+type MockNodeResolver struct {
+	nodesByIP map[string]string
+}
+
+func (m *MockNodeResolver) GetNodeName(ip string) (string, bool) {
+	nodeName, found := m.nodesByIP[ip]
+	return nodeName, found
+}
+
+type MockServiceAggregates struct {
+	services map[string][]types.NamespacedName
+}
+
+func (m *MockServiceAggregates) GetServices(name, namespace string) ([]types.NamespacedName, bool) {
+	services, found := m.services[getKey(name, namespace)]
+	return services, found
+}
+
+// BlockingResponseWriter blocks writing a response until released so the query's answer slot remains held.
+type BlockingResponseWriter struct {
+	test.ResponseWriter
+	writing     chan struct{}
+	release     chan struct{}
+	releaseOnce sync.Once
+}
+
+func (w *BlockingResponseWriter) WriteMsg(m *dns.Msg) error {
+	close(w.writing)
+	<-w.release
+
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+func (w *BlockingResponseWriter) Release() {
+	w.releaseOnce.Do(func() {
+		close(w.release)
+	})
+}
+
 func getKey(name, namespace string) string {
 	return namespace + "/" + name
 }
@@ -976,45 +1036,1059 @@ func testSRVMultiplePorts() {
 	})
 }
 
-type handlerTestDriver struct {
-	mockCs *MockClusterStatus
-	mockEs *MockEndpointStatus
-	mockLs *MockLocalServices
-	lh     *lighthouse.Lighthouse
+func testSessionAffinity() {
+	var t *handlerTestDriver
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockCs.clusterStatusMap[clusterID2] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID2] = true
+
+		t.lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID2, serviceIP2, portName2,
+			portNumber2, protocol2, mcsv1a1.ClusterSetIP))
+	})
+
+	When("the session affinity option is present", func() {
+		It("should consistently return the same IP for a session", func() {
+			for _, session := range []string{"session-1", "session-2", "session-3", "session-4"} {
+				ip := t.queryAWithSession(qname, session)
+				Expect(ip).To(Or(Equal(serviceIP), Equal(serviceIP2)))
+
+				for i := 0; i < 10; i++ {
+					Expect(t.queryAWithSession(qname, session)).To(Equal(ip))
+				}
+			}
+		})
+
+		It("should fail over to the other cluster when the session's cluster is disconnected", func() {
+			session := "session-1"
+			ip := t.queryAWithSession(qname, session)
+
+			other := serviceIP
+			if ip == serviceIP {
+				other = serviceIP2
+				t.mockCs.clusterStatusMap[clusterID] = false
+			} else {
+				t.mockCs.clusterStatusMap[clusterID2] = false
+			}
+
+			Expect(t.queryAWithSession(qname, session)).To(Equal(other))
+		})
+	})
+
+	When("the session affinity option is absent", func() {
+		It("should return the IPs round-robin", func() {
+			first := t.queryAWithSession(qname, "")
+			second := t.queryAWithSession(qname, "")
+			Expect([]string{first, second}).To(ConsistOf(serviceIP, serviceIP2))
+		})
+	})
 }
 
-func newHandlerTestDriver() *handlerTestDriver {
-	t := &handlerTestDriver{
-		mockCs: NewMockClusterStatus(),
-		mockEs: NewMockEndpointStatus(),
-		mockLs: NewMockLocalServices(),
+func testIPFamilyPolicy() {
+	var (
+		rec *dnstest.Recorder
+		t   *handlerTestDriver
+	)
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	})
+
+	setPolicy := func(policy v1.IPFamilyPolicyType) {
+		si := newServiceImport(namespace1, service1, clusterID, serviceIP, portName1, portNumber1, protocol1, mcsv1a1.ClusterSetIP)
+		si.Annotations[lhconstants.IPFamilyPolicyAnnotation] = string(policy)
+		t.lh.ServiceImports.Put(si)
 	}
 
-	t.lh = &lighthouse.Lighthouse{
-		Zones:           []string{"clusterset.local."},
-		ServiceImports:  setupServiceImportMap(),
-		EndpointSlices:  setupEndpointSliceMap(),
-		ClusterStatus:   t.mockCs,
-		EndpointsStatus: t.mockEs,
-		LocalServices:   t.mockLs,
-		TTL:             uint32(5),
+	for _, p := range []v1.IPFamilyPolicyType{v1.IPFamilyPolicySingleStack, v1.IPFamilyPolicyPreferDualStack} {
+		policy := p
+
+		When(fmt.Sprintf("an IPv4-only service has the %s policy", policy), func() {
+			BeforeEach(func() {
+				setPolicy(policy)
+			})
+
+			It("should return an empty response for a type AAAA query", func() {
+				t.executeTestCase(rec, test.Case{
+					Qname:  qname,
+					Qtype:  dns.TypeAAAA,
+					Rcode:  dns.RcodeSuccess,
+					Answer: []dns.RR{},
+				})
+			})
+
+			It("should return an A record for a type A query", func() {
+				t.executeTestCase(rec, test.Case{
+					Qname: qname,
+					Qtype: dns.TypeA,
+					Rcode: dns.RcodeSuccess,
+					Answer: []dns.RR{
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+					},
+				})
+			})
+		})
 	}
 
-	return t
+	When("an IPv4-only service has the RequireDualStack policy", func() {
+		BeforeEach(func() {
+			setPolicy(v1.IPFamilyPolicyRequireDualStack)
+		})
+
+		It("should return RcodeServerFailure for a type AAAA query", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeAAAA,
+				Rcode: dns.RcodeServerFailure,
+			})
+		})
+
+		It("should return an A record for a type A query", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+				},
+			})
+		})
+	})
+
+	When("a dual-stack headless service has IPv4 and IPv6 endpoints", func() {
+		const endpointIPv6 = "fd00::157:101"
+
+		BeforeEach(func() {
+			t.lh.ServiceImports = serviceimport.NewMap(localClusterID)
+			si := newServiceImport(namespace1, service1, clusterID, "", portName1, portNumber1, protocol1, mcsv1a1.Headless)
+			si.Annotations[lhconstants.IPFamilyPolicyAnnotation] = string(v1.IPFamilyPolicyRequireDualStack)
+			t.lh.ServiceImports.Put(si)
+
+			t.lh.EndpointSlices = endpointslice.NewMap()
+			t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID, portName1, []string{hostName1, hostName2},
+				[]string{endpointIP, endpointIPv6}, portNumber1, protocol1))
+		})
+
+		It("should return only the IPv6 endpoints for a type AAAA query", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeAAAA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.AAAA(fmt.Sprintf("%s    5    IN    AAAA    %s", qname, endpointIPv6)),
+				},
+			})
+		})
+
+		It("should return only the IPv4 endpoints for a type A query", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP)),
+				},
+			})
+		})
+	})
 }
 
-// nolint:gocritic // (hugeParam) It's fine to pass 'tc' by value here.
-func (t *handlerTestDriver) executeTestCase(rec *dnstest.Recorder, tc test.Case) {
-	code, err := t.lh.ServeDNS(context.TODO(), rec, tc.Msg())
+func testSampledLogging() {
+	var (
+		rec    *dnstest.Recorder
+		t      *handlerTestDriver
+		output *bytes.Buffer
+	)
 
-	Expect(code).Should(Equal(tc.Rcode))
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
 
-	if tc.Rcode == dns.RcodeSuccess {
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+
+		output = &bytes.Buffer{}
+		golog.SetOutput(output)
+	})
+
+	AfterEach(func() {
+		golog.SetOutput(os.Stderr)
+	})
+
+	executeTestCase := func() {
+		t.executeTestCase(rec, test.Case{
+			Qname: qname,
+			Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+			},
+		})
+	}
+
+	When("the sample rate is 1", func() {
+		BeforeEach(func() {
+			t.lh.LogSampleRate = 1
+		})
+
+		It("should log the resolution details", func() {
+			executeTestCase()
+			Expect(output.String()).To(ContainSubstring(fmt.Sprintf("Resolved %q type A", qname)))
+			Expect(output.String()).To(ContainSubstring(fmt.Sprintf("clusters [%s]", clusterID)))
+			Expect(output.String()).To(ContainSubstring(fmt.Sprintf("answer IPs [%s]", serviceIP)))
+			Expect(output.String()).To(ContainSubstring(`strategy "load-balanced"`))
+		})
+	})
+
+	When("the sample rate is 0", func() {
+		It("should not log the resolution details", func() {
+			executeTestCase()
+			Expect(output.String()).ToNot(ContainSubstring("Resolved"))
+		})
+	})
+}
+
+func testMaxEndpointsPerCluster() {
+	const maxPerCluster = 5
+
+	var t *handlerTestDriver
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	newEndpointIPs := func(prefix string, count int) ([]string, []string) {
+		var hostNames, ips []string
+
+		for i := 0; i < count; i++ {
+			hostNames = append(hostNames, fmt.Sprintf("host-%d", i))
+			ips = append(ips, fmt.Sprintf("%s.%d", prefix, i+1))
+		}
+
+		return hostNames, ips
+	}
+
+	queryA := func() map[string]int {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		code, err := t.lh.ServeDNS(context.TODO(), rec, test.Case{Qname: qname, Qtype: dns.TypeA}.Msg())
 		Expect(err).To(Succeed())
-		Expect(test.SortAndCheck(rec.Msg, tc)).To(Succeed())
-	} else {
-		Expect(err).To(HaveOccurred())
+		Expect(code).To(Equal(dns.RcodeSuccess))
+
+		perCluster := map[string]int{}
+
+		for _, rr := range rec.Msg.Answer {
+			ip := rr.(*dns.A).A.String()
+			perCluster[ip[:strings.LastIndex(ip, ".")]]++
+		}
+
+		return perCluster
+	}
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockCs.clusterStatusMap[clusterID2] = true
+		t.mockCs.clusterStatusMap[clusterID3] = true
+		t.mockCs.localClusterID = clusterID
+		t.lh.MaxEndpointsPerCluster = maxPerCluster
+
+		t.lh.ServiceImports = serviceimport.NewMap(clusterID)
+		t.lh.EndpointSlices = endpointslice.NewMap()
+		t.lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID, "", portName1,
+			portNumber1, protocol1, mcsv1a1.Headless))
+
+		hostNames, ips := newEndpointIPs("10.1.0", 100)
+		t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID, portName1, hostNames, ips, portNumber1, protocol1))
+
+		hostNames, ips = newEndpointIPs("10.2.0", 5)
+		t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID2, portName1, hostNames, ips, portNumber1, protocol1))
+
+		hostNames, ips = newEndpointIPs("10.3.0", 5)
+		t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID3, portName1, hostNames, ips, portNumber1, protocol1))
+	})
+
+	It("should take at most the configured number of endpoints from each cluster", func() {
+		Expect(queryA()).To(Equal(map[string]int{"10.1.0": maxPerCluster, "10.2.0": 5, "10.3.0": 5}))
+	})
+
+	It("should rotate through the endpoints of a cluster exceeding the cap", func() {
+		seen := map[string]bool{}
+
+		for i := 0; i < 100/maxPerCluster; i++ {
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			_, err := t.lh.ServeDNS(context.TODO(), rec, test.Case{Qname: qname, Qtype: dns.TypeA}.Msg())
+			Expect(err).To(Succeed())
+
+			for _, rr := range rec.Msg.Answer {
+				seen[rr.(*dns.A).A.String()] = true
+			}
+		}
+
+		Expect(seen).To(HaveLen(110))
+	})
+
+	When("the cap isn't configured", func() {
+		BeforeEach(func() {
+			t.lh.MaxEndpointsPerCluster = 0
+		})
+
+		It("should return all the endpoints", func() {
+			Expect(queryA()).To(Equal(map[string]int{"10.1.0": 100, "10.2.0": 5, "10.3.0": 5}))
+		})
+	})
+}
+
+func testNodeLocal() {
+	const (
+		clientIP  = "10.240.0.1"
+		nodeName1 = "node-1"
+		nodeName2 = "node-2"
+	)
+
+	var (
+		rec *dnstest.Recorder
+		t   *handlerTestDriver
+	)
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	newEndpointSliceOnNodes := func(clusterID string, ips, nodeNames []string) *discovery.EndpointSlice {
+		hostNames := make([]string, len(ips))
+		for i := range ips {
+			hostNames[i] = fmt.Sprintf("host-%d", i)
+		}
+
+		es := newEndpointSlice(namespace1, service1, clusterID, portName1, hostNames, ips, portNumber1, protocol1)
+		for i := range es.Endpoints {
+			es.Endpoints[i].NodeName = &nodeNames[i]
+		}
+
+		return es
 	}
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockCs.clusterStatusMap[clusterID2] = true
+		t.mockCs.localClusterID = clusterID
+
+		t.lh.ServiceImports = serviceimport.NewMap(clusterID)
+		t.lh.EndpointSlices = endpointslice.NewMap()
+		t.lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID, "", portName1,
+			portNumber1, protocol1, mcsv1a1.Headless))
+		t.lh.EndpointSlices.Put(newEndpointSliceOnNodes(clusterID, []string{endpointIP, endpointIP2},
+			[]string{nodeName1, nodeName2}))
+		t.lh.EndpointSlices.Put(newEndpointSliceOnNodes(clusterID2, []string{serviceIP}, []string{nodeName1}))
+
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	})
+
+	When("node-local preference is enabled and the client's node has a local endpoint", func() {
+		BeforeEach(func() {
+			t.lh.NodeResolver = &MockNodeResolver{nodesByIP: map[string]string{clientIP: nodeName1}}
+		})
+
+		It("should only return the endpoint on the client's node", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP)),
+				},
+			})
+		})
+	})
+
+	When("node-local preference is enabled and the client's node has no local endpoint", func() {
+		BeforeEach(func() {
+			t.lh.NodeResolver = &MockNodeResolver{nodesByIP: map[string]string{clientIP: "node-3"}}
+		})
+
+		It("should return all the endpoints", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP)),
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP2)),
+				},
+			})
+		})
+	})
+
+	When("node-local preference is enabled and the client's node can't be resolved", func() {
+		BeforeEach(func() {
+			t.lh.NodeResolver = &MockNodeResolver{nodesByIP: map[string]string{}}
+		})
+
+		It("should return all the endpoints", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP)),
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP2)),
+				},
+			})
+		})
+	})
+
+	When("node-local preference isn't enabled", func() {
+		It("should return all the endpoints", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP)),
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP2)),
+				},
+			})
+		})
+	})
+}
+
+func testConcurrentAnswerLimit() {
+	var (
+		t       *handlerTestDriver
+		blocked *BlockingResponseWriter
+		done    chan struct{}
+	)
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+		t.lh.MaxConcurrentAnswers = 1
+		t.lh.OverLimitPolicy = lighthouse.OverLimitServFail
+
+		blocked = &BlockingResponseWriter{writing: make(chan struct{}), release: make(chan struct{})}
+		done = make(chan struct{})
+	})
+
+	JustBeforeEach(func() {
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+
+			code, err := t.lh.ServeDNS(context.TODO(), blocked, test.Case{Qname: qname, Qtype: dns.TypeA}.Msg())
+			Expect(err).To(Succeed())
+			Expect(code).To(Equal(dns.RcodeSuccess))
+		}()
+
+		Eventually(blocked.writing).Should(BeClosed())
+	})
+
+	AfterEach(func() {
+		blocked.Release()
+		Eventually(done).Should(BeClosed())
+	})
+
+	When("the over-limit policy is servfail", func() {
+		It("should fail excess queries with SERVFAIL", func() {
+			t.executeTestCase(dnstest.NewRecorder(&test.ResponseWriter{}), test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeServerFailure,
+			})
+		})
+	})
+
+	When("the over-limit policy is queue", func() {
+		BeforeEach(func() {
+			t.lh.OverLimitPolicy = lighthouse.OverLimitQueue
+			t.lh.OverLimitQueueTimeout = 100 * time.Millisecond
+		})
+
+		It("should fail excess queries with SERVFAIL if no slot frees up within the timeout", func() {
+			t.executeTestCase(dnstest.NewRecorder(&test.ResponseWriter{}), test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeServerFailure,
+			})
+		})
+
+		Context("and a slot frees up within the timeout", func() {
+			BeforeEach(func() {
+				t.lh.OverLimitQueueTimeout = 5 * time.Second
+			})
+
+			It("should answer the queued query", func() {
+				time.AfterFunc(50*time.Millisecond, blocked.Release)
+
+				t.executeTestCase(dnstest.NewRecorder(&test.ResponseWriter{}), test.Case{
+					Qname: qname,
+					Qtype: dns.TypeA,
+					Rcode: dns.RcodeSuccess,
+					Answer: []dns.RR{
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+					},
+				})
+			})
+		})
+	})
+}
+
+func testClusterSetLocal() {
+	var (
+		rec *dnstest.Recorder
+		t   *handlerTestDriver
+	)
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	newClusterSetLocalServiceImport := func(clusterID, serviceIP string, siType mcsv1a1.ServiceImportType) *mcsv1a1.ServiceImport {
+		si := newServiceImport(namespace1, service1, clusterID, serviceIP, portName1, portNumber1, protocol1, siType)
+		si.Annotations[lhconstants.ClusterSetTrafficPolicyAnnotation] = lhconstants.ClusterSetTrafficPolicyLocal
+
+		return si
+	}
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockCs.clusterStatusMap[clusterID2] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID2] = true
+		t.lh.ServiceImports = serviceimport.NewMap(clusterID)
+		t.lh.EndpointSlices = endpointslice.NewMap()
+
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	})
+
+	When("a ClusterSetIP service is exported by a remote cluster only", func() {
+		BeforeEach(func() {
+			t.mockCs.localClusterID = clusterID
+			t.lh.ServiceImports.Put(newClusterSetLocalServiceImport(clusterID2, serviceIP2, mcsv1a1.ClusterSetIP))
+		})
+
+		It("should return an empty response", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname:  qname,
+				Qtype:  dns.TypeA,
+				Rcode:  dns.RcodeSuccess,
+				Answer: []dns.RR{},
+			})
+		})
+
+		It("should still answer a query for the remote cluster", func() {
+			qname := fmt.Sprintf("%s.%s.%s.svc.clusterset.local.", clusterID2, service1, namespace1)
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP2)),
+				},
+			})
+		})
+	})
+
+	When("a headless service is exported by the local and a remote cluster", func() {
+		BeforeEach(func() {
+			t.mockCs.localClusterID = clusterID
+			t.lh.ServiceImports.Put(newClusterSetLocalServiceImport(clusterID, "", mcsv1a1.Headless))
+			t.lh.ServiceImports.Put(newClusterSetLocalServiceImport(clusterID2, "", mcsv1a1.Headless))
+			t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID, portName1, []string{hostName1},
+				[]string{endpointIP}, portNumber1, protocol1))
+			t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID2, portName1, []string{hostName2},
+				[]string{endpointIP2}, portNumber1, protocol1))
+		})
+
+		It("should only return the local cluster's endpoints", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP)),
+				},
+			})
+		})
+	})
+}
+
+func testServiceAggregates() {
+	const (
+		aggregateName = "db"
+		eastService   = "db-east"
+		westService   = "db-west"
+	)
+
+	var (
+		rec *dnstest.Recorder
+		t   *handlerTestDriver
+	)
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", aggregateName, namespace1)
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID2] = true
+		t.mockCs.clusterStatusMap[clusterID3] = true
+		t.mockCs.localClusterID = clusterID
+		t.mockEs.endpointStatusMap[clusterID2] = true
+		t.mockEs.endpointStatusMap[clusterID3] = true
+
+		t.lh.ServiceImports = serviceimport.NewMap(clusterID)
+		t.lh.EndpointSlices = endpointslice.NewMap()
+		t.lh.ServiceImports.Put(newServiceImport(namespace1, eastService, clusterID2, serviceIP, portName1, portNumber1,
+			protocol1, mcsv1a1.ClusterSetIP))
+
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	})
+
+	When("an aggregate spans two differently-named services in different namespaces", func() {
+		BeforeEach(func() {
+			t.lh.ServiceAggregates = &MockServiceAggregates{services: map[string][]types.NamespacedName{
+				getKey(aggregateName, namespace1): {
+					{Namespace: namespace1, Name: eastService},
+					{Namespace: namespace2, Name: westService},
+				},
+			}}
+		})
+
+		Context("and both services are ClusterSetIP", func() {
+			BeforeEach(func() {
+				t.lh.ServiceImports.Put(newServiceImport(namespace2, westService, clusterID3, serviceIP2, portName1, portNumber1,
+					protocol1, mcsv1a1.ClusterSetIP))
+			})
+
+			It("should return the union of the services' records", func() {
+				t.executeTestCase(rec, test.Case{
+					Qname: qname,
+					Qtype: dns.TypeA,
+					Rcode: dns.RcodeSuccess,
+					Answer: []dns.RR{
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP2)),
+					},
+				})
+			})
+		})
+
+		Context("and one of the services is headless", func() {
+			BeforeEach(func() {
+				t.lh.ServiceImports.Put(newServiceImport(namespace2, westService, clusterID3, "", portName1, portNumber1,
+					protocol1, mcsv1a1.Headless))
+				t.lh.EndpointSlices.Put(newEndpointSlice(namespace2, westService, clusterID3, portName1, []string{hostName1},
+					[]string{endpointIP}, portNumber1, protocol1))
+			})
+
+			It("should return the union of the services' records", func() {
+				t.executeTestCase(rec, test.Case{
+					Qname: qname,
+					Qtype: dns.TypeA,
+					Rcode: dns.RcodeSuccess,
+					Answer: []dns.RR{
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, endpointIP)),
+					},
+				})
+			})
+		})
+
+		Context("and one of the services doesn't exist", func() {
+			It("should return the records of the other service", func() {
+				t.executeTestCase(rec, test.Case{
+					Qname: qname,
+					Qtype: dns.TypeA,
+					Rcode: dns.RcodeSuccess,
+					Answer: []dns.RR{
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+					},
+				})
+			})
+		})
+	})
+
+	When("service aggregates aren't configured", func() {
+		It("should return NXDOMAIN for the aggregate name", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeNameError,
+			})
+		})
+	})
+}
+
+func testLastQueryRecording() {
+	const recordedService = "recorded-service"
+
+	var (
+		rec *dnstest.Recorder
+		t   *handlerTestDriver
+	)
+
+	newQname := func(service string) string {
+		return fmt.Sprintf("%s.%s.svc.clusterset.local.", service, namespace1)
+	}
+
+	getLastQueryTimestamp := func(service string) (float64, bool) {
+		families, err := prometheus.DefaultGatherer.Gather()
+		Expect(err).To(Succeed())
+
+		for _, family := range families {
+			if family.GetName() != lighthouse.ServiceDiscoveryLastQueryName {
+				continue
+			}
+
+			for _, metric := range family.GetMetric() {
+				labels := map[string]string{}
+				for _, pair := range metric.GetLabel() {
+					labels[pair.GetName()] = pair.GetValue()
+				}
+
+				if labels["destination_service_name"] == service && labels["destination_service_namespace"] == namespace1 {
+					return metric.GetGauge().GetValue(), true
+				}
+			}
+		}
+
+		return 0, false
+	}
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+		t.lh.ServiceImports = serviceimport.NewMap(clusterID)
+		t.lh.EndpointSlices = endpointslice.NewMap()
+
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	})
+
+	When("recording is enabled", func() {
+		BeforeEach(func() {
+			t.lh.RecordLastQuery = true
+			t.lh.ServiceImports.Put(newServiceImport(namespace1, recordedService, clusterID, serviceIP, portName1, portNumber1,
+				protocol1, mcsv1a1.ClusterSetIP))
+		})
+
+		It("should update the service's last query timestamp on each query", func() {
+			before := float64(time.Now().Unix())
+
+			t.executeTestCase(rec, test.Case{
+				Qname: newQname(recordedService),
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", newQname(recordedService), serviceIP)),
+				},
+			})
+
+			first, found := getLastQueryTimestamp(recordedService)
+			Expect(found).To(BeTrue())
+			Expect(first).To(BeNumerically(">=", before))
+
+			time.Sleep(10 * time.Millisecond)
+
+			t.executeTestCase(dnstest.NewRecorder(&test.ResponseWriter{}), test.Case{
+				Qname: newQname(recordedService),
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", newQname(recordedService), serviceIP)),
+				},
+			})
+
+			second, _ := getLastQueryTimestamp(recordedService)
+			Expect(second).To(BeNumerically(">", first))
+		})
+
+		It("should not record a timestamp for an unknown service", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: newQname("unknown-service"),
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeNameError,
+			})
+
+			_, found := getLastQueryTimestamp("unknown-service")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	When("recording is disabled", func() {
+		const unrecordedService = "unrecorded-service"
+
+		BeforeEach(func() {
+			t.lh.ServiceImports.Put(newServiceImport(namespace1, unrecordedService, clusterID, serviceIP, portName1, portNumber1,
+				protocol1, mcsv1a1.ClusterSetIP))
+		})
+
+		It("should not record a timestamp", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: newQname(unrecordedService),
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.A(fmt.Sprintf("%s    5    IN    A    %s", newQname(unrecordedService), serviceIP)),
+				},
+			})
+
+			_, found := getLastQueryTimestamp(unrecordedService)
+			Expect(found).To(BeFalse())
+		})
+	})
+}
+
+func testSortAnswers() {
+	var t *handlerTestDriver
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	queryAnswerIPs := func() []string {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		code, err := t.lh.ServeDNS(context.TODO(), rec, test.Case{Qname: qname, Qtype: dns.TypeA}.Msg())
+		Expect(err).To(Succeed())
+		Expect(code).To(Equal(dns.RcodeSuccess))
+
+		ips := []string{}
+		for _, rr := range rec.Msg.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+
+		return ips
+	}
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockCs.clusterStatusMap[clusterID2] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID2] = true
+		t.lh.ServiceImports = serviceimport.NewMap(clusterID)
+		t.lh.EndpointSlices = endpointslice.NewMap()
+		t.lh.SortAnswers = true
+
+		t.lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID, "", portName1, portNumber1, protocol1,
+			mcsv1a1.Headless))
+		t.lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID2, "", portName1, portNumber1, protocol1,
+			mcsv1a1.Headless))
+		t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID, portName1, []string{"host1", "host2"},
+			[]string{"10.0.0.100", "10.0.0.9"}, portNumber1, protocol1))
+		t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID2, portName1, []string{"host3", "host4"},
+			[]string{"10.0.0.10", "10.0.0.2"}, portNumber1, protocol1))
+	})
+
+	When("sorted answers are enabled", func() {
+		It("should consistently return the records ordered by IP", func() {
+			for i := 0; i < 5; i++ {
+				Expect(queryAnswerIPs()).To(Equal([]string{"10.0.0.2", "10.0.0.9", "10.0.0.10", "10.0.0.100"}))
+			}
+		})
+	})
+}
+
+func testLegacyZones() {
+	var (
+		rec *dnstest.Recorder
+		t   *handlerTestDriver
+	)
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	})
+
+	When("a legacy zone is configured", func() {
+		BeforeEach(func() {
+			t.lh.LegacyZones = []string{lighthouse.DefaultLegacyZone}
+		})
+
+		It("should answer an A query for the legacy zone as for the current zone", func() {
+			for _, zone := range []string{"clusterset.local.", lighthouse.DefaultLegacyZone} {
+				qname := fmt.Sprintf("%s.%s.svc.%s", service1, namespace1, zone)
+				t.executeTestCase(dnstest.NewRecorder(&test.ResponseWriter{}), test.Case{
+					Qname: qname,
+					Qtype: dns.TypeA,
+					Rcode: dns.RcodeSuccess,
+					Answer: []dns.RR{
+						test.A(fmt.Sprintf("%s    5    IN    A    %s", qname, serviceIP)),
+					},
+				})
+			}
+		})
+
+		It("should answer an SRV query with targets in the legacy zone", func() {
+			qname := fmt.Sprintf("%s.%s.svc.%s", service1, namespace1, lighthouse.DefaultLegacyZone)
+			t.executeTestCase(rec, test.Case{
+				Qname: qname,
+				Qtype: dns.TypeSRV,
+				Rcode: dns.RcodeSuccess,
+				Answer: []dns.RR{
+					test.SRV(fmt.Sprintf("%s    5    IN    SRV 0 50 %d %s", qname, portNumber1, qname)),
+				},
+			})
+		})
+	})
+
+	When("a legacy zone isn't configured", func() {
+		It("should not answer a query for the legacy zone", func() {
+			t.executeTestCase(rec, test.Case{
+				Qname: fmt.Sprintf("%s.%s.svc.%s", service1, namespace1, lighthouse.DefaultLegacyZone),
+				Qtype: dns.TypeA,
+				Rcode: dns.RcodeNotZone,
+			})
+		})
+	})
+}
+
+func testTruncateOversizedHeadless() {
+	const numEndpoints = 60
+
+	var t *handlerTestDriver
+
+	qname := fmt.Sprintf("%s.%s.svc.clusterset.local.", service1, namespace1)
+
+	query := func(w *test.ResponseWriter, udpSize uint16) *dns.Msg {
+		msg := test.Case{Qname: qname, Qtype: dns.TypeA}.Msg()
+		if udpSize > 0 {
+			msg.SetEdns0(udpSize, false)
+		}
+
+		rec := dnstest.NewRecorder(w)
+		code, err := t.lh.ServeDNS(context.TODO(), rec, msg)
+		Expect(err).To(Succeed())
+		Expect(code).To(Equal(dns.RcodeSuccess))
+
+		return rec.Msg
+	}
+
+	BeforeEach(func() {
+		t = newHandlerTestDriver()
+		t.mockCs.clusterStatusMap[clusterID] = true
+		t.mockEs.endpointStatusMap[clusterID] = true
+		t.lh.ServiceImports = serviceimport.NewMap(clusterID)
+		t.lh.EndpointSlices = endpointslice.NewMap()
+
+		hostNames := make([]string, numEndpoints)
+		ips := make([]string, numEndpoints)
+
+		for i := range ips {
+			hostNames[i] = fmt.Sprintf("host%d", i)
+			ips[i] = fmt.Sprintf("10.0.0.%d", i+1)
+		}
+
+		t.lh.ServiceImports.Put(newServiceImport(namespace1, service1, clusterID, "", portName1, portNumber1, protocol1,
+			mcsv1a1.Headless))
+		t.lh.EndpointSlices.Put(newEndpointSlice(namespace1, service1, clusterID, portName1, hostNames, ips, portNumber1,
+			protocol1))
+	})
+
+	When("truncation of oversized headless answers is enabled", func() {
+		BeforeEach(func() {
+			t.lh.TruncateOversizedHeadless = true
+		})
+
+		It("should set the TC bit without records over UDP", func() {
+			msg := query(&test.ResponseWriter{}, 0)
+			Expect(msg.Truncated).To(BeTrue())
+			Expect(msg.Answer).To(BeEmpty())
+		})
+
+		It("should return all the records over TCP", func() {
+			msg := query(&test.ResponseWriter{TCP: true}, 0)
+			Expect(msg.Truncated).To(BeFalse())
+			Expect(msg.Answer).To(HaveLen(numEndpoints))
+		})
+
+		It("should return all the records over UDP if they fit in the client's EDNS0 UDP size", func() {
+			msg := query(&test.ResponseWriter{}, 4096)
+			Expect(msg.Truncated).To(BeFalse())
+			Expect(msg.Answer).To(HaveLen(numEndpoints))
+		})
+	})
+
+	When("truncation of oversized headless answers isn't enabled", func() {
+		It("should return all the records over UDP", func() {
+			msg := query(&test.ResponseWriter{}, 0)
+			Expect(msg.Truncated).To(BeFalse())
+			Expect(msg.Answer).To(HaveLen(numEndpoints))
+		})
+	})
+}
+
+type handlerTestDriver struct {
+	mockCs *MockClusterStatus
+	mockEs *MockEndpointStatus
+	mockLs *MockLocalServices
+	lh     *lighthouse.Lighthouse
+}
+
+func newHandlerTestDriver() *handlerTestDriver {
+	t := &handlerTestDriver{
+		mockCs: NewMockClusterStatus(),
+		mockEs: NewMockEndpointStatus(),
+		mockLs: NewMockLocalServices(),
+	}
+
+	t.lh = &lighthouse.Lighthouse{
+		Zones:           []string{"clusterset.local."},
+		ServiceImports:  setupServiceImportMap(),
+		EndpointSlices:  setupEndpointSliceMap(),
+		ClusterStatus:   t.mockCs,
+		EndpointsStatus: t.mockEs,
+		LocalServices:   t.mockLs,
+		TTL:             uint32(5),
+	}
+
+	return t
+}
+
+// nolint:gocritic // (hugeParam) It's fine to pass 'tc' by value here.
+func (t *handlerTestDriver) executeTestCase(rec *dnstest.Recorder, tc test.Case) {
+	code, err := t.lh.ServeDNS(context.TODO(), rec, tc.Msg())
+
+	Expect(code).Should(Equal(tc.Rcode))
+
+	if tc.Rcode == dns.RcodeSuccess {
+		Expect(err).To(Succeed())
+		Expect(test.SortAndCheck(rec.Msg, tc)).To(Succeed())
+	} else {
+		Expect(err).To(HaveOccurred())
+	}
+}
+
+func (t *handlerTestDriver) queryAWithSession(qname, sessionID string) string {
+	msg := test.Case{Qname: qname, Qtype: dns.TypeA}.Msg()
+
+	if sessionID != "" {
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		opt := msg.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: lighthouse.SessionAffinityOptionCode, Data: []byte(sessionID)})
+	}
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	code, err := t.lh.ServeDNS(context.TODO(), rec, msg)
+	Expect(err).To(Succeed())
+	Expect(code).To(Equal(dns.RcodeSuccess))
+	Expect(rec.Msg.Answer).To(HaveLen(1))
+
+	return rec.Msg.Answer[0].(*dns.A).A.String()
 }
 
 func setupServiceImportMap() *serviceimport.Map {
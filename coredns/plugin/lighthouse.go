@@ -20,18 +20,24 @@ package lighthouse
 
 import (
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/submariner-io/lighthouse/coredns/endpointslice"
 	"github.com/submariner-io/lighthouse/coredns/serviceimport"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 const (
 	Svc        = "svc"
 	Pod        = "pod"
 	defaultTTL = uint32(5)
+
+	// DefaultLegacyZone is the zone served by older Lighthouse versions.
+	DefaultLegacyZone = "supercluster.local."
 )
 
 var errInvalidRequest = errors.New("invalid query name")
@@ -50,8 +56,50 @@ type Lighthouse struct {
 	ClusterStatus   ClusterStatus
 	EndpointsStatus EndpointsStatus
 	LocalServices   LocalServices
+	// LegacyZones are zones, such as DefaultLegacyZone, that are answered as aliases of Zones so clients still using
+	// names from an older Lighthouse version keep working during a migration. Queries for them are counted in the
+	// ServiceDiscoveryLegacyZoneQueryCounterName metric.
+	LegacyZones []string
+	// LogSampleRate is the fraction of answered queries, in the range [0, 1], whose resolution details are logged.
+	LogSampleRate float64
+	// MaxEndpointsPerCluster, if non-zero, is the maximum number of endpoints each cluster contributes to a headless
+	// service answer. The endpoints taken from a cluster are rotated across queries.
+	MaxEndpointsPerCluster int
+	// NodeResolver, if set, is used to prefer the local cluster's endpoints on the querying client's node in headless
+	// service answers.
+	NodeResolver NodeResolver
+	// TruncateOversizedHeadless, if true, responds to a UDP query for a headless service whose answer exceeds the
+	// client's UDP message size with the TC bit set and no records so the client retries over TCP and gets all of them.
+	TruncateOversizedHeadless bool
+	// SortAnswers, if true, orders the records in each answer by IP so responses are reproducible. It is intended for
+	// testing and debugging only - it doesn't affect which records are selected but defeats client-side load spreading
+	// that relies on the answer order.
+	SortAnswers bool
+	// RecordLastQuery, if true, records the time each known service was last queried in the
+	// ServiceDiscoveryLastQueryName metric.
+	RecordLastQuery bool
+	// ServiceAggregates, if set, is used to serve aggregate service names backed by the union of other services.
+	ServiceAggregates ServiceAggregates
+	// MaxConcurrentAnswers, if non-zero, is the maximum number of queries whose answers are computed concurrently.
+	MaxConcurrentAnswers int
+	// OverLimitPolicy determines how a query is handled when MaxConcurrentAnswers queries are already in progress.
+	OverLimitPolicy OverLimitPolicy
+	// OverLimitQueueTimeout is the maximum time a query waits for an answer slot with the OverLimitQueue policy.
+	OverLimitQueueTimeout time.Duration
+	headlessRotation      uint32
+	answerSlots           chan struct{}
+	answerSlotsOnce       sync.Once
 }
 
+type OverLimitPolicy string
+
+const (
+	// OverLimitServFail fails queries over the concurrency limit immediately with SERVFAIL.
+	OverLimitServFail OverLimitPolicy = "servfail"
+	// OverLimitQueue queues queries over the concurrency limit for up to OverLimitQueueTimeout before failing them.
+	OverLimitQueue OverLimitPolicy = "queue"
+)
+
 type ClusterStatus interface {
 	IsConnected(clusterID string) bool
 	LocalClusterID() string
@@ -61,6 +109,14 @@ type LocalServices interface {
 	GetIP(name, namespace string) (*serviceimport.DNSRecord, bool)
 }
 
+type NodeResolver interface {
+	GetNodeName(ip string) (string, bool)
+}
+
+type ServiceAggregates interface {
+	GetServices(name, namespace string) ([]types.NamespacedName, bool)
+}
+
 type EndpointsStatus interface {
 	IsHealthy(name, namespace, clusterID string) bool
 }
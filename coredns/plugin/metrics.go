@@ -29,11 +29,21 @@ const (
 	dstSvcNameKey      = "destination_service_name"
 	dstSvcIPKey        = "destination_service_ip"
 	dstSvcNamespaceKey = "destination_service_namespace"
+	policyKey          = "policy"
+	zoneKey            = "zone"
 
-	ServiceDiscoveryQueryCounterName = "submariner_service_discovery_query"
+	ServiceDiscoveryQueryCounterName           = "submariner_service_discovery_query"
+	ServiceDiscoveryOverLimitCounterName       = "submariner_service_discovery_over_limit"
+	ServiceDiscoveryLastQueryName              = "submariner_service_discovery_last_query_timestamp_seconds"
+	ServiceDiscoveryLegacyZoneQueryCounterName = "submariner_service_discovery_legacy_zone_query"
 )
 
-var dnsQueryCounter *prometheus.GaugeVec
+var (
+	dnsQueryCounter      *prometheus.GaugeVec
+	dnsOverLimitCounter  *prometheus.CounterVec
+	dnsLastQueryGauge    *prometheus.GaugeVec
+	dnsLegacyZoneCounter *prometheus.CounterVec
+)
 
 func init() {
 	klog.Infof("Initializing dns query counter")
@@ -46,7 +56,31 @@ func init() {
 		[]string{srcClusterKey, dstClusterKey, dstSvcNameKey, dstSvcNamespaceKey, dstSvcIPKey},
 	)
 
-	prometheus.MustRegister(dnsQueryCounter)
+	dnsOverLimitCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: ServiceDiscoveryOverLimitCounterName,
+			Help: "Count DNS queries failed due to the concurrent answer limit",
+		},
+		[]string{policyKey},
+	)
+
+	dnsLastQueryGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: ServiceDiscoveryLastQueryName,
+			Help: "Time, in seconds since the epoch, that the service was last queried",
+		},
+		[]string{dstSvcNameKey, dstSvcNamespaceKey},
+	)
+
+	dnsLegacyZoneCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: ServiceDiscoveryLegacyZoneQueryCounterName,
+			Help: "Count DNS queries for legacy zones",
+		},
+		[]string{zoneKey},
+	)
+
+	prometheus.MustRegister(dnsQueryCounter, dnsOverLimitCounter, dnsLastQueryGauge, dnsLegacyZoneCounter)
 }
 
 func incDNSQueryCounter(srcCluster, dstCluster, dstSvcName, dstSvcNamespace, dstSvcIP string) {
@@ -60,3 +94,15 @@ func incDNSQueryCounter(srcCluster, dstCluster, dstSvcName, dstSvcNamespace, dst
 
 	dnsQueryCounter.With(labels).Inc()
 }
+
+func incOverLimitCounter(policy OverLimitPolicy) {
+	dnsOverLimitCounter.With(prometheus.Labels{policyKey: string(policy)}).Inc()
+}
+
+func setLastQueryTimestamp(dstSvcName, dstSvcNamespace string) {
+	dnsLastQueryGauge.With(prometheus.Labels{dstSvcNameKey: dstSvcName, dstSvcNamespaceKey: dstSvcNamespace}).SetToCurrentTime()
+}
+
+func incLegacyZoneQueryCounter(zone string) {
+	dnsLegacyZoneCounter.With(prometheus.Labels{zoneKey: zone}).Inc()
+}
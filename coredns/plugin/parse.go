@@ -43,6 +43,8 @@ type recordRequest struct {
 	namespace string
 	// A each name can be for a pod or a service, here we track what we've seen, either "pod" or "service".
 	podOrSvc string
+	// The session identifier from the EDNS0 session affinity option, if present.
+	sessionID string
 }
 
 // parseRequest parses the qname to find all the elements we need for querying lighthouse.
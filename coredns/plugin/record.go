@@ -19,8 +19,11 @@ limitations under the License.
 package lighthouse
 
 import (
+	"bytes"
 	"net"
+	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
@@ -42,6 +45,123 @@ func (lh *Lighthouse) createARecords(dnsrecords []serviceimport.DNSRecord, state
 	return records
 }
 
+func (lh *Lighthouse) createAAAARecords(dnsrecords []serviceimport.DNSRecord, state *request.Request) []dns.RR {
+	records := make([]dns.RR, 0)
+
+	for _, record := range dnsrecords {
+		dnsRecord := &dns.AAAA{Hdr: dns.RR_Header{
+			Name: state.QName(), Rrtype: dns.TypeAAAA, Class: state.QClass(),
+			Ttl: lh.TTL,
+		}, AAAA: net.ParseIP(record.IP).To16()}
+		records = append(records, dnsRecord)
+	}
+
+	return records
+}
+
+// filterRecordsByFamily returns the records whose IP is of the IPv6 family if ipv6 is true or the IPv4 family otherwise.
+func filterRecordsByFamily(dnsrecords []serviceimport.DNSRecord, ipv6 bool) []serviceimport.DNSRecord {
+	filtered := make([]serviceimport.DNSRecord, 0, len(dnsrecords))
+
+	for i := range dnsrecords {
+		ip := net.ParseIP(dnsrecords[i].IP)
+		if ip != nil && (ip.To4() == nil) == ipv6 {
+			filtered = append(filtered, dnsrecords[i])
+		}
+	}
+
+	return filtered
+}
+
+func filterRecordsByCluster(dnsrecords []serviceimport.DNSRecord, clusterID string) []serviceimport.DNSRecord {
+	filtered := make([]serviceimport.DNSRecord, 0, len(dnsrecords))
+
+	for i := range dnsrecords {
+		if dnsrecords[i].ClusterName == clusterID {
+			filtered = append(filtered, dnsrecords[i])
+		}
+	}
+
+	return filtered
+}
+
+// sortRecords orders the records by IP, then by cluster and host name.
+func sortRecords(dnsrecords []serviceimport.DNSRecord) {
+	sort.SliceStable(dnsrecords, func(i, j int) bool {
+		if c := bytes.Compare(net.ParseIP(dnsrecords[i].IP).To16(), net.ParseIP(dnsrecords[j].IP).To16()); c != 0 {
+			return c < 0
+		}
+
+		if dnsrecords[i].ClusterName != dnsrecords[j].ClusterName {
+			return dnsrecords[i].ClusterName < dnsrecords[j].ClusterName
+		}
+
+		return dnsrecords[i].HostName < dnsrecords[j].HostName
+	})
+}
+
+// preferNodeLocalRecords returns the local cluster's records on the same node as the client with the given IP, if any,
+// otherwise all the records.
+func (lh *Lighthouse) preferNodeLocalRecords(dnsrecords []serviceimport.DNSRecord, clientIP string) []serviceimport.DNSRecord {
+	nodeName, found := lh.NodeResolver.GetNodeName(clientIP)
+	if !found {
+		return dnsrecords
+	}
+
+	localClusterID := lh.ClusterStatus.LocalClusterID()
+	nodeLocal := make([]serviceimport.DNSRecord, 0, len(dnsrecords))
+
+	for i := range dnsrecords {
+		if dnsrecords[i].ClusterName == localClusterID && dnsrecords[i].NodeName == nodeName {
+			nodeLocal = append(nodeLocal, dnsrecords[i])
+		}
+	}
+
+	if len(nodeLocal) == 0 {
+		return dnsrecords
+	}
+
+	log.Debugf("Preferring endpoints on node %q for client %q", nodeName, clientIP)
+
+	return nodeLocal
+}
+
+// capRecordsPerCluster limits the number of records taken from each cluster to MaxEndpointsPerCluster so a cluster with
+// many endpoints doesn't dominate the answer. The starting offset within each cluster's records is advanced on every
+// call so all the endpoints are eventually served.
+func (lh *Lighthouse) capRecordsPerCluster(dnsrecords []serviceimport.DNSRecord) []serviceimport.DNSRecord {
+	var clusters []string
+
+	byCluster := map[string][]serviceimport.DNSRecord{}
+
+	for i := range dnsrecords {
+		name := dnsrecords[i].ClusterName
+		if _, ok := byCluster[name]; !ok {
+			clusters = append(clusters, name)
+		}
+
+		byCluster[name] = append(byCluster[name], dnsrecords[i])
+	}
+
+	offset := int(atomic.AddUint32(&lh.headlessRotation, 1) - 1)
+	capped := make([]serviceimport.DNSRecord, 0, len(dnsrecords))
+
+	for _, name := range clusters {
+		records := byCluster[name]
+		if len(records) <= lh.MaxEndpointsPerCluster {
+			capped = append(capped, records...)
+			continue
+		}
+
+		start := (offset * lh.MaxEndpointsPerCluster) % len(records)
+		for i := 0; i < lh.MaxEndpointsPerCluster; i++ {
+			capped = append(capped, records[(start+i)%len(records)])
+		}
+	}
+
+	return capped
+}
+
 func (lh *Lighthouse) createSRVRecords(dnsrecords []serviceimport.DNSRecord, state *request.Request, pReq *recordRequest, zone string,
 	isHeadless bool,
 ) []dns.RR {
@@ -99,8 +219,8 @@ func (lh *Lighthouse) createSRVRecords(dnsrecords []serviceimport.DNSRecord, sta
 func (lh *Lighthouse) getClusterIPForSvc(pReq *recordRequest) (*serviceimport.DNSRecord, bool) {
 	localClusterID := lh.ClusterStatus.LocalClusterID()
 
-	record, found, isLocal := lh.ServiceImports.GetIP(pReq.namespace, pReq.service, pReq.cluster, localClusterID, lh.ClusterStatus.IsConnected,
-		lh.EndpointsStatus.IsHealthy)
+	record, found, isLocal := lh.ServiceImports.GetIPForSession(pReq.namespace, pReq.service, pReq.cluster, localClusterID,
+		pReq.sessionID, lh.ClusterStatus.IsConnected, lh.EndpointsStatus.IsHealthy)
 
 	getLocal := isLocal || pReq.cluster != "" && pReq.cluster == localClusterID
 	if found && getLocal {
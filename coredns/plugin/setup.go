@@ -20,16 +20,22 @@ package lighthouse
 
 import (
 	"flag"
+	"net"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/pkg/errors"
+	"github.com/submariner-io/lighthouse/coredns/aggregate"
 	"github.com/submariner-io/lighthouse/coredns/endpointslice"
 	"github.com/submariner-io/lighthouse/coredns/gateway"
+	"github.com/submariner-io/lighthouse/coredns/node"
 	"github.com/submariner-io/lighthouse/coredns/service"
 	"github.com/submariner-io/lighthouse/coredns/serviceimport"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -74,6 +80,8 @@ func lighthouseParse(c *caddy.Controller) (*Lighthouse, error) {
 		return nil, errors.Wrap(err, "error building kubeconfig")
 	}
 
+	// Each controller waits for its cache to sync on Start so that, on a reload, the previous instance continues to
+	// serve its last-known-good state until this instance is fully initialized and takes over.
 	gwController := gateway.NewController()
 
 	err = gwController.Start(cfg)
@@ -81,37 +89,16 @@ func lighthouseParse(c *caddy.Controller) (*Lighthouse, error) {
 		return nil, errors.Wrap(err, "error starting the Gateway controller")
 	}
 
+	// The ServiceImport and EndpointSlice controllers are started once the properties are parsed as those configuring
+	// their maps, e.g. the label prefix, must be set before the maps are populated.
 	siMap := serviceimport.NewMap(gwController.LocalClusterID())
 	siController := serviceimport.NewController(siMap)
 
-	err = siController.Start(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "error starting the ServiceImport controller")
-	}
-
 	epMap := endpointslice.NewMap()
 	epController := endpointslice.NewController(epMap)
 
-	err = epController.Start(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "error starting the EndpointSlice controller")
-	}
-
 	svcController := service.NewController(gwController.LocalClusterID())
 
-	err = svcController.Start(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "error starting the Service controller")
-	}
-
-	c.OnShutdown(func() error {
-		siController.Stop()
-		epController.Stop()
-		gwController.Stop()
-		svcController.Stop()
-		return nil
-	})
-
 	lh := &Lighthouse{
 		TTL: defaultTTL, ServiceImports: siMap, ClusterStatus: gwController, EndpointSlices: epMap,
 		EndpointsStatus: epController, LocalServices: svcController,
@@ -134,6 +121,8 @@ func lighthouseParse(c *caddy.Controller) (*Lighthouse, error) {
 			switch c.Val() {
 			case "fallthrough":
 				lh.Fall.SetZonesFromArgs(c.RemainingArgs())
+			case "legacy_zones":
+				lh.LegacyZones = parseLegacyZones(c)
 			case "ttl":
 				t, err := parseTTL(c)
 				if err != nil {
@@ -141,6 +130,111 @@ func lighthouseParse(c *caddy.Controller) (*Lighthouse, error) {
 				}
 
 				lh.TTL = t
+			case "log_sample_rate":
+				r, err := parseLogSampleRate(c)
+				if err != nil {
+					return nil, err
+				}
+
+				lh.LogSampleRate = r
+			case "max_endpoints_per_cluster":
+				n, err := parseMaxEndpointsPerCluster(c)
+				if err != nil {
+					return nil, err
+				}
+
+				lh.MaxEndpointsPerCluster = n
+			case "drain_window":
+				d, err := parseDrainWindow(c)
+				if err != nil {
+					return nil, err
+				}
+
+				epMap.SetDrainWindow(d)
+			case "label_prefix":
+				prefix, err := parseLabelPrefix(c)
+				if err != nil {
+					return nil, err
+				}
+
+				siMap.SetLabelPrefix(prefix)
+				epMap.SetLabelPrefix(prefix)
+			case "readiness_hysteresis":
+				minReady, minNotReady, err := parseReadinessHysteresis(c)
+				if err != nil {
+					return nil, err
+				}
+
+				epMap.SetReadinessHysteresis(minReady, minNotReady)
+			case "max_concurrent_answers":
+				err := parseMaxConcurrentAnswers(c, lh)
+				if err != nil {
+					return nil, err
+				}
+			case "node_local":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+				}
+
+				nodeController := node.NewController()
+
+				err = nodeController.Start(cfg)
+				if err != nil {
+					return nil, errors.Wrap(err, "error starting the Node controller")
+				}
+
+				c.OnShutdown(func() error {
+					nodeController.Stop()
+					return nil
+				})
+
+				lh.NodeResolver = nodeController
+			case "service_aggregates":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+				}
+
+				aggregateController := aggregate.NewController()
+
+				err = aggregateController.Start(cfg)
+				if err != nil {
+					return nil, errors.Wrap(err, "error starting the ServiceAggregate controller")
+				}
+
+				c.OnShutdown(func() error {
+					aggregateController.Stop()
+					return nil
+				})
+
+				lh.ServiceAggregates = aggregateController
+			case "truncate_oversized_headless":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+				}
+
+				lh.TruncateOversizedHeadless = true
+			case "sort_answers":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+				}
+
+				log.Warning("sort_answers is enabled - answers are ordered for testing and debugging and shouldn't be relied " +
+					"on for load balancing in production")
+
+				lh.SortAnswers = true
+			case "record_last_query":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+				}
+
+				lh.RecordLastQuery = true
+			case "dump_address":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+				}
+
+				startDumpServer(c, lh, args[0])
 			default:
 				if c.Val() != "}" {
 					return nil, c.Errf("unknown property '%s'", c.Val()) // nolint:wrapcheck // No need to wrap this.
@@ -149,9 +243,46 @@ func lighthouseParse(c *caddy.Controller) (*Lighthouse, error) {
 		}
 	}
 
+	err = siController.Start(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting the ServiceImport controller")
+	}
+
+	err = epController.Start(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting the EndpointSlice controller")
+	}
+
+	err = svcController.Start(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting the Service controller")
+	}
+
+	c.OnShutdown(func() error {
+		siController.Stop()
+		epController.Stop()
+		gwController.Stop()
+		svcController.Stop()
+		return nil
+	})
+
 	return lh, nil
 }
 
+// parseLegacyZones returns the normalized legacy zones specified as arguments or DefaultLegacyZone if none are.
+func parseLegacyZones(c *caddy.Controller) []string {
+	zones := c.RemainingArgs()
+	if len(zones) == 0 {
+		zones = []string{DefaultLegacyZone}
+	}
+
+	for i, str := range zones {
+		zones[i] = plugin.Host(str).Normalize()
+	}
+
+	return zones
+}
+
 func parseTTL(c *caddy.Controller) (uint32, error) {
 	// Refer: https://github.com/coredns/coredns/blob/master/plugin/kubernetes/setup.go
 	args := c.RemainingArgs()
@@ -171,6 +302,177 @@ func parseTTL(c *caddy.Controller) (uint32, error) {
 	return uint32(t), nil
 }
 
+func parseLogSampleRate(c *caddy.Controller) (float64, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+	}
+
+	r, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "error parsing log_sample_rate")
+	}
+
+	if r < 0 || r > 1 {
+		return 0, c.Errf("log_sample_rate must be in range [0, 1]: %v", r) // nolint:wrapcheck // No need to wrap this.
+	}
+
+	return r, nil
+}
+
+func parseMaxEndpointsPerCluster(c *caddy.Controller) (int, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, errors.Wrap(err, "error parsing max_endpoints_per_cluster")
+	}
+
+	if n < 1 {
+		return 0, c.Errf("max_endpoints_per_cluster must be greater than 0: %d", n) // nolint:wrapcheck // No need to wrap this.
+	}
+
+	return n, nil
+}
+
+// parseMaxConcurrentAnswers parses "max_concurrent_answers LIMIT [servfail | queue TIMEOUT]".
+func parseMaxConcurrentAnswers(c *caddy.Controller, lh *Lighthouse) error {
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errors.Wrap(err, "error parsing max_concurrent_answers")
+	}
+
+	if n < 1 {
+		return c.Errf("max_concurrent_answers must be greater than 0: %d", n) // nolint:wrapcheck // No need to wrap this.
+	}
+
+	lh.MaxConcurrentAnswers = n
+	lh.OverLimitPolicy = OverLimitServFail
+
+	if len(args) == 1 {
+		return nil
+	}
+
+	switch OverLimitPolicy(args[1]) {
+	case OverLimitServFail:
+		if len(args) != 2 {
+			return c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+		}
+	case OverLimitQueue:
+		if len(args) != 3 {
+			return c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+		}
+
+		d, err := time.ParseDuration(args[2])
+		if err != nil {
+			return errors.Wrap(err, "error parsing max_concurrent_answers queue timeout")
+		}
+
+		if d <= 0 {
+			return c.Errf("max_concurrent_answers queue timeout must be positive: %v", d) // nolint:wrapcheck // No need to wrap this.
+		}
+
+		lh.OverLimitPolicy = OverLimitQueue
+		lh.OverLimitQueueTimeout = d
+	default:
+		return c.Errf("unknown max_concurrent_answers policy '%s'", args[1]) // nolint:wrapcheck // No need to wrap this.
+	}
+
+	return nil
+}
+
+// startDumpServer arranges for lh's service map dump to be served over HTTP on the given address while the server
+// is running.
+func startDumpServer(c *caddy.Controller, lh *Lighthouse, address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(DumpPath, lh.ServeDump)
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	c.OnStartup(func() error {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return errors.Wrapf(err, "error listening on dump_address %q", address)
+		}
+
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("Error serving the service map dump: %v", err)
+			}
+		}()
+
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		return server.Close() // nolint:wrapcheck // No need to wrap this.
+	})
+}
+
+func parseDrainWindow(c *caddy.Controller) (time.Duration, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+	}
+
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return 0, errors.Wrap(err, "error parsing drain_window")
+	}
+
+	if d < 0 {
+		return 0, c.Errf("drain_window must not be negative: %v", d) // nolint:wrapcheck // No need to wrap this.
+	}
+
+	return d, nil
+}
+
+// parseLabelPrefix returns the label prefix specified as argument, which must be the agents' LabelPrefix.
+func parseLabelPrefix(c *caddy.Controller) (string, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return "", c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+	}
+
+	if err := lhconstants.ValidateLabelPrefix(args[0]); err != nil {
+		return "", c.Errf("invalid label_prefix: %v", err) // nolint:wrapcheck // No need to wrap this.
+	}
+
+	return args[0], nil
+}
+
+func parseReadinessHysteresis(c *caddy.Controller) (time.Duration, time.Duration, error) {
+	args := c.RemainingArgs()
+	if len(args) != 2 {
+		return 0, 0, c.ArgErr() // nolint:wrapcheck // No need to wrap this.
+	}
+
+	durations := make([]time.Duration, len(args))
+
+	for i := range args {
+		d, err := time.ParseDuration(args[i])
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "error parsing readiness_hysteresis")
+		}
+
+		if d < 0 {
+			return 0, 0, c.Errf("readiness_hysteresis durations must not be negative: %v", d) // nolint:wrapcheck // No need to wrap this.
+		}
+
+		durations[i] = d
+	}
+
+	return durations[0], durations[1], nil
+}
+
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "",
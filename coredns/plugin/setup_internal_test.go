@@ -21,16 +21,29 @@ package lighthouse
 import (
 	"context"
 	"errors"
+	"os"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/pkg/fall"
+	"github.com/coredns/coredns/plugin/test"
 	"github.com/miekg/dns"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/fake"
+	"github.com/submariner-io/lighthouse/coredns/aggregate"
 	"github.com/submariner-io/lighthouse/coredns/endpointslice"
 	"github.com/submariner-io/lighthouse/coredns/gateway"
+	"github.com/submariner-io/lighthouse/coredns/node"
+	"github.com/submariner-io/lighthouse/coredns/service"
 	"github.com/submariner-io/lighthouse/coredns/serviceimport"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
@@ -38,6 +51,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	fakeKubeClient "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 	mcsClientset "sigs.k8s.io/mcs-api/pkg/client/clientset/versioned"
 	fakeMCSClientset "sigs.k8s.io/mcs-api/pkg/client/clientset/versioned/fake"
 )
@@ -73,15 +87,31 @@ var _ = Describe("Plugin setup", func() {
 		endpointslice.NewClientset = func(kubeConfig *rest.Config) (kubernetes.Interface, error) {
 			return fakeKubeClient.NewSimpleClientset(), nil
 		}
+
+		node.NewClientset = func(kubeConfig *rest.Config) (kubernetes.Interface, error) {
+			return fakeKubeClient.NewSimpleClientset(), nil
+		}
+
+		service.NewClientset = func(kubeConfig *rest.Config) (kubernetes.Interface, error) {
+			return fakeKubeClient.NewSimpleClientset(), nil
+		}
+
+		aggregate.NewClientset = func(c *rest.Config) (dynamic.Interface, error) {
+			return fakeClient.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				aggregate.ServiceAggregatesGVR: "ServiceAggregateList",
+			}), nil
+		}
 	})
 
 	AfterEach(func() {
 		gateway.NewClientset = nil
+		aggregate.NewClientset = nil
 	})
 
 	Context("Parsing correct configurations", testCorrectConfig)
 	Context("Parsing incorrect configurations", testIncorrectConfig)
 	Context("Plugin registration", testPluginRegistration)
+	Context("Reloading the configuration", testReload)
 })
 
 func testCorrectConfig() {
@@ -149,6 +179,192 @@ func testCorrectConfig() {
 		})
 	})
 
+	When("log_sample_rate argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    log_sample_rate 0.001
+            }`
+		})
+
+		It("should succeed with the log sample rate field populated correctly", func() {
+			Expect(lh.LogSampleRate).Should(Equal(0.001))
+		})
+	})
+
+	When("max_endpoints_per_cluster argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    max_endpoints_per_cluster 5
+            }`
+		})
+
+		It("should succeed with the max endpoints per cluster field populated correctly", func() {
+			Expect(lh.MaxEndpointsPerCluster).Should(Equal(5))
+		})
+	})
+
+	When("drain_window argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    drain_window 30s
+            }`
+		})
+
+		It("should succeed with the EndpointSlice map's drain window set correctly", func() {
+			Expect(lh.EndpointSlices.DrainWindow()).Should(Equal(30 * time.Second))
+		})
+	})
+
+	When("label_prefix argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    label_prefix lighthouse.example.io/
+            }`
+		})
+
+		It("should succeed with the maps' label prefix set correctly", func() {
+			Expect(lh.ServiceImports.LabelPrefix()).Should(Equal("lighthouse.example.io/"))
+			Expect(lh.EndpointSlices.LabelPrefix()).Should(Equal("lighthouse.example.io/"))
+		})
+	})
+
+	When("readiness_hysteresis argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    readiness_hysteresis 10s 30s
+            }`
+		})
+
+		It("should succeed with the EndpointSlice map's readiness hysteresis set correctly", func() {
+			minReady, minNotReady := lh.EndpointSlices.ReadinessHysteresis()
+			Expect(minReady).Should(Equal(10 * time.Second))
+			Expect(minNotReady).Should(Equal(30 * time.Second))
+		})
+	})
+
+	When("service_aggregates argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    service_aggregates
+            }`
+		})
+
+		It("should succeed with the service aggregates field populated", func() {
+			Expect(lh.ServiceAggregates).ToNot(BeNil())
+		})
+	})
+
+	When("dump_address argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    dump_address localhost:0
+            }`
+		})
+
+		It("should succeed", func() {
+			Expect(lh).ToNot(BeNil())
+		})
+	})
+
+	When("legacy_zones argument is specified without zones", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    legacy_zones
+            }`
+		})
+
+		It("should succeed with the default legacy zone", func() {
+			Expect(lh.LegacyZones).To(Equal([]string{DefaultLegacyZone}))
+		})
+	})
+
+	When("legacy_zones argument is specified with zones", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    legacy_zones old.local Other.Local.
+            }`
+		})
+
+		It("should succeed with the normalized legacy zones", func() {
+			Expect(lh.LegacyZones).To(Equal([]string{"old.local.", "other.local."}))
+		})
+	})
+
+	When("truncate_oversized_headless argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    truncate_oversized_headless
+            }`
+		})
+
+		It("should succeed with truncation of oversized headless answers enabled", func() {
+			Expect(lh.TruncateOversizedHeadless).To(BeTrue())
+		})
+	})
+
+	When("sort_answers argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    sort_answers
+            }`
+		})
+
+		It("should succeed with sorted answers enabled", func() {
+			Expect(lh.SortAnswers).To(BeTrue())
+		})
+	})
+
+	When("record_last_query argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    record_last_query
+            }`
+		})
+
+		It("should succeed with last query recording enabled", func() {
+			Expect(lh.RecordLastQuery).To(BeTrue())
+		})
+	})
+
+	When("node_local argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    node_local
+            }`
+		})
+
+		It("should succeed with the node resolver field populated", func() {
+			Expect(lh.NodeResolver).ToNot(BeNil())
+		})
+	})
+
+	When("max_concurrent_answers argument is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    max_concurrent_answers 100
+            }`
+		})
+
+		It("should succeed with the servfail over-limit policy by default", func() {
+			Expect(lh.MaxConcurrentAnswers).Should(Equal(100))
+			Expect(lh.OverLimitPolicy).Should(Equal(OverLimitServFail))
+		})
+	})
+
+	When("max_concurrent_answers argument is specified with the queue policy", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+			    max_concurrent_answers 100 queue 50ms
+            }`
+		})
+
+		It("should succeed with the over-limit fields populated correctly", func() {
+			Expect(lh.MaxConcurrentAnswers).Should(Equal(100))
+			Expect(lh.OverLimitPolicy).Should(Equal(OverLimitQueue))
+			Expect(lh.OverLimitQueueTimeout).Should(Equal(50 * time.Millisecond))
+		})
+	})
+
 	It("Should handle missing optional fields", func() {
 		config := `lighthouse`
 		c := caddy.NewTestController("dns", config)
@@ -220,6 +436,118 @@ func testIncorrectConfig() {
 		})
 	})
 
+	When("an invalid log_sample_rate is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+                log_sample_rate 1.5
+		    } noplugin`
+
+			buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+				return &rest.Config{}, nil
+			}
+		})
+
+		It("should return an appropriate plugin error", func() {
+			verifyPluginError(setupErr, "log_sample_rate must be in range [0, 1]: 1.5")
+		})
+	})
+
+	When("a non-numeric log_sample_rate is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+                log_sample_rate often
+		    } noplugin`
+
+			buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+				return &rest.Config{}, nil
+			}
+		})
+
+		It("should return an appropriate plugin error", func() {
+			verifyPluginError(setupErr, "error parsing log_sample_rate")
+		})
+	})
+
+	When("an invalid max_endpoints_per_cluster is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+                max_endpoints_per_cluster 0
+		    } noplugin`
+
+			buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+				return &rest.Config{}, nil
+			}
+		})
+
+		It("should return an appropriate plugin error", func() {
+			verifyPluginError(setupErr, "max_endpoints_per_cluster must be greater than 0: 0")
+		})
+	})
+
+	When("an invalid drain_window is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+                drain_window soon
+		    } noplugin`
+
+			buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+				return &rest.Config{}, nil
+			}
+		})
+
+		It("should return an appropriate plugin error", func() {
+			verifyPluginError(setupErr, "error parsing drain_window")
+		})
+	})
+
+	When("an invalid label_prefix is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+                label_prefix lighthouse.example.io
+		    } noplugin`
+
+			buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+				return &rest.Config{}, nil
+			}
+		})
+
+		It("should return an appropriate plugin error", func() {
+			verifyPluginError(setupErr, "invalid label_prefix")
+		})
+	})
+
+	When("a negative readiness_hysteresis duration is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+                readiness_hysteresis 10s -5s
+		    } noplugin`
+
+			buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+				return &rest.Config{}, nil
+			}
+		})
+
+		It("should return an appropriate plugin error", func() {
+			verifyPluginError(setupErr, "readiness_hysteresis durations must not be negative: -5s")
+		})
+	})
+
+	When("an invalid max_concurrent_answers policy is specified", func() {
+		BeforeEach(func() {
+			config = `lighthouse {
+                max_concurrent_answers 100 drop
+		    } noplugin`
+
+			buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+				return &rest.Config{}, nil
+			}
+		})
+
+		It("should return an appropriate plugin error", func() {
+			verifyPluginError(setupErr, "unknown max_concurrent_answers policy 'drop'")
+		})
+	})
+
 	When("building the kubeconfig fails", func() {
 		BeforeEach(func() {
 			config = PluginName
@@ -263,3 +591,157 @@ func verifyPluginError(err error, str string) {
 	Expect(err.Error()).To(HavePrefix("plugin/lighthouse"))
 	Expect(err.Error()).To(ContainSubstring(str))
 }
+
+func testReload() {
+	const (
+		namespace       = "namespace1"
+		clusterIPSvc    = "service1"
+		headlessSvc     = "service2"
+		localClusterID  = "cluster1"
+		clusterIP       = "100.96.156.101"
+		endpointIP      = "100.96.157.101"
+		clusterIDEnvVar = "SUBMARINER_CLUSTERID"
+	)
+
+	var (
+		kubeObjects []runtime.Object
+		mcsObjects  []runtime.Object
+		labelPrefix string
+	)
+
+	newServiceImport := func(name string, siType mcsv1a1.ServiceImportType, ips ...string) *mcsv1a1.ServiceImport {
+		return &mcsv1a1.ServiceImport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "-" + namespace + "-" + localClusterID,
+				Namespace: "submariner-operator",
+				Annotations: map[string]string{
+					"origin-name":      name,
+					"origin-namespace": namespace,
+				},
+				Labels: map[string]string{
+					lhconstants.WithLabelPrefix(labelPrefix, lhconstants.LighthouseLabelSourceCluster): localClusterID,
+				},
+			},
+			Spec: mcsv1a1.ServiceImportSpec{Type: siType, IPs: ips},
+		}
+	}
+
+	newEndpointSlice := func(name string) *discovery.EndpointSlice {
+		return &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "-" + localClusterID,
+				Namespace: namespace,
+				Labels: map[string]string{
+					discovery.LabelManagedBy:          lhconstants.LabelValueManagedBy,
+					lhconstants.MCSLabelSourceCluster: localClusterID,
+					lhconstants.MCSLabelServiceName:   name,
+					lhconstants.WithLabelPrefix(labelPrefix, lhconstants.LabelSourceNamespace): namespace,
+				},
+			},
+			AddressType: discovery.AddressTypeIPv4,
+			Endpoints:   []discovery.Endpoint{{Addresses: []string{endpointIP}}},
+		}
+	}
+
+	BeforeEach(func() {
+		buildKubeConfigFunc = func(masterUrl, kubeconfigPath string) (*rest.Config, error) {
+			return &rest.Config{}, nil
+		}
+
+		os.Setenv(clusterIDEnvVar, localClusterID)
+
+		labelPrefix = ""
+		kubeObjects = []runtime.Object{
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterIPSvc, Namespace: namespace},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: clusterIP},
+			},
+			newEndpointSlice(clusterIPSvc),
+			newEndpointSlice(headlessSvc),
+		}
+
+		mcsObjects = []runtime.Object{
+			newServiceImport(clusterIPSvc, mcsv1a1.ClusterSetIP, clusterIP),
+			newServiceImport(headlessSvc, mcsv1a1.Headless),
+		}
+
+		gateway.NewClientset = func(c *rest.Config) (dynamic.Interface, error) {
+			dynClient := fakeClient.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				{Group: "submariner.io", Version: "v1", Resource: "gateways"}: "GatewayList",
+			})
+			fake.NewFailingReactorForResource(&dynClient.Fake, "gateways").SetFailOnList(
+				apierrors.NewNotFound(schema.GroupResource{}, ""))
+
+			return dynClient, nil
+		}
+
+		serviceimport.NewClientset = func(kubeConfig *rest.Config) (mcsClientset.Interface, error) {
+			return fakeMCSClientset.NewSimpleClientset(mcsObjects...), nil
+		}
+
+		newKubeClient := func(kubeConfig *rest.Config) (kubernetes.Interface, error) {
+			return fakeKubeClient.NewSimpleClientset(kubeObjects...), nil
+		}
+
+		endpointslice.NewClientset = newKubeClient
+		service.NewClientset = newKubeClient
+	})
+
+	AfterEach(func() {
+		os.Unsetenv(clusterIDEnvVar)
+	})
+
+	query := func(lh *Lighthouse, name string) *dns.Msg {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		m := new(dns.Msg)
+		m.SetQuestion(name+"."+namespace+".svc.clusterset.local.", dns.TypeA)
+
+		rcode, err := lh.ServeDNS(context.TODO(), rec, m)
+		Expect(err).To(Succeed())
+		Expect(rcode).To(Equal(dns.RcodeSuccess))
+		Expect(rec.Msg).ToNot(BeNil())
+
+		return rec.Msg
+	}
+
+	It("should answer queries for existing services as soon as the new configuration takes over", func() {
+		for _, config := range []string{`lighthouse clusterset.local`, `lighthouse clusterset.local {
+			    ttl 30
+            }`} {
+			lh, err := lighthouseParse(caddy.NewTestController("dns", config))
+			Expect(err).To(Succeed())
+
+			for _, name := range []string{clusterIPSvc, headlessSvc} {
+				msg := query(lh, name)
+				Expect(msg.Rcode).To(Equal(dns.RcodeSuccess))
+				Expect(msg.Answer).To(HaveLen(1), "No answer for %q", name)
+			}
+		}
+	})
+
+	When("the agents label the ServiceImports and EndpointSlices under a custom label prefix", func() {
+		BeforeEach(func() {
+			labelPrefix = "lighthouse.example.io/"
+
+			kubeObjects = []runtime.Object{kubeObjects[0], newEndpointSlice(clusterIPSvc), newEndpointSlice(headlessSvc)}
+			mcsObjects = []runtime.Object{
+				newServiceImport(clusterIPSvc, mcsv1a1.ClusterSetIP, clusterIP),
+				newServiceImport(headlessSvc, mcsv1a1.Headless),
+			}
+		})
+
+		It("should answer queries for the services with the same label prefix configured", func() {
+			lh, err := lighthouseParse(caddy.NewTestController("dns", `lighthouse clusterset.local {
+			    label_prefix lighthouse.example.io/
+            }`))
+			Expect(err).To(Succeed())
+
+			for _, name := range []string{clusterIPSvc, headlessSvc} {
+				msg := query(lh, name)
+				Expect(msg.Rcode).To(Equal(dns.RcodeSuccess))
+				Expect(msg.Answer).To(HaveLen(1), "No answer for %q", name)
+			}
+		})
+	})
+}
@@ -20,6 +20,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"github.com/submariner-io/lighthouse/coredns/serviceimport"
 
 	"github.com/pkg/errors"
@@ -35,9 +36,14 @@ import (
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
+type NewClientsetFunc func(kubeConfig *rest.Config) (kubernetes.Interface, error)
+
+// NewClientset is an indirection hook for unit tests to supply fake client sets.
+var NewClientset NewClientsetFunc
+
 type Controller struct {
 	// Indirection hook for unit tests to supply fake client sets
-	NewClientset   func(kubeConfig *rest.Config) (kubernetes.Interface, error)
+	NewClientset   NewClientsetFunc
 	svcInformer    cache.Controller
 	svcStore       cache.Store
 	stopCh         chan struct{}
@@ -46,14 +52,22 @@ type Controller struct {
 
 func NewController(localClusterID string) *Controller {
 	return &Controller{
-		NewClientset: func(c *rest.Config) (kubernetes.Interface, error) {
-			return kubernetes.NewForConfig(c) // nolint:wrapcheck // Let the caller wrap it.
-		},
+		NewClientset:   getNewClientsetFunc(),
 		stopCh:         make(chan struct{}),
 		localClusterID: localClusterID,
 	}
 }
 
+func getNewClientsetFunc() NewClientsetFunc {
+	if NewClientset != nil {
+		return NewClientset
+	}
+
+	return func(c *rest.Config) (kubernetes.Interface, error) {
+		return kubernetes.NewForConfig(c) // nolint:wrapcheck // Let the caller wrap it.
+	}
+}
+
 func (c *Controller) Start(kubeConfig *rest.Config) error {
 	klog.Infof("Starting Services Controller")
 
@@ -83,6 +97,10 @@ func (c *Controller) Start(kubeConfig *rest.Config) error {
 
 	go c.svcInformer.Run(c.stopCh)
 
+	if ok := cache.WaitForCacheSync(c.stopCh, c.svcInformer.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for informer cache to sync")
+	}
+
 	return nil
 }
 
@@ -19,11 +19,15 @@ limitations under the License.
 package serviceimport
 
 import (
+	"hash/fnv"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 
 	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
 	"github.com/submariner-io/lighthouse/pkg/loadbalancer"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
@@ -33,6 +37,9 @@ type DNSRecord struct {
 	Ports       []mcsv1a1.ServicePort
 	HostName    string
 	ClusterName string
+	NodeName    string
+	// Metadata holds the endpoint's pod labels and annotations published by the agent, if any.
+	Metadata map[string]string
 }
 
 type clusterInfo struct {
@@ -42,10 +49,12 @@ type clusterInfo struct {
 }
 
 type serviceInfo struct {
-	key        string
-	records    map[string]*clusterInfo
-	balancer   loadbalancer.Interface
-	isHeadless bool
+	key             string
+	records         map[string]*clusterInfo
+	balancer        loadbalancer.Interface
+	isHeadless      bool
+	ipFamilyPolicy  corev1.IPFamilyPolicyType
+	clusterSetLocal bool
 }
 
 func (si *serviceInfo) resetLoadBalancing() {
@@ -62,6 +71,7 @@ func (si *serviceInfo) resetLoadBalancing() {
 type Map struct {
 	svcMap         map[string]*serviceInfo
 	localClusterID string
+	labelPrefix    string
 	mutex          sync.RWMutex
 }
 
@@ -84,8 +94,55 @@ func (m *Map) selectIP(si *serviceInfo, name, namespace string, checkCluster fun
 	return nil
 }
 
+// selectIPForSession picks the available cluster with the highest rendezvous hash score for the given session ID.
+// This keeps a session pinned to the same cluster for as long as that cluster remains available while spreading
+// distinct sessions across clusters.
+func (m *Map) selectIPForSession(si *serviceInfo, name, namespace, sessionID string, checkCluster func(string) bool,
+	checkEndpoint func(string, string, string) bool,
+) *DNSRecord {
+	var (
+		selected      *clusterInfo
+		selectedScore uint64
+	)
+
+	for _, info := range si.records {
+		if !checkCluster(info.name) || !checkEndpoint(name, namespace, info.name) {
+			continue
+		}
+
+		score := sessionScore(sessionID, info.name)
+		if selected == nil || score > selectedScore || (score == selectedScore && info.name < selected.name) {
+			selected = info
+			selectedScore = score
+		}
+	}
+
+	if selected == nil {
+		return nil
+	}
+
+	return selected.record
+}
+
+func sessionScore(sessionID, clusterName string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(sessionID))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(clusterName))
+
+	return h.Sum64()
+}
+
 func (m *Map) GetIP(namespace, name, cluster, localCluster string, checkCluster func(string) bool,
 	checkEndpoint func(string, string, string) bool,
+) (record *DNSRecord, found, isLocal bool) {
+	return m.GetIPForSession(namespace, name, cluster, localCluster, "", checkCluster, checkEndpoint)
+}
+
+// GetIPForSession behaves like GetIP except that, if sessionID is non-empty, the selection among clusters is made
+// consistently for the session rather than by the load balancer.
+func (m *Map) GetIPForSession(namespace, name, cluster, localCluster, sessionID string, checkCluster func(string) bool,
+	checkEndpoint func(string, string, string) bool,
 ) (record *DNSRecord, found, isLocal bool) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -114,8 +171,17 @@ func (m *Map) GetIP(namespace, name, cluster, localCluster string, checkCluster
 		}
 	}
 
+	// A clusterset-local service is only served by the local cluster
+	if si.clusterSetLocal {
+		return nil, true, false
+	}
+
 	// Fall back to selected load balancer (weighted/RR/etc) if service is not presented in the local cluster
-	record = m.selectIP(si, name, namespace, checkCluster, checkEndpoint)
+	if sessionID != "" {
+		record = m.selectIPForSession(si, name, namespace, sessionID, checkCluster, checkEndpoint)
+	} else {
+		record = m.selectIP(si, name, namespace, checkCluster, checkEndpoint)
+	}
 
 	if record != nil {
 		return record, true, false
@@ -124,6 +190,93 @@ func (m *Map) GetIP(namespace, name, cluster, localCluster string, checkCluster
 	return nil, true, false
 }
 
+// IsClusterSetLocal returns true if the given service's answers are restricted to the local cluster.
+func (m *Map) IsClusterSetLocal(namespace, name string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	si, ok := m.svcMap[keyFunc(namespace, name)]
+
+	return ok && si.clusterSetLocal
+}
+
+// GetIPFamilyPolicy returns the IP family policy exported for the given service or an empty string if none is known.
+func (m *Map) GetIPFamilyPolicy(namespace, name string) corev1.IPFamilyPolicyType {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	si, ok := m.svcMap[keyFunc(namespace, name)]
+	if !ok {
+		return ""
+	}
+
+	return si.ipFamilyPolicy
+}
+
+// ServiceDump is a snapshot of a service's entry in the Map, used for debugging.
+type ServiceDump struct {
+	Namespace       string                    `json:"namespace"`
+	Name            string                    `json:"name"`
+	Headless        bool                      `json:"headless"`
+	ClusterSetLocal bool                      `json:"clusterSetLocal,omitempty"`
+	IPFamilyPolicy  corev1.IPFamilyPolicyType `json:"ipFamilyPolicy,omitempty"`
+	Clusters        []ClusterDump             `json:"clusters,omitempty"`
+}
+
+// ClusterDump is a snapshot of a cluster's record for a service in the Map, used for debugging.
+type ClusterDump struct {
+	Cluster string                `json:"cluster"`
+	IP      string                `json:"ip"`
+	Ports   []mcsv1a1.ServicePort `json:"ports,omitempty"`
+	Weight  int64                 `json:"weight"`
+}
+
+// Dump returns a snapshot of the Map's services, sorted by namespace and name, and their per-cluster records, sorted
+// by cluster.
+func (m *Map) Dump() []ServiceDump {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	services := make([]ServiceDump, 0, len(m.svcMap))
+
+	for _, si := range m.svcMap {
+		namespace, name := splitKey(si.key)
+
+		service := ServiceDump{
+			Namespace:       namespace,
+			Name:            name,
+			Headless:        si.isHeadless,
+			ClusterSetLocal: si.clusterSetLocal,
+			IPFamilyPolicy:  si.ipFamilyPolicy,
+		}
+
+		for _, info := range si.records {
+			service.Clusters = append(service.Clusters, ClusterDump{
+				Cluster: info.name,
+				IP:      info.record.IP,
+				Ports:   info.record.Ports,
+				Weight:  info.weight,
+			})
+		}
+
+		sort.Slice(service.Clusters, func(i, j int) bool {
+			return service.Clusters[i].Cluster < service.Clusters[j].Cluster
+		})
+
+		services = append(services, service)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Namespace != services[j].Namespace {
+			return services[i].Namespace < services[j].Namespace
+		}
+
+		return services[i].Name < services[j].Name
+	})
+
+	return services
+}
+
 func NewMap(localClusterID string) *Map {
 	return &Map{
 		svcMap:         make(map[string]*serviceInfo),
@@ -131,6 +284,22 @@ func NewMap(localClusterID string) *Map {
 	}
 }
 
+// SetLabelPrefix sets the prefix of the keys of the Lighthouse labels and annotations read from the ServiceImports,
+// which must be the agents' LabelPrefix, or lhconstants.DefaultLabelPrefix if empty. It must be set before the map is
+// populated.
+func (m *Map) SetLabelPrefix(prefix string) {
+	m.labelPrefix = prefix
+}
+
+func (m *Map) LabelPrefix() string {
+	return m.labelPrefix
+}
+
+// labelKey returns the given Lighthouse label or annotation key under the map's label prefix.
+func (m *Map) labelKey(key string) string {
+	return lhconstants.WithLabelPrefix(m.labelPrefix, key)
+}
+
 func (m *Map) Put(serviceImport *mcsv1a1.ServiceImport) {
 	if name, ok := serviceImport.Annotations["origin-name"]; ok {
 		namespace := serviceImport.Annotations["origin-namespace"]
@@ -150,8 +319,16 @@ func (m *Map) Put(serviceImport *mcsv1a1.ServiceImport) {
 			}
 		}
 
+		if policy, ok := serviceImport.Annotations[m.labelKey(lhconstants.IPFamilyPolicyAnnotation)]; ok {
+			remoteService.ipFamilyPolicy = corev1.IPFamilyPolicyType(policy)
+		}
+
+		if policy, ok := serviceImport.Annotations[m.labelKey(lhconstants.ClusterSetTrafficPolicyAnnotation)]; ok {
+			remoteService.clusterSetLocal = policy == lhconstants.ClusterSetTrafficPolicyLocal
+		}
+
 		if serviceImport.Spec.Type == mcsv1a1.ClusterSetIP {
-			clusterName := serviceImport.GetLabels()[lhconstants.LighthouseLabelSourceCluster]
+			clusterName := serviceImport.GetLabels()[m.labelKey(lhconstants.LighthouseLabelSourceCluster)]
 
 			record := &DNSRecord{
 				IP:          serviceImport.Spec.IPs[0],
@@ -216,3 +393,8 @@ func getServiceWeightFrom(si *mcsv1a1.ServiceImport, forClusterName string) int6
 func keyFunc(namespace, name string) string {
 	return namespace + "/" + name
 }
+
+func splitKey(key string) (namespace, name string) {
+	parts := strings.SplitN(key, "/", 2)
+	return parts[0], parts[1]
+}
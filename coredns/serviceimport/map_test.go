@@ -19,9 +19,13 @@ limitations under the License.
 package serviceimport_test
 
 import (
+	"fmt"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/submariner-io/lighthouse/coredns/serviceimport"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
 var _ = Describe("ServiceImport Map", func() {
@@ -182,6 +186,80 @@ var _ = Describe("ServiceImport Map", func() {
 		})
 	})
 
+	When("a clusterset-local service is present in two connected clusters", func() {
+		BeforeEach(func() {
+			for _, si := range []*mcsv1a1.ServiceImport{
+				newServiceImport(namespace1, service1, serviceIP1, clusterID1),
+				newServiceImport(namespace1, service1, serviceIP2, clusterID2),
+			} {
+				si.Annotations[lhconstants.ClusterSetTrafficPolicyAnnotation] = lhconstants.ClusterSetTrafficPolicyLocal
+				serviceImportMap.Put(si)
+			}
+		})
+
+		It("should report the service as clusterset-local", func() {
+			Expect(serviceImportMap.IsClusterSetLocal(namespace1, service1)).To(BeTrue())
+		})
+
+		When("the local cluster exports the service", func() {
+			It("should consistently return the local cluster's IP", func() {
+				for i := 0; i < 10; i++ {
+					Expect(getIPExpectFound(namespace1, service1, "", clusterID1)).To(Equal(serviceIP1))
+				}
+			})
+		})
+
+		When("the local cluster doesn't export the service", func() {
+			It("should return found with empty IP", func() {
+				for i := 0; i < 10; i++ {
+					Expect(getIPExpectFound(namespace1, service1, "", clusterID3)).To(BeEmpty())
+				}
+			})
+		})
+
+		When("the local cluster's endpoints aren't healthy", func() {
+			It("should return found with empty IP", func() {
+				endpointStatusMap[clusterID1] = false
+				Expect(getIPExpectFound(namespace1, service1, "", clusterID1)).To(BeEmpty())
+			})
+		})
+
+		When("a specific cluster is requested", func() {
+			It("should return that cluster's IP", func() {
+				Expect(getIPExpectFound(namespace1, service1, clusterID2, clusterID1)).To(Equal(serviceIP2))
+			})
+		})
+	})
+
+	When("the ServiceImports are labeled under a custom label prefix", func() {
+		const prefix = "lighthouse.example.io/"
+
+		BeforeEach(func() {
+			serviceImportMap.SetLabelPrefix(prefix)
+
+			for _, si := range []*mcsv1a1.ServiceImport{
+				newServiceImport(namespace1, service1, serviceIP1, clusterID1),
+				newServiceImport(namespace1, service1, serviceIP2, clusterID2),
+			} {
+				clusterID := si.Labels[lhconstants.LighthouseLabelSourceCluster]
+				si.Labels = map[string]string{lhconstants.WithLabelPrefix(prefix, lhconstants.LighthouseLabelSourceCluster): clusterID}
+				si.Annotations[lhconstants.WithLabelPrefix(prefix, lhconstants.ClusterSetTrafficPolicyAnnotation)] =
+					lhconstants.ClusterSetTrafficPolicyLocal
+				serviceImportMap.Put(si)
+			}
+		})
+
+		It("should read the source clusters from the prefixed label", func() {
+			Expect(getClusterIP(namespace1, service1, clusterID1)).To(Equal(serviceIP1))
+			Expect(getClusterIP(namespace1, service1, clusterID2)).To(Equal(serviceIP2))
+		})
+
+		It("should read the clusterset traffic policy from the prefixed annotation", func() {
+			Expect(serviceImportMap.IsClusterSetLocal(namespace1, service1)).To(BeTrue())
+			Expect(getIPExpectFound(namespace1, service1, "", clusterID1)).To(Equal(serviceIP1))
+		})
+	})
+
 	When("a service is present in three connected clusters", func() {
 		JustBeforeEach(func() {
 			serviceImportMap.Put(newServiceImport(namespace1, service1, serviceIP1, clusterID1))
@@ -196,6 +274,46 @@ var _ = Describe("ServiceImport Map", func() {
 			})
 		})
 
+		When("a session ID is specified", func() {
+			getIPForSession := func(sessionID string) string {
+				dnsRecord, found, _ := serviceImportMap.GetIPForSession(namespace1, service1, "", "", sessionID, checkCluster,
+					checkEndpoint)
+				Expect(found).To(BeTrue())
+				Expect(dnsRecord).ToNot(BeNil())
+
+				return dnsRecord.IP
+			}
+
+			It("should consistently return the same IP for the session", func() {
+				ip := getIPForSession("my-session")
+				for i := 0; i < 10; i++ {
+					Expect(getIPForSession("my-session")).To(Equal(ip))
+				}
+			})
+
+			It("should distribute different sessions across the clusters", func() {
+				ips := map[string]bool{}
+				for i := 0; i < 50; i++ {
+					ips[getIPForSession(fmt.Sprintf("session-%d", i))] = true
+				}
+
+				Expect(ips).To(HaveLen(3))
+			})
+
+			It("should keep sessions on their cluster when another cluster becomes unavailable", func() {
+				ip := getIPForSession("my-session")
+
+				for id, clusterIP := range map[string]string{clusterID1: serviceIP1, clusterID2: serviceIP2, clusterID3: serviceIP3} {
+					if clusterIP != ip {
+						clusterStatusMap[id] = false
+						break
+					}
+				}
+
+				Expect(getIPForSession("my-session")).To(Equal(ip))
+			})
+		})
+
 		When("specific cluster is requested", func() {
 			It("should consistently return that cluster's IPs", func() {
 				firstIP := getClusterIP(namespace1, service1, clusterID2)
@@ -22,6 +22,9 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -33,42 +36,85 @@ import (
 	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
 	corev1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	validations "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/retry"
-	"k8s.io/klog"
+	"k8s.io/klog/v2"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
 const (
 	serviceUnavailable = "ServiceUnavailable"
 	invalidServiceType = "UnsupportedServiceType"
+	invalidPodSelector = "InvalidEndpointPodSelector"
+	conflictingType    = "ConflictingType"
 	clusterIP          = "cluster-ip"
+	// invalidOriginNamespaces is the reason the ServiceExport is invalid if it lists origin namespaces that can't be
+	// exported from.
+	invalidOriginNamespaces = "InvalidOriginNamespaces"
 )
 
 type AgentConfig struct {
 	ServiceImportCounterName string
 	ServiceExportCounterName string
+	// ServiceLister, if set, is used to look up the Service backing a ServiceExport instead of the Service syncer's cache.
+	ServiceLister ServiceLister
+	// MetricsRegisterer, if set, is used to register the agent's metrics instead of the default Prometheus registerer.
+	MetricsRegisterer prometheus.Registerer
+	// EndpointFilter, if set, excludes the endpoints backed by the pods it rejects from the EndpointSlices. By default,
+	// all the endpoints are included.
+	EndpointFilter EndpointFilter
 }
 
 // nolint:gocritic // (hugeParam) This function modifies syncerConf so we don't want to pass by pointer.
 func New(spec *AgentSpecification, syncerConf broker.SyncerConfig, kubeClientSet kubernetes.Interface,
-	syncerMetricNames AgentConfig,
+	agentConfig AgentConfig,
 ) (*Controller, error) {
-	if errs := validations.IsDNS1123Label(spec.ClusterID); len(errs) > 0 {
-		return nil, errors.Errorf("%s is not a valid ClusterID %v", spec.ClusterID, errs)
+	if err := spec.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid agent specification")
+	}
+
+	if spec.ServiceIPEndpoints {
+		klog.Warningf("ServiceIPEndpoints is deprecated - set the EndpointMode to %q instead", EndpointModeGateway)
+	}
+
+	conflictPolicy := spec.ServiceTypeConflictPolicy
+	if conflictPolicy == "" {
+		conflictPolicy = FirstExporterWins
 	}
 
 	agentController := &Controller{
 		clusterID:        spec.ClusterID,
+		conflictPolicy:   conflictPolicy,
 		namespace:        spec.Namespace,
 		globalnetEnabled: spec.GlobalnetEnabled,
 		kubeClientSet:    kubeClientSet,
+		leaseName:        spec.LeaderElectionLeaseName,
+		leaseNamespace:   spec.LeaderElectionNamespace,
+		startupBackoff:   StartupBackoff(spec),
+		endpointsSynced:  map[string]map[string]mcsv1a1.ServiceExportCondition{},
+		keys:             newMetadataKeys(spec.LabelPrefix),
+	}
+
+	if len(spec.WatchNamespaces) > 0 {
+		agentController.watchNamespaces = map[string]bool{}
+		for _, namespace := range spec.WatchNamespaces {
+			agentController.watchNamespaces[namespace] = true
+		}
+	}
+
+	if agentController.leaseName == "" {
+		agentController.leaseName = DefaultLeaderElectionLeaseName
+	}
+
+	if agentController.leaseNamespace == "" {
+		agentController.leaseNamespace = spec.Namespace
 	}
 
 	_, gvr, err := util.ToUnstructuredResource(&mcsv1a1.ServiceExport{}, syncerConf.RestMapper)
@@ -81,13 +127,22 @@ func New(spec *AgentSpecification, syncerConf broker.SyncerConfig, kubeClientSet
 	syncerConf.LocalNamespace = spec.Namespace
 	syncerConf.LocalClusterID = spec.ClusterID
 
+	// The local ServiceImports are all created in the agent's namespace so, if the watched namespaces are restricted,
+	// only it is watched.
+	serviceImportNamespace := metav1.NamespaceAll
+	if len(spec.WatchNamespaces) > 0 {
+		serviceImportNamespace = spec.Namespace
+	}
+
 	syncerConf.ResourceConfigs = []broker.ResourceConfig{
 		{
-			LocalSourceNamespace: metav1.NamespaceAll,
+			LocalSourceNamespace: serviceImportNamespace,
 			LocalResourceType:    &mcsv1a1.ServiceImport{},
+			LocalTransform:       agentController.serviceImportToEndpointsSynced,
 			BrokerResourceType:   &mcsv1a1.ServiceImport{},
+			BrokerTransform:      agentController.serviceImportToEndpointsSynced,
 			SyncCounterOpts: &prometheus.GaugeOpts{
-				Name: syncerMetricNames.ServiceImportCounterName,
+				Name: agentConfig.ServiceImportCounterName,
 				Help: "Count of imported services",
 			},
 		},
@@ -99,28 +154,14 @@ func New(spec *AgentSpecification, syncerConf broker.SyncerConfig, kubeClientSet
 	}
 
 	syncerConf.LocalNamespace = metav1.NamespaceAll
-	syncerConf.ResourceConfigs = []broker.ResourceConfig{
-		{
-			LocalSourceNamespace: metav1.NamespaceAll,
-			LocalResourceType:    &discovery.EndpointSlice{},
-			LocalTransform:       agentController.filterLocalEndpointSlices,
-			LocalResourcesEquivalent: func(obj1, obj2 *unstructured.Unstructured) bool {
-				return false
-			},
-			BrokerResourceType: &discovery.EndpointSlice{},
-			BrokerResourcesEquivalent: func(obj1, obj2 *unstructured.Unstructured) bool {
-				return false
-			},
-			BrokerTransform: agentController.remoteEndpointSliceToLocal,
-		},
-	}
+	syncerConf.ResourceConfigs = agentController.endpointSliceResourceConfigs(spec.WatchNamespaces)
 
 	agentController.endpointSliceSyncer, err = broker.NewSyncer(syncerConf)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating EndpointSlice syncer")
 	}
 
-	agentController.serviceExportSyncer, err = syncer.NewResourceSyncer(&syncer.ResourceSyncerConfig{
+	agentController.serviceExportSyncer, err = newNamespacedResourceSyncer(&syncer.ResourceSyncerConfig{
 		Name:             "ServiceExport -> ServiceImport",
 		SourceClient:     syncerConf.LocalClient,
 		SourceNamespace:  metav1.NamespaceAll,
@@ -131,15 +172,15 @@ func New(spec *AgentSpecification, syncerConf broker.SyncerConfig, kubeClientSet
 		OnSuccessfulSync: agentController.onSuccessfulServiceImportSync,
 		Scheme:           syncerConf.Scheme,
 		SyncCounterOpts: &prometheus.GaugeOpts{
-			Name: syncerMetricNames.ServiceExportCounterName,
+			Name: agentConfig.ServiceExportCounterName,
 			Help: "Count of exported services",
 		},
-	})
+	}, spec.WatchNamespaces)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating ServiceExport syncer")
 	}
 
-	agentController.serviceSyncer, err = syncer.NewResourceSyncer(&syncer.ResourceSyncerConfig{
+	agentController.serviceSyncer, err = newNamespacedResourceSyncer(&syncer.ResourceSyncerConfig{
 		Name:            "Service deletion",
 		SourceClient:    syncerConf.LocalClient,
 		SourceNamespace: metav1.NamespaceAll,
@@ -148,13 +189,19 @@ func New(spec *AgentSpecification, syncerConf broker.SyncerConfig, kubeClientSet
 		ResourceType:    &corev1.Service{},
 		Transform:       agentController.serviceToRemoteServiceImport,
 		Scheme:          syncerConf.Scheme,
-	})
+	}, spec.WatchNamespaces)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating Service syncer")
 	}
 
-	agentController.serviceImportController, err = newServiceImportController(spec, agentController.serviceSyncer,
-		syncerConf.RestMapper, syncerConf.LocalClient, syncerConf.Scheme)
+	agentController.serviceLister = agentConfig.ServiceLister
+	if agentController.serviceLister == nil {
+		agentController.serviceLister = &syncerServiceLister{syncer: agentController.serviceSyncer}
+	}
+
+	agentController.serviceImportController, err = newServiceImportController(spec, agentController.serviceLister,
+		syncerConf.RestMapper, syncerConf.LocalClient, syncerConf.Scheme, kubeClientSet, agentConfig.MetricsRegisterer,
+		agentConfig.EndpointFilter, agentController.keys)
 	if err != nil {
 		return nil, err
 	}
@@ -162,11 +209,25 @@ func New(spec *AgentSpecification, syncerConf broker.SyncerConfig, kubeClientSet
 	return agentController, nil
 }
 
-func (a *Controller) Start(stopCh <-chan struct{}) error {
+// Start starts the agent's controllers, which run until the given context is done.
+func (a *Controller) Start(ctx context.Context) error {
 	defer utilruntime.HandleCrash()
 
+	stopCh := ctx.Done()
+
 	// Start the informer factories to begin populating the informer caches
-	klog.Info("Starting Agent controller")
+	klog.InfoS("Starting Agent controller", "clusterID", a.clusterID)
+
+	if err := a.awaitMCSResources(); err != nil {
+		return err
+	}
+
+	err := RetryTransientErrors(a.startupBackoff, func() error {
+		return a.reconcileClusterIDChange(ctx)
+	})
+	if err != nil {
+		return err
+	}
 
 	if err := a.serviceExportSyncer.Start(stopCh); err != nil {
 		return errors.Wrap(err, "error starting ServiceExport syncer")
@@ -184,7 +245,7 @@ func (a *Controller) Start(stopCh <-chan struct{}) error {
 		return errors.Wrap(err, "error starting ServiceImport syncer")
 	}
 
-	if err := a.serviceImportController.start(stopCh); err != nil {
+	if err := a.serviceImportController.start(ctx); err != nil {
 		return errors.Wrap(err, "error starting ServiceImport controller")
 	}
 
@@ -210,15 +271,34 @@ func (a *Controller) Start(stopCh <-chan struct{}) error {
 		})
 	})
 
-	klog.Info("Agent controller started")
+	atomic.StoreInt32(&a.ready, 1)
+
+	go func() {
+		<-stopCh
+		atomic.StoreInt32(&a.ready, 0)
+	}()
+
+	klog.InfoS("Agent controller started", "clusterID", a.clusterID)
 
 	return nil
 }
 
+// Ready returns true if the agent's controllers are started, their caches synced, and not stopped. If the agent is
+// run via RunWithLeaderElection, this is only the case for the leader.
+func (a *Controller) Ready() bool {
+	return atomic.LoadInt32(&a.ready) == 1
+}
+
+// EndpointControllers returns a snapshot of the EndpointControllers currently running for the local ServiceImports,
+// for debugging. It's safe to call concurrently with the reconciliation.
+func (a *Controller) EndpointControllers() []EndpointControllerInfo {
+	return a.serviceImportController.endpointControllerInfos()
+}
+
 func (a *Controller) serviceImportLister(transform func(si *mcsv1a1.ServiceImport) runtime.Object) []runtime.Object {
 	siList, err := a.serviceImportSyncer.ListLocalResources(&mcsv1a1.ServiceImport{})
 	if err != nil {
-		klog.Errorf("Error listing serviceImports: %v", err)
+		klog.ErrorS(err, "Error listing ServiceImports")
 		return nil
 	}
 
@@ -233,51 +313,134 @@ func (a *Controller) serviceImportLister(transform func(si *mcsv1a1.ServiceImpor
 	return retList
 }
 
+func (l *syncerServiceLister) GetService(name, namespace string) (*corev1.Service, bool, error) {
+	obj, found, err := l.syncer.GetResource(name, namespace)
+	if err != nil || !found {
+		return nil, false, err // nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	return obj.(*corev1.Service), true, nil
+}
+
 func (a *Controller) serviceExportToServiceImport(obj runtime.Object, numRequeues int, op syncer.Operation) (runtime.Object, bool) {
 	svcExport := obj.(*mcsv1a1.ServiceExport)
 
-	klog.V(log.DEBUG).Infof("ServiceExport %s/%s %sd", svcExport.Namespace, svcExport.Name, op)
+	klog.V(log.DEBUG).InfoS("ServiceExport changed", "serviceExport", klog.KObj(svcExport), "action", op)
 
 	if op == syncer.Delete {
 		return a.newServiceImport(svcExport.Name, svcExport.Namespace), false
 	}
 
-	obj, found, err := a.serviceSyncer.GetResource(svcExport.Name, svcExport.Namespace)
+	svc, found, err := a.serviceLister.GetService(svcExport.Name, svcExport.Namespace)
 	if err != nil {
 		// some other error. Log and requeue
 		a.updateExportedServiceStatus(svcExport.Name, svcExport.Namespace, corev1.ConditionUnknown, "ServiceRetrievalFailed",
 			fmt.Sprintf("Error retrieving the Service: %v", err))
-		klog.Errorf("Error retrieving Service (%s/%s): %v", svcExport.Namespace, svcExport.Name, err)
+		klog.ErrorS(err, "Error retrieving Service", "service", klog.KObj(svcExport))
 
 		return nil, true
 	}
 
 	if !found {
-		klog.V(log.DEBUG).Infof("Service to be exported (%s/%s) doesn't exist", svcExport.Namespace, svcExport.Name)
+		klog.V(log.DEBUG).InfoS("Service to be exported doesn't exist", "service", klog.KObj(svcExport))
 		a.updateExportedServiceStatus(svcExport.Name, svcExport.Namespace, corev1.ConditionFalse, serviceUnavailable,
 			"Service to be exported doesn't exist")
 
 		return nil, true
 	}
 
-	if op == syncer.Update && getLastExportConditionReason(svcExport) != serviceUnavailable {
+	conflict := findServiceExportCondition(svcExport.Status.Conditions, mcsv1a1.ServiceExportConflict)
+	conflictReported := conflict != nil && conflict.Status == corev1.ConditionTrue
+
+	originNamespaces, msg := a.originNamespacesOf(svcExport)
+	if msg != "" {
+		a.updateExportedServiceStatus(svcExport.Name, svcExport.Namespace, corev1.ConditionFalse, invalidOriginNamespaces, msg)
+		klog.ErrorS(nil, "Invalid origin namespaces", "serviceExport", klog.KObj(svcExport), "reason", msg)
+
 		return nil, false
 	}
 
-	svc := obj.(*corev1.Service)
+	validReason := getExportConditionReason(svcExport, mcsv1a1.ServiceExportValid)
+	if op == syncer.Update && validReason != serviceUnavailable && validReason != invalidOriginNamespaces &&
+		validReason != invalidPodSelector && !conflictReported && !a.originNamespacesChanged(svcExport, originNamespaces) &&
+		!a.podSelectorChanged(svcExport) {
+		return nil, false
+	}
 
 	svcType, ok := getServiceImportType(svc)
 
 	if !ok {
 		a.updateExportedServiceStatus(svcExport.Name, svcExport.Namespace, corev1.ConditionFalse, invalidServiceType,
 			fmt.Sprintf("Service of type %v not supported", svc.Spec.Type))
-		klog.Errorf("Service type %q not supported", svc.Spec.Type)
+		klog.ErrorS(nil, "Service type not supported", "service", klog.KObj(svc), "type", svc.Spec.Type)
 
 		return nil, false
 	}
 
+	if msg, conflict := a.getServiceTypeConflict(svcExport, svcType); conflict {
+		// Requeue so the export proceeds once the conflict is resolved.
+		a.updateExportedServiceCondition(svcExport.Name, svcExport.Namespace, mcsv1a1.ServiceExportConflict,
+			corev1.ConditionTrue, conflictingType, msg)
+		klog.Warningf("ServiceExport (%s/%s) conflicts with another cluster: %s", svcExport.Namespace, svcExport.Name, msg)
+
+		return nil, true
+	}
+
+	if conflictReported {
+		a.updateExportedServiceCondition(svcExport.Name, svcExport.Namespace, mcsv1a1.ServiceExportConflict,
+			corev1.ConditionFalse, "", "The service no longer conflicts with another cluster")
+	}
+
+	podSelector, hasPodSelector := svcExport.Annotations[lhconstants.EndpointPodSelectorAnnotation]
+	if hasPodSelector {
+		if _, err := labels.Parse(podSelector); err != nil {
+			a.updateExportedServiceStatus(svcExport.Name, svcExport.Namespace, corev1.ConditionFalse, invalidPodSelector,
+				fmt.Sprintf("Invalid endpoint pod selector %q: %v", podSelector, err))
+			klog.ErrorS(err, "Invalid endpoint pod selector", "serviceExport", klog.KObj(svcExport), "podSelector", podSelector)
+
+			return nil, false
+		}
+	}
+
 	serviceImport := a.newServiceImport(svcExport.Name, svcExport.Namespace)
 
+	if hasPodSelector {
+		serviceImport.Annotations[a.keys.endpointPodSelector] = podSelector
+	}
+
+	if originNamespaces != "" {
+		serviceImport.Annotations[a.keys.originNamespaces] = originNamespaces
+	}
+
+	// The EndpointsSynced condition is recorded on the ServiceImport by the ServiceImportController, not built from
+	// the ServiceExport, so it's kept as the ServiceImport is replaced.
+	if existing := a.getLocalServiceImport(svcExport); existing != nil {
+		if synced, ok := existing.Annotations[a.keys.endpointsSynced]; ok {
+			serviceImport.Annotations[a.keys.endpointsSynced] = synced
+		}
+	}
+
+	if !svcExport.CreationTimestamp.IsZero() {
+		serviceImport.Annotations[a.keys.exportTimestamp] = svcExport.CreationTimestamp.UTC().Format(time.RFC3339)
+	}
+
+	if svc.Spec.IPFamilyPolicy != nil {
+		serviceImport.Annotations[a.keys.ipFamilyPolicy] = string(*svc.Spec.IPFamilyPolicy)
+	}
+
+	if len(svc.Spec.IPFamilies) > 0 {
+		families := make([]string, len(svc.Spec.IPFamilies))
+		for i := range svc.Spec.IPFamilies {
+			families[i] = string(svc.Spec.IPFamilies[i])
+		}
+
+		serviceImport.Annotations[a.keys.ipFamilies] = strings.Join(families, ",")
+	}
+
+	if policy, ok := svc.Annotations[lhconstants.ClusterSetTrafficPolicyAnnotation]; ok {
+		serviceImport.Annotations[a.keys.clusterSetTrafficPolicy] = policy
+	}
+
 	serviceImport.Spec = mcsv1a1.ServiceImportSpec{
 		Ports:                 []mcsv1a1.ServicePort{},
 		Type:                  svcType,
@@ -296,7 +459,7 @@ func (a *Controller) serviceExportToServiceImport(obj runtime.Object, numRequeue
 		if a.globalnetEnabled {
 			ip, reason, msg := a.getGlobalIP(svc)
 			if ip == "" {
-				klog.V(log.DEBUG).Infof("Service to be exported (%s/%s) doesn't have a global IP yet", svcExport.Namespace, svcExport.Name)
+				klog.V(log.DEBUG).InfoS("Service to be exported doesn't have a global IP yet", "service", klog.KObj(svcExport))
 				// Globalnet enabled but service doesn't have globalIp yet, Update the status and requeue
 				a.updateExportedServiceStatus(svcExport.Name, svcExport.Namespace, corev1.ConditionFalse, reason, msg)
 
@@ -318,15 +481,142 @@ func (a *Controller) serviceExportToServiceImport(obj runtime.Object, numRequeue
 	a.updateExportedServiceStatus(svcExport.Name, svcExport.Namespace, corev1.ConditionFalse, "AwaitingSync",
 		"Awaiting sync of the ServiceImport to the broker")
 
-	klog.V(log.DEBUG).Infof("Returning ServiceImport: %#v", serviceImport)
+	klog.V(log.DEBUG).InfoS("Returning ServiceImport", "serviceImport", serviceImport)
 
 	return serviceImport, false
 }
 
-func getLastExportConditionReason(svcExport *mcsv1a1.ServiceExport) string {
-	numCond := len(svcExport.Status.Conditions)
-	if numCond > 0 && svcExport.Status.Conditions[numCond-1].Reason != nil {
-		return *svcExport.Status.Conditions[numCond-1].Reason
+// originNamespacesOf returns the namespaces of the Services backing the given ServiceExport's ServiceImport, as set in
+// its OriginNamespacesAnnotation, comma-separated, with the ServiceExport's namespace first, or empty if it isn't
+// annotated. If a namespace is invalid or isn't watched, it instead returns a message describing why.
+func (a *Controller) originNamespacesOf(svcExport *mcsv1a1.ServiceExport) (string, string) {
+	list, ok := svcExport.Annotations[lhconstants.OriginNamespacesAnnotation]
+	if !ok {
+		return "", ""
+	}
+
+	namespaces := []string{svcExport.Namespace}
+	seen := map[string]bool{svcExport.Namespace: true}
+
+	for _, namespace := range strings.Split(list, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return "", fmt.Sprintf("Invalid origin namespace %q: %s", namespace, strings.Join(errs, ", "))
+		}
+
+		if a.watchNamespaces != nil && !a.watchNamespaces[namespace] {
+			return "", fmt.Sprintf("The origin namespace %q isn't watched", namespace)
+		}
+
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+
+	return strings.Join(namespaces, ","), ""
+}
+
+// originNamespacesChanged returns whether the given origin namespaces of the given ServiceExport differ from those of
+// its existing ServiceImport, which is then rebuilt to apply them.
+func (a *Controller) originNamespacesChanged(svcExport *mcsv1a1.ServiceExport, originNamespaces string) bool {
+	serviceImport := a.getLocalServiceImport(svcExport)
+
+	return serviceImport != nil && serviceImport.Annotations[a.keys.originNamespaces] != originNamespaces
+}
+
+// podSelectorChanged returns whether the endpoint pod selector of the given ServiceExport differs from that of its
+// existing ServiceImport, which is then rebuilt to apply it.
+func (a *Controller) podSelectorChanged(svcExport *mcsv1a1.ServiceExport) bool {
+	serviceImport := a.getLocalServiceImport(svcExport)
+
+	return serviceImport != nil &&
+		serviceImport.Annotations[a.keys.endpointPodSelector] != svcExport.Annotations[lhconstants.EndpointPodSelectorAnnotation]
+}
+
+// getLocalServiceImport returns the local ServiceImport generated from the given ServiceExport or nil if there's none.
+func (a *Controller) getLocalServiceImport(svcExport *mcsv1a1.ServiceExport) *mcsv1a1.ServiceImport {
+	obj, found, err := a.serviceImportSyncer.GetLocalResource(a.getObjectNameWithClusterID(svcExport.Name, svcExport.Namespace),
+		a.namespace, &mcsv1a1.ServiceImport{})
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving ServiceImport for ServiceExport", "serviceExport", klog.KObj(svcExport))
+		return nil
+	}
+
+	if !found {
+		return nil
+	}
+
+	return obj.(*mcsv1a1.ServiceImport)
+}
+
+// getServiceTypeConflict checks the ServiceImports exported by the other clusters for the given ServiceExport's
+// service and, if one has a different type that takes precedence over svcType under the configured policy, returns a
+// message describing the conflict.
+func (a *Controller) getServiceTypeConflict(svcExport *mcsv1a1.ServiceExport, svcType mcsv1a1.ServiceImportType) (string, bool) {
+	siList, err := a.serviceImportSyncer.ListLocalResources(&mcsv1a1.ServiceImport{})
+	if err != nil {
+		klog.ErrorS(err, "Error listing ServiceImports")
+		return "", false
+	}
+
+	for _, obj := range siList {
+		si := obj.(*mcsv1a1.ServiceImport)
+
+		otherCluster := si.GetLabels()[a.keys.sourceCluster]
+		if otherCluster == a.clusterID || si.Spec.Type == svcType ||
+			si.GetAnnotations()[lhconstants.OriginName] != svcExport.Name ||
+			si.GetAnnotations()[lhconstants.OriginNamespace] != svcExport.Namespace {
+			continue
+		}
+
+		switch a.conflictPolicy {
+		case ClusterSetIPWins:
+			if si.Spec.Type == mcsv1a1.ClusterSetIP {
+				return fmt.Sprintf("The service is exported as %s by cluster %q which takes precedence over %s", si.Spec.Type,
+					otherCluster, svcType), true
+			}
+		default:
+			if exportedBefore(si, a.keys.exportTimestamp, otherCluster, svcExport.CreationTimestamp, a.clusterID) {
+				return fmt.Sprintf("The service was first exported as %s by cluster %q which takes precedence over %s",
+					si.Spec.Type, otherCluster, svcType), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// exportedBefore returns true if the given ServiceImport, exported by otherCluster, was exported before the local
+// ServiceExport created at the given timestamp. The ServiceImport's export timestamp is read from the given annotation;
+// a ServiceImport without it predates the annotation and is thus considered older.
+func exportedBefore(si *mcsv1a1.ServiceImport, timestampAnnotation, otherCluster string, created metav1.Time, localCluster string) bool {
+	var otherCreated time.Time
+
+	if ts, ok := si.GetAnnotations()[timestampAnnotation]; ok {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			klog.ErrorS(err, "Error parsing the ServiceImport annotation", "serviceImport", si.Name,
+				"annotation", timestampAnnotation)
+		} else {
+			otherCreated = t
+		}
+	}
+
+	localCreated := created.Time.Truncate(time.Second)
+	if !otherCreated.Equal(localCreated) {
+		return otherCreated.Before(localCreated)
+	}
+
+	return otherCluster < localCluster
+}
+
+func getExportConditionReason(svcExport *mcsv1a1.ServiceExport, condType mcsv1a1.ServiceExportConditionType) string {
+	condition := findServiceExportCondition(svcExport.Status.Conditions, condType)
+	if condition != nil && condition.Reason != nil {
+		return *condition.Reason
 	}
 
 	return ""
@@ -357,17 +647,22 @@ func (a *Controller) onSuccessfulServiceImportSync(synced runtime.Object, op syn
 }
 
 func (a *Controller) serviceToRemoteServiceImport(obj runtime.Object, numRequeues int, op syncer.Operation) (runtime.Object, bool) {
+	svc := obj.(*corev1.Service)
+
+	if op == syncer.Update {
+		a.serviceImportController.serviceUpdated(svc)
+		return a.serviceUpdatedToServiceImport(svc)
+	}
+
 	if op != syncer.Delete {
-		// Ignore create/update
+		// Ignore create
 		return nil, false
 	}
 
-	svc := obj.(*corev1.Service)
-
 	obj, found, err := a.serviceExportSyncer.GetResource(svc.Name, svc.Namespace)
 	if err != nil {
 		// some other error. Log and requeue
-		klog.Errorf("Error retrieving ServiceExport for Service (%s/%s): %v", svc.Namespace, svc.Name, err)
+		klog.ErrorS(err, "Error retrieving ServiceExport for Service", "service", klog.KObj(svc))
 		return nil, true
 	}
 
@@ -387,37 +682,95 @@ func (a *Controller) serviceToRemoteServiceImport(obj runtime.Object, numRequeue
 	return serviceImport, false
 }
 
+// serviceUpdatedToServiceImport returns an updated ServiceImport if the clusterset traffic policy of an exported
+// Service, or the ports of an exported ClusterSetIP Service, have changed since its ServiceImport was created.
+func (a *Controller) serviceUpdatedToServiceImport(svc *corev1.Service) (runtime.Object, bool) {
+	obj, found, err := a.serviceImportSyncer.GetLocalResource(a.getObjectNameWithClusterID(svc.Name, svc.Namespace),
+		a.namespace, &mcsv1a1.ServiceImport{})
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving ServiceImport for Service", "service", klog.KObj(svc))
+		return nil, true
+	}
+
+	if !found {
+		return nil, false
+	}
+
+	existing := obj.(*mcsv1a1.ServiceImport)
+
+	ports := existing.Spec.Ports
+	if existing.Spec.Type == mcsv1a1.ClusterSetIP {
+		ports = a.getPortsForService(svc)
+	}
+
+	policy, hasPolicy := svc.Annotations[lhconstants.ClusterSetTrafficPolicyAnnotation]
+	existingPolicy, hadPolicy := existing.Annotations[a.keys.clusterSetTrafficPolicy]
+
+	if equality.Semantic.DeepEqual(existing.Spec.Ports, ports) && hasPolicy == hadPolicy && policy == existingPolicy {
+		return nil, false
+	}
+
+	klog.InfoS("The ports or traffic policy for exported Service changed - updating the ServiceImport", "service", klog.KObj(svc))
+
+	serviceImport := a.newServiceImport(svc.Name, svc.Namespace)
+
+	for k, v := range existing.Annotations {
+		if _, ok := serviceImport.Annotations[k]; !ok {
+			serviceImport.Annotations[k] = v
+		}
+	}
+
+	if hasPolicy {
+		serviceImport.Annotations[a.keys.clusterSetTrafficPolicy] = policy
+	} else {
+		delete(serviceImport.Annotations, a.keys.clusterSetTrafficPolicy)
+	}
+
+	serviceImport.Spec = *existing.Spec.DeepCopy()
+	serviceImport.Spec.Ports = ports
+	serviceImport.Status = *existing.Status.DeepCopy()
+
+	return serviceImport, false
+}
+
 func (a *Controller) updateExportedServiceStatus(name, namespace string, status corev1.ConditionStatus, reason, msg string) {
-	klog.V(log.DEBUG).Infof("updateExportedServiceStatus for (%s/%s) - Type: %q, Status: %q, Reason: %q, Message: %q",
-		namespace, name, mcsv1a1.ServiceExportValid, status, reason, msg)
+	a.updateExportedServiceCondition(name, namespace, mcsv1a1.ServiceExportValid, status, reason, msg)
+}
+
+func (a *Controller) updateExportedServiceCondition(name, namespace string, condType mcsv1a1.ServiceExportConditionType,
+	status corev1.ConditionStatus, reason, msg string,
+) {
+	klog.V(log.DEBUG).InfoS("updateExportedServiceStatus", "serviceExport", klog.KRef(namespace, name), "type", condType,
+		"status", status, "reason", reason, "message", msg)
+
+	now := metav1.Now()
+	a.setExportedServiceCondition(name, namespace, &mcsv1a1.ServiceExportCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: &now,
+		Reason:             &reason,
+		Message:            &msg,
+	})
+}
 
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+// setExportedServiceCondition sets the given condition on the ServiceExport with the given name and namespace, if it
+// changed, keeping its LastTransitionTime if its status didn't.
+func (a *Controller) setExportedServiceCondition(name, namespace string, exportCondition *mcsv1a1.ServiceExportCondition) {
+	retryErr := retryOnConflict(func() error {
 		toUpdate, err := a.getServiceExport(name, namespace)
 		if apierrors.IsNotFound(err) {
-			klog.Infof("ServiceExport (%s/%s) not found - unable to update status", namespace, name)
+			klog.InfoS("ServiceExport not found - unable to update status", "serviceExport", klog.KRef(namespace, name))
 			return nil
 		} else if err != nil {
 			return err
 		}
 
-		now := metav1.Now()
-		exportCondition := mcsv1a1.ServiceExportCondition{
-			Type:               mcsv1a1.ServiceExportValid,
-			Status:             status,
-			LastTransitionTime: &now,
-			Reason:             &reason,
-			Message:            &msg,
-		}
-
-		// TODO: Currently we only check for conditionType Valid. Revisit this when Conflict is supported.
-		if len(toUpdate.Status.Conditions) > 0 && serviceExportConditionEqual(&toUpdate.Status.Conditions[0], &exportCondition) {
-			klog.V(log.TRACE).Infof("Last ServiceExportCondition for (%s/%s) is equal - not updating status: %#v",
-				namespace, name, toUpdate.Status.Conditions[0])
+		if !setServiceExportCondition(&toUpdate.Status.Conditions, exportCondition) {
+			klog.V(log.TRACE).InfoS("ServiceExportCondition is equal - not updating status",
+				"serviceExport", klog.KRef(namespace, name), "condition", *exportCondition)
 			return nil
 		}
 
-		toUpdate.Status.Conditions = []mcsv1a1.ServiceExportCondition{exportCondition}
-
 		raw, err := resource.ToUnstructured(toUpdate)
 		if err != nil {
 			return errors.Wrap(err, "error converting resource")
@@ -429,7 +782,7 @@ func (a *Controller) updateExportedServiceStatus(name, namespace string, status
 	})
 
 	if retryErr != nil {
-		klog.Errorf("Error updating status for ServiceExport (%s/%s): %+v", namespace, name, retryErr)
+		klog.ErrorS(retryErr, "Error updating status for ServiceExport", "serviceExport", klog.KRef(namespace, name))
 	}
 }
 
@@ -449,6 +802,44 @@ func (a *Controller) getServiceExport(name, namespace string) (*mcsv1a1.ServiceE
 	return se, nil
 }
 
+// setServiceExportCondition sets the given condition in the given conditions, replacing the existing one of the same
+// type and leaving the others as is, as meta.SetStatusCondition does for metav1.Conditions. The LastTransitionTime of
+// an existing condition is only changed if its status changes. It returns false if the conditions are unchanged.
+func setServiceExportCondition(conditions *[]mcsv1a1.ServiceExportCondition, newCondition *mcsv1a1.ServiceExportCondition) bool {
+	existing := findServiceExportCondition(*conditions, newCondition.Type)
+	if existing == nil {
+		*conditions = append(*conditions, *newCondition)
+		return true
+	}
+
+	if serviceExportConditionEqual(existing, newCondition) {
+		return false
+	}
+
+	if existing.Status != newCondition.Status {
+		existing.LastTransitionTime = newCondition.LastTransitionTime
+	}
+
+	existing.Status = newCondition.Status
+	existing.Reason = newCondition.Reason
+	existing.Message = newCondition.Message
+
+	return true
+}
+
+// findServiceExportCondition returns the condition of the given type in the given conditions or nil if there's none.
+func findServiceExportCondition(conditions []mcsv1a1.ServiceExportCondition,
+	condType mcsv1a1.ServiceExportConditionType,
+) *mcsv1a1.ServiceExportCondition {
+	for i := range conditions {
+		if conditions[i].Type == condType {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
 func serviceExportConditionEqual(c1, c2 *mcsv1a1.ServiceExportCondition) bool {
 	return c1.Type == c2.Type && c1.Status == c2.Status && reflect.DeepEqual(c1.Reason, c2.Reason) &&
 		reflect.DeepEqual(c1.Message, c2.Message)
@@ -463,9 +854,9 @@ func (a *Controller) newServiceImport(name, namespace string) *mcsv1a1.ServiceIm
 				lhconstants.OriginNamespace: namespace,
 			},
 			Labels: map[string]string{
-				lhconstants.LighthouseLabelSourceName:    name,
-				lhconstants.LabelSourceNamespace:         namespace,
-				lhconstants.LighthouseLabelSourceCluster: a.clusterID,
+				a.keys.sourceName:      name,
+				a.keys.sourceNamespace: namespace,
+				a.keys.sourceCluster:   a.clusterID,
 			},
 		},
 	}
@@ -489,9 +880,55 @@ func (a *Controller) getObjectNameWithClusterID(name, namespace string) string {
 	return name + "-" + namespace + "-" + a.clusterID
 }
 
+// endpointSliceResourceConfigs returns the config of the EndpointSlice syncer or, if the given watched namespaces are
+// set, a config for each of them as a broker ResourceConfig has a single local namespace. The EndpointSlices from the
+// broker are only synced by the first.
+func (a *Controller) endpointSliceResourceConfigs(namespaces []string) []broker.ResourceConfig {
+	newConfig := func(namespace string, brokerTransform syncer.TransformFunc) broker.ResourceConfig {
+		return broker.ResourceConfig{
+			LocalSourceNamespace: namespace,
+			LocalResourceType:    &discovery.EndpointSlice{},
+			LocalTransform:       a.filterLocalEndpointSlices,
+			LocalResourcesEquivalent: func(obj1, obj2 *unstructured.Unstructured) bool {
+				return false
+			},
+			BrokerResourceType: &discovery.EndpointSlice{},
+			BrokerResourcesEquivalent: func(obj1, obj2 *unstructured.Unstructured) bool {
+				return false
+			},
+			BrokerTransform: brokerTransform,
+		}
+	}
+
+	if len(namespaces) == 0 {
+		return []broker.ResourceConfig{newConfig(metav1.NamespaceAll, a.remoteEndpointSliceToLocal)}
+	}
+
+	configs := []broker.ResourceConfig{}
+
+	for i, namespace := range namespaces {
+		brokerTransform := a.remoteEndpointSliceToLocal
+		if i > 0 {
+			brokerTransform = func(obj runtime.Object, numRequeues int, op syncer.Operation) (runtime.Object, bool) {
+				return nil, false
+			}
+		}
+
+		configs = append(configs, newConfig(namespace, brokerTransform))
+	}
+
+	return configs
+}
+
 func (a *Controller) remoteEndpointSliceToLocal(obj runtime.Object, numRequeues int, op syncer.Operation) (runtime.Object, bool) {
 	endpointSlice := obj.(*discovery.EndpointSlice)
-	endpointSlice.Namespace = endpointSlice.GetObjectMeta().GetLabels()[lhconstants.LabelSourceNamespace]
+	endpointSlice.Namespace = endpointSlice.GetObjectMeta().GetLabels()[a.keys.sourceNamespace]
+
+	if a.watchNamespaces != nil && !a.watchNamespaces[endpointSlice.Namespace] {
+		klog.V(log.TRACE).InfoS("Ignoring EndpointSlice for a namespace that isn't watched",
+			"endpointSlice", klog.KObj(endpointSlice))
+		return nil, false
+	}
 
 	return endpointSlice, false
 }
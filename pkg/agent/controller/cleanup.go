@@ -23,6 +23,7 @@ import (
 
 	"github.com/pkg/errors"
 	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,9 +31,15 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
+const (
+	clusterIDMarkerName = "lighthouse-agent-cluster-id"
+	clusterIDMarkerKey  = "clusterID"
+)
+
 var (
 	serviceImportGVR = schema.GroupVersionResource{
 		Group:    mcsv1a1.GroupName,
@@ -47,10 +54,10 @@ var (
 	}
 )
 
-func (a *Controller) Cleanup() error {
+func (a *Controller) Cleanup(ctx context.Context) error {
 	// Delete all ServiceImports from the local cluster skipping those in the broker namespace if the broker is on the
 	// local cluster.
-	err := deleteResources(a.serviceImportSyncer.GetLocalClient().Resource(serviceImportGVR), metav1.NamespaceAll,
+	err := deleteResources(ctx, a.serviceImportSyncer.GetLocalClient().Resource(serviceImportGVR), metav1.NamespaceAll,
 		&metav1.ListOptions{
 			FieldSelector: fields.OneTermNotEqualSelector("metadata.namespace", a.serviceImportSyncer.GetBrokerNamespace()).String(),
 		})
@@ -59,9 +66,9 @@ func (a *Controller) Cleanup() error {
 	}
 
 	// Delete all local ServiceImports from the broker.
-	err = deleteResources(a.serviceImportSyncer.GetBrokerClient().Resource(serviceImportGVR), a.serviceImportSyncer.GetBrokerNamespace(),
+	err = deleteResources(ctx, a.serviceImportSyncer.GetBrokerClient().Resource(serviceImportGVR), a.serviceImportSyncer.GetBrokerNamespace(),
 		&metav1.ListOptions{
-			LabelSelector: labels.Set(map[string]string{lhconstants.LighthouseLabelSourceCluster: a.clusterID}).String(),
+			LabelSelector: labels.Set(map[string]string{a.keys.sourceCluster: a.clusterID}).String(),
 		})
 	if err != nil {
 		return errors.Wrap(err, "error deleting remote ServiceImports")
@@ -69,7 +76,7 @@ func (a *Controller) Cleanup() error {
 
 	// Delete all EndpointSlices from the local cluster skipping those in the broker namespace if the broker is on the
 	// local cluster.
-	err = deleteResources(a.endpointSliceSyncer.GetLocalClient().Resource(endpointSliceGVR), metav1.NamespaceAll,
+	err = deleteResources(ctx, a.endpointSliceSyncer.GetLocalClient().Resource(endpointSliceGVR), metav1.NamespaceAll,
 		&metav1.ListOptions{
 			FieldSelector: fields.OneTermNotEqualSelector("metadata.namespace", a.serviceImportSyncer.GetBrokerNamespace()).String(),
 			LabelSelector: labels.Set(map[string]string{discovery.LabelManagedBy: lhconstants.LabelValueManagedBy}).String(),
@@ -79,7 +86,7 @@ func (a *Controller) Cleanup() error {
 	}
 
 	// Delete all local EndpointSlices from the broker.
-	err = deleteResources(a.endpointSliceSyncer.GetBrokerClient().Resource(endpointSliceGVR), a.endpointSliceSyncer.GetBrokerNamespace(),
+	err = deleteResources(ctx, a.endpointSliceSyncer.GetBrokerClient().Resource(endpointSliceGVR), a.endpointSliceSyncer.GetBrokerNamespace(),
 		&metav1.ListOptions{
 			LabelSelector: labels.Set(map[string]string{lhconstants.MCSLabelSourceCluster: a.clusterID}).String(),
 		})
@@ -87,14 +94,142 @@ func (a *Controller) Cleanup() error {
 	return errors.Wrap(err, "error deleting remote EndpointSlices")
 }
 
-func deleteResources(client dynamic.NamespaceableResourceInterface, ns string, options *metav1.ListOptions) error {
-	list, err := client.Namespace(ns).List(context.TODO(), *options)
+// reconcileClusterIDChange detects whether the cluster ID differs from the one persisted in the marker ConfigMap on a
+// previous run. If so, the ServiceImports and EndpointSlices labeled with the previous cluster ID are removed from the
+// local cluster and the broker - they're subsequently re-created under the new cluster ID by the syncers.
+func (a *Controller) reconcileClusterIDChange(ctx context.Context) error {
+	configMaps := a.kubeClientSet.CoreV1().ConfigMaps(a.namespace)
+
+	marker, err := configMaps.Get(ctx, clusterIDMarkerName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: clusterIDMarkerName,
+			},
+			Data: map[string]string{clusterIDMarkerKey: a.clusterID},
+		}, metav1.CreateOptions{})
+
+		return errors.Wrap(err, "error creating the cluster ID marker")
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "error retrieving the cluster ID marker")
+	}
+
+	previousID := marker.Data[clusterIDMarkerKey]
+	if previousID == a.clusterID || previousID == "" {
+		return nil
+	}
+
+	klog.InfoS("The cluster ID changed - removing the resources associated with the previous ID",
+		"previousClusterID", previousID, "clusterID", a.clusterID)
+
+	if err := a.deleteResourcesForClusterID(ctx, previousID); err != nil {
+		return err
+	}
+
+	err = retryOnConflict(func() error {
+		latest, err := configMaps.Get(ctx, clusterIDMarkerName, metav1.GetOptions{})
+		if err != nil {
+			return err // nolint:wrapcheck // Wrapped below
+		}
+
+		if latest.Data == nil {
+			latest.Data = map[string]string{}
+		}
+
+		latest.Data[clusterIDMarkerKey] = a.clusterID
+
+		_, err = configMaps.Update(ctx, latest, metav1.UpdateOptions{})
+
+		return err // nolint:wrapcheck // Wrapped below
+	})
+
+	return errors.Wrap(err, "error updating the cluster ID marker")
+}
+
+func (a *Controller) deleteResourcesForClusterID(ctx context.Context, clusterID string) error {
+	notBrokerNS := fields.OneTermNotEqualSelector("metadata.namespace", a.serviceImportSyncer.GetBrokerNamespace()).String()
+
+	err := deleteResources(ctx, a.serviceImportSyncer.GetLocalClient().Resource(serviceImportGVR), metav1.NamespaceAll,
+		&metav1.ListOptions{
+			FieldSelector: notBrokerNS,
+			LabelSelector: labels.Set(map[string]string{a.keys.sourceCluster: clusterID}).String(),
+		})
+	if err != nil {
+		return errors.Wrapf(err, "error deleting local ServiceImports for cluster ID %q", clusterID)
+	}
+
+	err = deleteResources(ctx, a.serviceImportSyncer.GetBrokerClient().Resource(serviceImportGVR), a.serviceImportSyncer.GetBrokerNamespace(),
+		&metav1.ListOptions{
+			LabelSelector: labels.Set(map[string]string{a.keys.sourceCluster: clusterID}).String(),
+		})
+	if err != nil {
+		return errors.Wrapf(err, "error deleting remote ServiceImports for cluster ID %q", clusterID)
+	}
+
+	for _, label := range []string{lhconstants.MCSLabelSourceCluster, a.keys.sourceCluster} {
+		err = deleteResources(ctx, a.endpointSliceSyncer.GetLocalClient().Resource(endpointSliceGVR), metav1.NamespaceAll,
+			&metav1.ListOptions{
+				FieldSelector: notBrokerNS,
+				LabelSelector: labels.Set(map[string]string{
+					discovery.LabelManagedBy: lhconstants.LabelValueManagedBy,
+					label:                    clusterID,
+				}).String(),
+			})
+		if err != nil {
+			return errors.Wrapf(err, "error deleting local EndpointSlices for cluster ID %q", clusterID)
+		}
+	}
+
+	err = deleteResources(ctx, a.endpointSliceSyncer.GetBrokerClient().Resource(endpointSliceGVR), a.endpointSliceSyncer.GetBrokerNamespace(),
+		&metav1.ListOptions{
+			LabelSelector: labels.Set(map[string]string{lhconstants.MCSLabelSourceCluster: clusterID}).String(),
+		})
+
+	return errors.Wrapf(err, "error deleting remote EndpointSlices for cluster ID %q", clusterID)
+}
+
+// deleteInBatches lists the resources matching the given options a page of at most batchSize at a time and deletes
+// each page's resources, with the given delete options, before listing the next, to bound the work of each request to
+// the API server.
+func deleteInBatches(ctx context.Context, client dynamic.ResourceInterface, options metav1.ListOptions,
+	deleteOptions metav1.DeleteOptions, batchSize int64,
+) error {
+	options.Limit = batchSize
+
+	for {
+		list, err := client.List(ctx, options)
+		if err != nil {
+			return err // nolint:wrapcheck // Let the caller wrap
+		}
+
+		for i := range list.Items {
+			if len(deleteOptions.DryRun) > 0 {
+				klog.InfoS("Dry run: deleting resource", "name", klog.KObj(&list.Items[i]))
+			}
+
+			err = client.Delete(ctx, list.Items[i].GetName(), deleteOptions)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err // nolint:wrapcheck // Let the caller wrap
+			}
+		}
+
+		options.Continue = list.GetContinue()
+		if options.Continue == "" {
+			return nil
+		}
+	}
+}
+
+func deleteResources(ctx context.Context, client dynamic.NamespaceableResourceInterface, ns string, options *metav1.ListOptions) error {
+	list, err := client.Namespace(ns).List(ctx, *options)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err // nolint:wrapcheck // Let the caller wrap
 	}
 
 	for i := range list.Items {
-		err = client.Namespace(list.Items[i].GetNamespace()).Delete(context.TODO(), list.Items[i].GetName(), metav1.DeleteOptions{})
+		err = client.Namespace(list.Items[i].GetNamespace()).Delete(ctx, list.Items[i].GetName(), metav1.DeleteOptions{})
 		if err != nil && !apierrors.IsNotFound(err) {
 			return err // nolint:wrapcheck // Let the caller wrap
 		}
@@ -19,6 +19,7 @@ limitations under the License.
 package controller_test
 
 import (
+	"context"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -146,7 +147,7 @@ var _ = Describe("Cleanup", func() {
 	})
 
 	It("should remove local LH ServiceImports and EndpointSlices from the remote datastore", func() {
-		Expect(t.cluster1.agentController.Cleanup()).To(Succeed())
+		Expect(t.cluster1.agentController.Cleanup(context.TODO())).To(Succeed())
 
 		test.AwaitNoResource(t.brokerServiceImportClient, existingLocalServiceImport.GetName())
 		test.AwaitNoResource(t.brokerEndpointSliceClient, existingLocalEndpointSlice.GetName())
@@ -157,7 +158,7 @@ var _ = Describe("Cleanup", func() {
 	})
 
 	It("should remove all LH ServiceImports and EndpointSlices from the local datastore", func() {
-		Expect(t.cluster1.agentController.Cleanup()).To(Succeed())
+		Expect(t.cluster1.agentController.Cleanup(context.TODO())).To(Succeed())
 
 		test.AwaitNoResource(t.cluster1.localServiceImportClient, existingLocalServiceImport.GetName())
 		test.AwaitNoResource(t.cluster1.localServiceImportClient, existingRemoteServiceImport.GetName())
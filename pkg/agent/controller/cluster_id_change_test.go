@@ -0,0 +1,243 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/fake"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakeKubeClient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/testing"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+const (
+	clusterIDMarkerName = "lighthouse-agent-cluster-id"
+	previousClusterID   = "south"
+)
+
+var _ = Describe("Cluster ID change", func() {
+	var (
+		t                   *testDriver
+		staleServiceImport  *mcsv1a1.ServiceImport
+		staleEndpointSlice  *discovery.EndpointSlice
+		remoteServiceImport *mcsv1a1.ServiceImport
+	)
+
+	BeforeEach(func() {
+		t = newTestDiver()
+
+		_, err := t.cluster1.localKubeClient.CoreV1().ConfigMaps(test.LocalNamespace).Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: clusterIDMarkerName,
+			},
+			Data: map[string]string{"clusterID": previousClusterID},
+		}, metav1.CreateOptions{})
+		Expect(err).To(Succeed())
+
+		staleServiceImport = &mcsv1a1.ServiceImport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: t.service.Name + "-" + serviceNamespace + "-" + previousClusterID,
+				Labels: map[string]string{
+					lhconstants.LighthouseLabelSourceCluster: previousClusterID,
+				},
+			},
+		}
+
+		test.CreateResource(t.cluster1.localServiceImportClient, staleServiceImport)
+		test.CreateResource(t.brokerServiceImportClient, test.SetClusterIDLabel(staleServiceImport, previousClusterID))
+
+		staleEndpointSlice = &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: t.endpoints.Name + "-" + previousClusterID,
+				Labels: map[string]string{
+					lhconstants.MCSLabelSourceCluster: previousClusterID,
+					discovery.LabelManagedBy:          lhconstants.LabelValueManagedBy,
+				},
+			},
+		}
+
+		test.CreateResource(t.cluster1.localEndpointSliceClient, staleEndpointSlice)
+		test.CreateResource(t.brokerEndpointSliceClient, test.SetClusterIDLabel(staleEndpointSlice, previousClusterID))
+
+		remoteServiceImport = &mcsv1a1.ServiceImport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "other-" + serviceNamespace + "-" + clusterID2,
+				Labels: map[string]string{
+					lhconstants.LighthouseLabelSourceCluster: clusterID2,
+				},
+			},
+		}
+
+		test.CreateResource(t.brokerServiceImportClient, test.SetClusterIDLabel(remoteServiceImport, clusterID2))
+	})
+
+	JustBeforeEach(func() {
+		t.justBeforeEach()
+		t.createService()
+		t.createEndpoints()
+		t.createServiceExport()
+	})
+
+	AfterEach(func() {
+		t.afterEach()
+	})
+
+	It("should remove the resources labeled with the previous cluster ID", func() {
+		test.AwaitNoResource(t.cluster1.localServiceImportClient, staleServiceImport.Name)
+		test.AwaitNoResource(t.brokerServiceImportClient, staleServiceImport.Name)
+		test.AwaitNoResource(t.cluster1.localEndpointSliceClient, staleEndpointSlice.Name)
+		test.AwaitNoResource(t.brokerEndpointSliceClient, staleEndpointSlice.Name)
+
+		time.Sleep(300 * time.Millisecond)
+		test.AwaitResource(t.brokerServiceImportClient, remoteServiceImport.Name)
+	})
+
+	It("should re-create the resources under the new cluster ID", func() {
+		t.awaitServiceExported(t.service.Spec.ClusterIP)
+		t.awaitEndpointSlice()
+	})
+
+	It("should update the cluster ID marker", func() {
+		marker, err := t.cluster1.localKubeClient.CoreV1().ConfigMaps(test.LocalNamespace).Get(context.TODO(),
+			clusterIDMarkerName, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+		Expect(marker.Data).To(HaveKeyWithValue("clusterID", clusterID1))
+	})
+
+	It("should create the cluster ID marker if it doesn't exist", func() {
+		marker, err := t.cluster2.localKubeClient.CoreV1().ConfigMaps(test.LocalNamespace).Get(context.TODO(),
+			clusterIDMarkerName, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+		Expect(marker.Data).To(HaveKeyWithValue("clusterID", clusterID2))
+	})
+})
+
+var _ = Describe("Startup retries", func() {
+	var (
+		t               *testDriver
+		configMapsFails *fake.FailingReactor
+	)
+
+	BeforeEach(func() {
+		t = newTestDiver()
+		t.doStart = false
+	})
+
+	JustBeforeEach(func() {
+		t.justBeforeEach()
+		Expect(t.cluster2.agentController.Start(t.ctx)).To(Succeed())
+
+		configMapsFails = fake.NewFailingReactorForResource(&t.cluster1.localKubeClient.(*fakeKubeClient.Clientset).Fake,
+			"configmaps")
+	})
+
+	AfterEach(func() {
+		t.afterEach()
+	})
+
+	When("retrieving the cluster ID marker fails transiently", func() {
+		It("should retry and start the agent controller", func() {
+			configMapsFails.SetResetOnFailure(true)
+			configMapsFails.SetFailOnGet(apierrors.NewServiceUnavailable("fake"))
+
+			Expect(t.cluster1.agentController.Start(t.ctx)).To(Succeed())
+
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+		})
+	})
+
+	When("retrieving the cluster ID marker fails for longer than the startup retry attempts", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.StartupRetryAttempts = 2
+		})
+
+		It("should fail to start the agent controller", func() {
+			configMapsFails.SetFailOnGet(apierrors.NewServiceUnavailable("fake"))
+
+			Expect(t.cluster1.agentController.Start(t.ctx)).ToNot(Succeed())
+		})
+	})
+
+	When("the multi-cluster services CRDs are installed after the agent is started", func() {
+		It("should wait for them and start the agent controller", func() {
+			fakeCS := t.cluster1.localKubeClient.(*fakeKubeClient.Clientset)
+			resources := fakeCS.Resources
+			fakeCS.Resources = nil
+
+			discoveries := 0
+			fakeCS.PrependReactor("get", "resource", func(action testing.Action) (bool, runtime.Object, error) {
+				discoveries++
+				if discoveries > 1 {
+					fakeCS.Resources = resources
+				}
+
+				return false, nil, nil
+			})
+
+			Expect(t.cluster1.agentController.Start(t.ctx)).To(Succeed())
+			Expect(discoveries).To(Equal(2))
+		})
+	})
+
+	When("the multi-cluster services CRDs aren't installed", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.StartupRetryAttempts = 1
+		})
+
+		It("should fail to start the agent controller", func() {
+			fakeCS := t.cluster1.localKubeClient.(*fakeKubeClient.Clientset)
+			fakeCS.Resources = []*metav1.APIResourceList{{
+				GroupVersion: mcsv1a1.GroupVersion.String(),
+				APIResources: []metav1.APIResource{{Name: "serviceexports"}},
+			}}
+
+			err := t.cluster1.agentController.Start(t.ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("CRDs aren't installed"))
+			Expect(err.Error()).To(ContainSubstring("serviceimports"))
+		})
+	})
+
+	When("retrieving the cluster ID marker fails with a non-transient error", func() {
+		It("should fail to start the agent controller without retrying", func() {
+			configMapsFails.SetFailOnGet(apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"},
+				clusterIDMarkerName, errors.New("fake")))
+
+			start := time.Now()
+			Expect(t.cluster1.agentController.Start(t.ctx)).ToNot(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+})
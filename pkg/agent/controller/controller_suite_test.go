@@ -32,6 +32,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/format"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/submariner-io/admiral/pkg/fake"
 	"github.com/submariner-io/admiral/pkg/syncer/broker"
 	"github.com/submariner-io/admiral/pkg/syncer/test"
@@ -49,7 +50,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	fakeKubeClient "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/klog"
+	"k8s.io/klog/v2"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
@@ -64,10 +65,11 @@ const (
 )
 
 var (
-	nodeName = "my-node"
-	hostName = "my-host"
-	ready    = true
-	notReady = false
+	nodeName       = "my-node"
+	hostName       = "my-host"
+	ready          = true
+	notReady       = false
+	notTerminating = false
 )
 
 func init() {
@@ -96,6 +98,9 @@ type cluster struct {
 	localKubeClient          kubernetes.Interface
 	endpointsReactor         *fake.FailingReactor
 	agentController          *controller.Controller
+	serviceLister            controller.ServiceLister
+	endpointFilter           controller.EndpointFilter
+	metricsRegistry          *prometheus.Registry
 }
 
 type testDriver struct {
@@ -106,7 +111,8 @@ type testDriver struct {
 	service                   *corev1.Service
 	serviceExport             *mcsv1a1.ServiceExport
 	endpoints                 *corev1.Endpoints
-	stopCh                    chan struct{}
+	ctx                       context.Context
+	cancel                    context.CancelFunc
 	syncerConfig              *broker.SyncerConfig
 	endpointGlobalIPs         []string
 	doStart                   bool
@@ -152,14 +158,15 @@ func newTestDiver() *testDriver {
 		syncerConfig: &broker.SyncerConfig{
 			BrokerNamespace: test.RemoteNamespace,
 			RestMapper: test.GetRESTMapperFor(&mcsv1a1.ServiceExport{}, &mcsv1a1.ServiceImport{}, &corev1.Service{},
-				&corev1.Endpoints{}, &discovery.EndpointSlice{}, controller.GetGlobalIngressIPObj()),
+				&corev1.Endpoints{}, &corev1.Pod{}, &corev1.Node{}, &discovery.EndpointSlice{}, controller.GetGlobalIngressIPObj()),
 			BrokerClient: fake.NewDynamicClient(syncerScheme),
 			Scheme:       syncerScheme,
 		},
-		stopCh:  make(chan struct{}),
 		doStart: true,
 	}
 
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
 	t.serviceExport = &mcsv1a1.ServiceExport{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      t.service.Name,
@@ -222,6 +229,27 @@ func newTestDiver() *testDriver {
 	return t
 }
 
+// createLocalServiceImportWithPodSelector creates a local headless ServiceImport for the service in cluster1 with the
+// given endpoint pod selector annotation.
+func (t *testDriver) createLocalServiceImportWithPodSelector(selector string) {
+	test.CreateResource(t.cluster1.localServiceImportClient, &mcsv1a1.ServiceImport{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: t.service.Name + "-" + t.service.Namespace + "-" + clusterID1,
+			Annotations: map[string]string{
+				lhconstants.OriginName:                    t.service.Name,
+				lhconstants.OriginNamespace:               t.service.Namespace,
+				lhconstants.EndpointPodSelectorAnnotation: selector,
+			},
+			Labels: map[string]string{
+				lhconstants.LighthouseLabelSourceCluster: clusterID1,
+			},
+		},
+		Spec: mcsv1a1.ServiceImportSpec{
+			Type: mcsv1a1.Headless,
+		},
+	})
+}
+
 func (t *testDriver) newGlobalIngressIP(name, ip string) *unstructured.Unstructured {
 	ingressIP := controller.GetGlobalIngressIPObj()
 	ingressIP.SetName(name)
@@ -254,15 +282,12 @@ func (t *testDriver) justBeforeEach() {
 }
 
 func (t *testDriver) afterEach() {
-	close(t.stopCh)
+	t.cancel()
 }
 
 func (c *cluster) init(syncerConfig *broker.SyncerConfig) {
 	c.localDynClient = fake.NewDynamicClient(syncerConfig.Scheme)
 
-	fake.AddDeleteCollectionReactor(&c.localDynClient.(*fake.DynamicClient).Fake,
-		discovery.SchemeGroupVersion.WithKind("EndpointSlice"))
-
 	c.localServiceExportClient = c.localDynClient.Resource(*test.GetGroupVersionResourceFor(syncerConfig.RestMapper,
 		&mcsv1a1.ServiceExport{})).Namespace(serviceNamespace).(*fake.DynamicResourceClient)
 
@@ -276,8 +301,13 @@ func (c *cluster) init(syncerConfig *broker.SyncerConfig) {
 		controller.GetGlobalIngressIPObj())).Namespace(serviceNamespace).(*fake.DynamicResourceClient)
 
 	fakeCS := fakeKubeClient.NewSimpleClientset()
+	fakeCS.Resources = []*metav1.APIResourceList{{
+		GroupVersion: mcsv1a1.GroupVersion.String(),
+		APIResources: []metav1.APIResource{{Name: "serviceexports"}, {Name: "serviceimports"}},
+	}}
 	c.endpointsReactor = fake.NewFailingReactorForResource(&fakeCS.Fake, "endpoints")
 	c.localKubeClient = fakeCS
+	c.metricsRegistry = prometheus.NewRegistry()
 }
 
 // nolint:gocritic // (hugeParam) This function modifies syncerConf so we don't want to pass by pointer.
@@ -297,12 +327,15 @@ func (c *cluster) start(t *testDriver, syncerConfig broker.SyncerConfig) {
 		controller.AgentConfig{
 			ServiceImportCounterName: serviceImportCounterName,
 			ServiceExportCounterName: serviceExportCounterName,
+			ServiceLister:            c.serviceLister,
+			MetricsRegisterer:        c.metricsRegistry,
+			EndpointFilter:           c.endpointFilter,
 		})
 
 	Expect(err).To(Succeed())
 
 	if t.doStart {
-		Expect(c.agentController.Start(t.stopCh)).To(Succeed())
+		Expect(c.agentController.Start(t.ctx)).To(Succeed())
 	}
 }
 
@@ -409,19 +442,19 @@ func awaitEndpointSlice(endpointSliceClient dynamic.ResourceInterface, endpoints
 	Expect(endpointSlice.Endpoints).To(HaveLen(3))
 	Expect(endpointSlice.Endpoints[0]).To(Equal(discovery.Endpoint{
 		Addresses:  []string{addresses[0]},
-		Conditions: discovery.EndpointConditions{Ready: &ready},
+		Conditions: discovery.EndpointConditions{Ready: &ready, Serving: &ready, Terminating: &notTerminating},
 		Hostname:   &hostName,
 	}))
 	Expect(endpointSlice.Endpoints[1]).To(Equal(discovery.Endpoint{
 		Addresses:  []string{addresses[1]},
 		Hostname:   &endpoints.Subsets[0].Addresses[1].TargetRef.Name,
-		Conditions: discovery.EndpointConditions{Ready: &ready},
+		Conditions: discovery.EndpointConditions{Ready: &ready, Serving: &ready, Terminating: &notTerminating},
 		NodeName:   &nodeName,
 	}))
 	Expect(endpointSlice.Endpoints[2]).To(Equal(discovery.Endpoint{
 		Addresses:  []string{addresses[2]},
 		Hostname:   &endpoints.Subsets[0].NotReadyAddresses[0].TargetRef.Name,
-		Conditions: discovery.EndpointConditions{Ready: &notReady},
+		Conditions: discovery.EndpointConditions{Ready: &notReady, Serving: &notReady, Terminating: &notTerminating},
 	}))
 
 	Expect(endpointSlice.Ports).To(HaveLen(1))
@@ -478,6 +511,22 @@ func (c *cluster) awaitUpdatedEndpointSlice(endpoints *corev1.Endpoints, expecte
 	awaitUpdatedEndpointSlice(c.localEndpointSliceClient, endpoints, expectedIPs)
 }
 
+func (c *cluster) awaitEndpointSlicePorts(endpoints *corev1.Endpoints, expected ...discovery.EndpointPort) {
+	Eventually(func() []discovery.EndpointPort {
+		obj, err := c.localEndpointSliceClient.Get(context.TODO(), endpoints.Name+"-"+clusterID1, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+
+		Expect(err).To(Succeed())
+
+		endpointSlice := &discovery.EndpointSlice{}
+		Expect(scheme.Scheme.Convert(obj, endpointSlice, nil)).To(Succeed())
+
+		return endpointSlice.Ports
+	}, 5).Should(Equal(expected))
+}
+
 func (c *cluster) dynamicServiceClient() dynamic.NamespaceableResourceInterface {
 	return c.localDynClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "services"})
 }
@@ -496,6 +545,41 @@ func (t *testDriver) awaitUpdatedServiceImport(serviceIP string) {
 	t.cluster2.awaitUpdatedServiceImport(t.service, serviceIP)
 }
 
+func awaitUpdatedServiceImportPorts(client dynamic.ResourceInterface, service *corev1.Service, expected []corev1.ServicePort) {
+	name := service.Name + "-" + service.Namespace + "-" + clusterID1
+
+	expPorts := make([]mcsv1a1.ServicePort, len(expected))
+	for i := range expected {
+		expPorts[i] = mcsv1a1.ServicePort{Name: expected[i].Name, Protocol: expected[i].Protocol, Port: expected[i].Port}
+	}
+
+	var actual []mcsv1a1.ServicePort
+
+	err := wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		obj, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+
+		serviceImport := &mcsv1a1.ServiceImport{}
+		Expect(scheme.Scheme.Convert(obj, serviceImport, nil)).To(Succeed())
+
+		actual = serviceImport.Spec.Ports
+
+		return reflect.DeepEqual(actual, expPorts), nil
+	})
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		Expect(actual).To(Equal(expPorts))
+	}
+
+	Expect(err).To(Succeed())
+}
+
+func (t *testDriver) awaitUpdatedServiceImportPorts(expected []corev1.ServicePort) {
+	awaitUpdatedServiceImportPorts(t.brokerServiceImportClient, t.service, expected)
+	awaitUpdatedServiceImportPorts(t.cluster1.localServiceImportClient, t.service, expected)
+	awaitUpdatedServiceImportPorts(t.cluster2.localServiceImportClient, t.service, expected)
+}
+
 func (t *testDriver) awaitEndpointSlice() {
 	t.awaitBrokerEndpointSlice()
 	t.cluster1.awaitEndpointSlice(t)
@@ -515,6 +599,13 @@ func (t *testDriver) createService() {
 	test.CreateResource(t.cluster1.dynamicServiceClient().Namespace(t.service.Namespace), t.service)
 }
 
+func (t *testDriver) updateService() {
+	_, err := t.cluster1.localKubeClient.CoreV1().Services(t.service.Namespace).Update(context.TODO(), t.service, metav1.UpdateOptions{})
+	Expect(err).To(Succeed())
+
+	test.UpdateResource(t.cluster1.dynamicServiceClient().Namespace(t.service.Namespace), t.service)
+}
+
 func (t *testDriver) createEndpoints() {
 	_, err := t.cluster1.localKubeClient.CoreV1().Endpoints(t.endpoints.Namespace).Create(context.TODO(), t.endpoints, metav1.CreateOptions{})
 	Expect(err).To(Succeed())
@@ -533,10 +624,93 @@ func (t *testDriver) dynamicEndpointsClient() dynamic.ResourceInterface {
 	return t.cluster1.localDynClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "endpoints"}).Namespace(t.service.Namespace)
 }
 
+func (t *testDriver) dynamicPodsClient() dynamic.ResourceInterface {
+	return t.cluster1.localDynClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "pods"}).Namespace(t.service.Namespace)
+}
+
+func (t *testDriver) createPod(pod *corev1.Pod) {
+	test.CreateResource(t.dynamicPodsClient(), pod)
+}
+
+func (t *testDriver) updatePod(pod *corev1.Pod) {
+	test.UpdateResource(t.dynamicPodsClient(), pod)
+}
+
+func awaitEndpointSliceReadiness(endpointSliceClient dynamic.ResourceInterface, endpoints *corev1.Endpoints,
+	expected map[string]bool,
+) {
+	name := endpoints.Name + "-" + clusterID1
+
+	test.AwaitResource(endpointSliceClient, name)
+
+	var actual map[string]bool
+
+	err := wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		obj, err := endpointSliceClient.Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+
+		endpointSlice := &discovery.EndpointSlice{}
+		Expect(scheme.Scheme.Convert(obj, endpointSlice, nil)).To(Succeed())
+
+		actual = map[string]bool{}
+		for i := range endpointSlice.Endpoints {
+			actual[endpointSlice.Endpoints[i].Addresses[0]] = *endpointSlice.Endpoints[i].Conditions.Ready
+		}
+
+		return reflect.DeepEqual(actual, expected), nil
+	})
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		Expect(actual).To(Equal(expected))
+	}
+
+	Expect(err).To(Succeed())
+}
+
+func (t *testDriver) awaitEndpointSliceReadiness(expected map[string]bool) {
+	awaitEndpointSliceReadiness(t.brokerEndpointSliceClient, t.endpoints, expected)
+	awaitEndpointSliceReadiness(t.cluster1.localEndpointSliceClient, t.endpoints, expected)
+	awaitEndpointSliceReadiness(t.cluster2.localEndpointSliceClient, t.endpoints, expected)
+}
+
+// newPod returns a pod with the given name and conditions, labeled to be selected by the Service.
+func newPod(name string, conditions ...corev1.PodCondition) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: serviceNamespace,
+			Labels:    map[string]string{"app": "test"},
+		},
+		Status: corev1.PodStatus{
+			Conditions: append([]corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}, conditions...),
+		},
+	}
+}
+
+func newPodWithLabels(name string, podLabels map[string]string) *corev1.Pod {
+	pod := newPod(name)
+	for k, v := range podLabels {
+		pod.Labels[k] = v
+	}
+
+	return pod
+}
+
 func (t *testDriver) createServiceExport() {
 	test.CreateResource(t.cluster1.localServiceExportClient, t.serviceExport)
 }
 
+// updateServiceExportAnnotations sets the given annotations on the existing ServiceExport, retaining its status.
+func (t *testDriver) updateServiceExportAnnotations(annotations map[string]string) {
+	obj, err := t.cluster1.localServiceExportClient.Get(context.TODO(), t.serviceExport.Name, metav1.GetOptions{})
+	Expect(err).To(Succeed())
+
+	obj.SetAnnotations(annotations)
+
+	_, err = t.cluster1.localServiceExportClient.Update(context.TODO(), obj, metav1.UpdateOptions{})
+	Expect(err).To(Succeed())
+}
+
 func (t *testDriver) deleteServiceExport() {
 	Expect(t.cluster1.localServiceExportClient.Delete(context.TODO(), t.service.GetName(), metav1.DeleteOptions{})).To(Succeed())
 }
@@ -586,21 +760,18 @@ func (t *testDriver) awaitServiceExportStatus(expCond ...*mcsv1a1.ServiceExportC
 
 		found = se
 
-		if len(expCond) != len(se.Status.Conditions) {
-			return false, nil
-		}
+		for _, exp := range expCond {
+			actual := findServiceExportCondition(se.Status.Conditions, exp.Type)
+			if actual == nil || actual.Status != exp.Status || actual.Reason == nil || *actual.Reason != *exp.Reason {
+				return false, nil
+			}
+
+			Expect(actual.LastTransitionTime).To(Not(BeNil()))
+			Expect(actual.Message).To(Not(BeNil()))
 
-		exp := expCond[0]
-		actual := se.Status.Conditions[0]
-		Expect(actual.Type).To(Equal(exp.Type))
-		Expect(actual.Status).To(Equal(exp.Status))
-		Expect(actual.LastTransitionTime).To(Not(BeNil()))
-		Expect(actual.Reason).To(Not(BeNil()))
-		Expect(*actual.Reason).To(Equal(*exp.Reason))
-		Expect(actual.Message).To(Not(BeNil()))
-
-		if exp.Message != nil {
-			Expect(*actual.Message).To(Equal(*exp.Message))
+			if exp.Message != nil && *actual.Message != *exp.Message {
+				return false, nil
+			}
 		}
 
 		return true, nil
@@ -611,7 +782,7 @@ func (t *testDriver) awaitServiceExportStatus(expCond ...*mcsv1a1.ServiceExportC
 			Fail("ServiceExport not found")
 		}
 
-		Fail(format.Message(found.Status.Conditions, fmt.Sprintf("to contain at index %d", 0), expCond))
+		Fail(format.Message(found.Status.Conditions, "to contain", expCond))
 	} else {
 		Expect(err).To(Succeed())
 	}
@@ -631,13 +802,9 @@ func (t *testDriver) awaitNotServiceExportStatus(notCond *mcsv1a1.ServiceExportC
 		se := &mcsv1a1.ServiceExport{}
 		Expect(scheme.Scheme.Convert(obj, se, nil)).To(Succeed())
 
-		if len(se.Status.Conditions) == 0 {
-			return false, nil
-		}
-
-		last := &se.Status.Conditions[len(se.Status.Conditions)-1]
-		if last.Message == notCond.Message && last.Status == notCond.Status {
-			return false, fmt.Errorf("Received unexpected %#v", last)
+		actual := findServiceExportCondition(se.Status.Conditions, notCond.Type)
+		if actual != nil && actual.Message == notCond.Message && actual.Status == notCond.Status {
+			return false, fmt.Errorf("Received unexpected %#v", actual)
 		}
 
 		return false, nil
@@ -700,6 +867,18 @@ func (t *testDriver) endpointIPs() []string {
 	return ips
 }
 
+func findServiceExportCondition(conditions []mcsv1a1.ServiceExportCondition,
+	condType mcsv1a1.ServiceExportConditionType,
+) *mcsv1a1.ServiceExportCondition {
+	for i := range conditions {
+		if conditions[i].Type == condType {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
 func newServiceExportCondition(status corev1.ConditionStatus, reason string) *mcsv1a1.ServiceExportCondition {
 	return &mcsv1a1.ServiceExportCondition{
 		Type:   mcsv1a1.ServiceExportValid,
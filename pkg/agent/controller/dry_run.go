@@ -0,0 +1,108 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/federate"
+	"github.com/submariner-io/admiral/pkg/util"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+// dryRunFederator is a Federator that submits the creates, updates and deletes of the resources to the API server as
+// dry runs, so they're validated and authorized but not persisted, and logs them.
+type dryRunFederator struct {
+	client     dynamic.Interface
+	restMapper meta.RESTMapper
+	namespace  string
+}
+
+func newDryRunFederator(client dynamic.Interface, restMapper meta.RESTMapper, namespace string) federate.Federator {
+	return &dryRunFederator{
+		client:     client,
+		restMapper: restMapper,
+		namespace:  namespace,
+	}
+}
+
+func (f *dryRunFederator) Distribute(obj runtime.Object) error {
+	toDistribute, gvr, err := util.ToUnstructuredResource(obj, f.restMapper)
+	if err != nil {
+		return err // nolint:wrapcheck // Let the caller wrap
+	}
+
+	toDistribute.SetNamespace(f.namespace)
+	resourceClient := f.client.Resource(*gvr).Namespace(f.namespace)
+
+	return retryOnConflict(func() error {
+		existing, err := resourceClient.Get(context.TODO(), toDistribute.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			klog.InfoS("Dry run: creating resource", "resource", gvr.Resource, "name", klog.KObj(toDistribute))
+
+			_, err = resourceClient.Create(context.TODO(), toDistribute, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+			if apierrors.IsAlreadyExists(err) {
+				// It was created in the meantime so retry to update it instead.
+				return apierrors.NewConflict(gvr.GroupResource(), toDistribute.GetName(), err)
+			}
+
+			return errors.Wrapf(err, "error creating %s %q as a dry run", gvr.Resource, toDistribute.GetName())
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "error retrieving %s %q", gvr.Resource, toDistribute.GetName())
+		}
+
+		klog.InfoS("Dry run: updating resource", "resource", gvr.Resource, "name", klog.KObj(toDistribute))
+
+		toDistribute.SetResourceVersion(existing.GetResourceVersion())
+
+		_, err = resourceClient.Update(context.TODO(), toDistribute, metav1.UpdateOptions{DryRun: []string{metav1.DryRunAll}})
+
+		return errors.Wrapf(err, "error updating %s %q as a dry run", gvr.Resource, toDistribute.GetName())
+	})
+}
+
+func (f *dryRunFederator) Delete(obj runtime.Object) error {
+	toDelete, gvr, err := util.ToUnstructuredResource(obj, f.restMapper)
+	if err != nil {
+		return err // nolint:wrapcheck // Let the caller wrap
+	}
+
+	klog.InfoS("Dry run: deleting resource", "resource", gvr.Resource, "name", klog.KRef(f.namespace, toDelete.GetName()))
+
+	err = f.client.Resource(*gvr).Namespace(f.namespace).Delete(context.TODO(), toDelete.GetName(), deleteOptions(true))
+
+	return err // nolint:wrapcheck // Let the caller wrap
+}
+
+// deleteOptions returns the options with which to delete resources, so the deletes are only dry runs if requested.
+func deleteOptions(dryRun bool) metav1.DeleteOptions {
+	if dryRun {
+		return metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+
+	return metav1.DeleteOptions{}
+}
@@ -0,0 +1,199 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/fake"
+	"github.com/submariner-io/admiral/pkg/federate"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var _ = Describe("Dry run", func() {
+	const namespace = "service-ns"
+
+	var (
+		client        *dryRunRecordingClient
+		endpointSlice *discovery.EndpointSlice
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(discovery.AddToScheme(scheme)).To(Succeed())
+
+		client = &dryRunRecordingClient{Interface: fake.NewDynamicClient(scheme), dryRuns: map[string][]string{}}
+
+		endpointSlice = &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "nginx-east",
+				Labels: map[string]string{
+					lhconstants.LabelSourceNamespace:  namespace,
+					lhconstants.MCSLabelSourceCluster: "east",
+					lhconstants.MCSLabelServiceName:   "nginx",
+				},
+			},
+			AddressType: discovery.AddressTypeIPv4,
+		}
+	})
+
+	endpointSlices := func() dynamic.ResourceInterface {
+		return client.Interface.Resource(discovery.SchemeGroupVersion.WithResource("endpointslices")).Namespace(namespace)
+	}
+
+	Context("the dry run federator", func() {
+		var federator federate.Federator
+
+		BeforeEach(func() {
+			federator = newDryRunFederator(client, test.GetRESTMapperFor(&discovery.EndpointSlice{}), namespace)
+		})
+
+		It("should create a new resource as a dry run", func() {
+			Expect(federator.Distribute(endpointSlice)).To(Succeed())
+			Expect(client.dryRuns).To(HaveKeyWithValue("create", []string{metav1.DryRunAll}))
+		})
+
+		It("should update an existing resource as a dry run", func() {
+			test.CreateResource(endpointSlices(), endpointSlice)
+
+			Expect(federator.Distribute(endpointSlice)).To(Succeed())
+			Expect(client.dryRuns).To(HaveKeyWithValue("update", []string{metav1.DryRunAll}))
+			Expect(client.dryRuns).ToNot(HaveKey("create"))
+		})
+
+		When("updating an existing resource fails with a conflict", func() {
+			It("should promptly retry the update", func() {
+				test.CreateResource(endpointSlices(), endpointSlice)
+
+				fakeClient := client.Interface.(*fake.DynamicClient)
+				fake.FailOnAction(&fakeClient.Fake, "endpointslices", "update",
+					apierrors.NewConflict(discovery.Resource("endpointslices"), endpointSlice.Name, nil), true)
+
+				Expect(federator.Distribute(endpointSlice)).To(Succeed())
+				Expect(updatesOf(fakeClient)).To(Equal(2))
+			})
+		})
+
+		When("updating an existing resource fails with another error", func() {
+			It("should return it without retrying", func() {
+				test.CreateResource(endpointSlices(), endpointSlice)
+
+				fakeClient := client.Interface.(*fake.DynamicClient)
+				fake.FailOnAction(&fakeClient.Fake, "endpointslices", "update", nil, false)
+
+				Expect(federator.Distribute(endpointSlice)).ToNot(Succeed())
+				Expect(updatesOf(fakeClient)).To(Equal(1))
+			})
+		})
+
+		It("should delete a resource as a dry run", func() {
+			test.CreateResource(endpointSlices(), endpointSlice)
+
+			Expect(federator.Delete(endpointSlice)).To(Succeed())
+			Expect(client.dryRuns).To(HaveKeyWithValue("delete", []string{metav1.DryRunAll}))
+		})
+	})
+
+	Context("deleting the EndpointSlices of a service", func() {
+		BeforeEach(func() {
+			test.CreateResource(endpointSlices(), endpointSlice)
+		})
+
+		It("should delete them as a dry run if requested", func() {
+			Expect(deleteEndpointSlices(context.TODO(), client, namespace, "nginx", "east", newMetadataKeys(""), true)).To(Succeed())
+			Expect(client.dryRuns).To(HaveKeyWithValue("delete", []string{metav1.DryRunAll}))
+		})
+
+		It("should delete them if a dry run isn't requested", func() {
+			Expect(deleteEndpointSlices(context.TODO(), client, namespace, "nginx", "east", newMetadataKeys(""), false)).To(Succeed())
+			Expect(client.dryRuns).To(HaveKeyWithValue("delete", BeEmpty()))
+
+			_, err := endpointSlices().Get(context.TODO(), endpointSlice.Name, metav1.GetOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+func updatesOf(client *fake.DynamicClient) int {
+	n := 0
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// dryRunRecordingClient is a dynamic client that records the DryRun options of the last create, update and delete
+// requests as the fake dynamic client ignores them.
+type dryRunRecordingClient struct {
+	dynamic.Interface
+	dryRuns map[string][]string
+}
+
+func (c *dryRunRecordingClient) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &dryRunRecordingResource{NamespaceableResourceInterface: c.Interface.Resource(resource), client: c}
+}
+
+type dryRunRecordingResource struct {
+	dynamic.NamespaceableResourceInterface
+	client *dryRunRecordingClient
+}
+
+func (r *dryRunRecordingResource) Namespace(ns string) dynamic.ResourceInterface {
+	return &dryRunRecordingNamespacedResource{ResourceInterface: r.NamespaceableResourceInterface.Namespace(ns), client: r.client}
+}
+
+type dryRunRecordingNamespacedResource struct {
+	dynamic.ResourceInterface
+	client *dryRunRecordingClient
+}
+
+func (r *dryRunRecordingNamespacedResource) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	r.client.dryRuns["create"] = options.DryRun
+	return r.ResourceInterface.Create(ctx, obj, options, subresources...)
+}
+
+func (r *dryRunRecordingNamespacedResource) Update(ctx context.Context, obj *unstructured.Unstructured, options metav1.UpdateOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	r.client.dryRuns["update"] = options.DryRun
+	return r.ResourceInterface.Update(ctx, obj, options, subresources...)
+}
+
+func (r *dryRunRecordingNamespacedResource) Delete(ctx context.Context, name string, options metav1.DeleteOptions,
+	subresources ...string,
+) error {
+	r.client.dryRuns["delete"] = options.DryRun
+	return r.ResourceInterface.Delete(ctx, name, options, subresources...)
+}
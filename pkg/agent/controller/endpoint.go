@@ -20,6 +20,12 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/submariner-io/admiral/pkg/log"
@@ -28,6 +34,7 @@ import (
 	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
 	corev1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -36,43 +43,91 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	validations "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/klog"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 	utilnet "k8s.io/utils/net"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
-func startEndpointController(localClient dynamic.Interface, restMapper meta.RESTMapper, scheme *runtime.Scheme,
-	serviceImport *mcsv1a1.ServiceImport, serviceImportNameSpace, serviceName, clusterID string,
-	globalIngressIPCache *globalIngressIPCache,
-) (*EndpointController, error) {
-	klog.V(log.DEBUG).Infof("Starting Endpoints controller for service %s/%s", serviceImportNameSpace, serviceName)
+var errInvalidPodSelector = errors.New("invalid endpoint pod selector")
 
-	globalIngressIPGVR, _ := schema.ParseResourceArg("globalingressips.v1.submariner.io")
+// maxEndpointMetadataSize is the maximum size of the EndpointMetadataAnnotation value, half of the total annotation size
+// limit of an object.
+const maxEndpointMetadataSize = 128 * 1024
 
-	controller := &EndpointController{
-		clusterID:                    clusterID,
-		serviceImportUID:             serviceImport.UID,
-		serviceImportName:            serviceImport.Name,
-		serviceImportSourceNameSpace: serviceImportNameSpace,
-		serviceName:                  serviceName,
-		stopCh:                       make(chan struct{}),
-		isHeadless:                   serviceImport.Spec.Type == mcsv1a1.Headless,
-		globalIngressIPCache:         globalIngressIPCache,
-		localClient:                  localClient,
-		ingressIPClient:              localClient.Resource(*globalIngressIPGVR),
+const (
+	endpointSliceDeletionBatchSize = 100
+	endpointSliceDeletionTimeout   = time.Minute
+)
+
+func startEndpointController(ctx context.Context, localClient dynamic.Interface, restMapper meta.RESTMapper, scheme *runtime.Scheme,
+	eventRecorder record.EventRecorder, serviceImport *mcsv1a1.ServiceImport, serviceImportNameSpace, serviceName, clusterID string,
+	keys *metadataKeys, globalIngressIPCache *globalIngressIPCache, nodeZoneCache *nodeZoneCache, readinessGates, metadataKeys []string,
+	endpointFilter EndpointFilter, ipFamilies []corev1.IPFamily, publishNotReadyAddresses, serviceIPEndpoints, dryRun bool,
+	maxEndpointsPerSlice int, servicePodSelector string,
+) (*EndpointController, error) {
+	klog.V(log.DEBUG).InfoS("Starting Endpoints controller", "service", klog.KRef(serviceImportNameSpace, serviceName))
+
+	controller, err := newEndpointController(localClient, serviceImport, serviceImportNameSpace, serviceName, clusterID, keys,
+		globalIngressIPCache, nodeZoneCache, readinessGates, metadataKeys, endpointFilter, ipFamilies, publishNotReadyAddresses,
+		serviceIPEndpoints, dryRun, maxEndpointsPerSlice)
+	if err != nil {
+		return nil, err
 	}
 
+	controller.eventRecorder = eventRecorder
+	controller.eventTarget = serviceImport
+	controller.servicePodSelector = servicePodSelector
+
+	// Starting the syncers waits for their caches to sync so stop them if the context is done in the meantime.
+	finishStart := controller.stopIfDoneWhileStarting(ctx)
+
 	nameSelector := fields.OneTermEqualSelector("metadata.name", serviceName)
+	if dryRun {
+		controller.federator = newDryRunFederator(localClient, restMapper, serviceImportNameSpace)
+	} else {
+		controller.federator = broker.NewFederator(localClient, restMapper, serviceImportNameSpace, "", "ownerReferences")
+	}
+
+	if len(controller.readinessGates) > 0 || controller.podSelector != nil || len(controller.metadataKeys) > 0 ||
+		controller.isHeadless || len(controller.addressTypes) > 0 || controller.endpointFilter != nil {
+		// Pod condition, label and annotation changes aren't reflected in the Endpoints so watch the pods to re-evaluate
+		// the readiness gates, pod selector, endpoint filter and endpoint metadata. The pods of a headless service are also
+		// watched to publish whether its endpoints are terminating, as those are resolved individually, and those of a
+		// dual-stack service to obtain their IPs of the secondary family, as the Endpoints only carry the primary one.
+		// Only the pods selected by the service can back its Endpoints, unless they're managed without a selector.
+		controller.podSyncer, err = syncer.NewResourceSyncer(&syncer.ResourceSyncerConfig{
+			Name:                "Pod -> EndpointSlice",
+			SourceClient:        localClient,
+			SourceNamespace:     serviceImportNameSpace,
+			SourceLabelSelector: servicePodSelector,
+			Direction:           syncer.LocalToRemote,
+			RestMapper:          restMapper,
+			Federator:           controller.federator,
+			ResourceType:        &corev1.Pod{},
+			Transform:           controller.podToEndpointSlice,
+			ResourcesEquivalent: podsEquivalent,
+			Scheme:              scheme,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating Pod syncer")
+		}
 
-	epsSyncer, err := syncer.NewResourceSyncer(&syncer.ResourceSyncerConfig{
+		if err := controller.podSyncer.Start(controller.stopCh); err != nil {
+			return nil, errors.Wrap(err, "error starting Pod syncer")
+		}
+	}
+
+	controller.endpointsSyncer, err = syncer.NewResourceSyncer(&syncer.ResourceSyncerConfig{
 		Name:                "Endpoints -> EndpointSlice",
 		SourceClient:        localClient,
 		SourceNamespace:     serviceImportNameSpace,
 		SourceFieldSelector: nameSelector.String(),
 		Direction:           syncer.LocalToRemote,
 		RestMapper:          restMapper,
-		Federator:           broker.NewFederator(localClient, restMapper, serviceImportNameSpace, "", "ownerReferences"),
+		Federator:           controller.federator,
 		ResourceType:        &corev1.Endpoints{},
 		Transform:           controller.endpointsToEndpointSlice,
 		Scheme:              scheme,
@@ -81,61 +136,261 @@ func startEndpointController(localClient dynamic.Interface, restMapper meta.REST
 		return nil, errors.Wrap(err, "error creating Endpoints syncer")
 	}
 
-	if err := epsSyncer.Start(controller.stopCh); err != nil {
+	if err := controller.endpointsSyncer.Start(controller.stopCh); err != nil {
 		return nil, errors.Wrap(err, "error starting Endpoints syncer")
 	}
 
+	if err := finishStart(); err != nil {
+		return nil, err
+	}
+
 	return controller, nil
 }
 
-func (e *EndpointController) stop() {
+// newEndpointController creates the EndpointController for the given ServiceImport's Service in the given namespace
+// without starting it. Its EndpointSlices, which are created in the Service's namespace, can be built with
+// endpointSlicesFor.
+func newEndpointController(localClient dynamic.Interface, serviceImport *mcsv1a1.ServiceImport,
+	serviceImportNameSpace, serviceName, clusterID string, keys *metadataKeys, globalIngressIPCache *globalIngressIPCache,
+	nodeZoneCache *nodeZoneCache, readinessGates, metadataKeys []string, endpointFilter EndpointFilter,
+	ipFamilies []corev1.IPFamily, publishNotReadyAddresses, serviceIPEndpoints, dryRun bool, maxEndpointsPerSlice int,
+) (*EndpointController, error) {
+	globalIngressIPGVR, _ := schema.ParseResourceArg("globalingressips.v1.submariner.io")
+
+	controller := &EndpointController{
+		serviceImport:                serviceImport.DeepCopy(),
+		clusterID:                    clusterID,
+		serviceImportUID:             serviceImport.UID,
+		serviceImportName:            serviceImport.Name,
+		serviceImportSourceNameSpace: serviceImportNameSpace,
+		serviceName:                  serviceName,
+		stopCh:                       make(chan struct{}),
+		exited:                       make(chan struct{}),
+		isHeadless:                   serviceImport.Spec.Type == mcsv1a1.Headless,
+		globalIngressIPCache:         globalIngressIPCache,
+		nodeZoneCache:                nodeZoneCache,
+		localClient:                  localClient,
+		ingressIPClient:              localClient.Resource(*globalIngressIPGVR),
+		metadataKeys:                 metadataKeys,
+		dryRun:                       dryRun,
+		maxEndpointsPerSlice:         maxEndpointsPerSlice,
+		importPorts:                  serviceImport.Spec.Ports,
+		endpointFilter:               endpointFilter,
+		publishNotReadyAddresses:     publishNotReadyAddresses,
+		keys:                         keys,
+	}
+
+	// The EndpointSlices of a ServiceImport backed by Services in multiple namespaces are labeled with its name so
+	// they can be aggregated.
+	if _, ok := serviceImport.Annotations[keys.originNamespaces]; ok {
+		if errs := validations.IsValidLabelValue(serviceImport.Name); len(errs) > 0 {
+			return nil, errors.Errorf("the ServiceImport name %q is not a valid label value %v", serviceImport.Name, errs)
+		}
+
+		controller.serviceImportLabel = serviceImport.Name
+	}
+
+	if serviceIPEndpoints && serviceImport.Spec.Type == mcsv1a1.ClusterSetIP && len(serviceImport.Spec.IPs) > 0 {
+		controller.serviceIP = serviceImport.Spec.IPs[0]
+		controller.servicePorts = serviceImport.Spec.Ports
+	}
+
+	// The endpoints of a dual-stack service are published in an EndpointSlice per IP family, unless the service IP is
+	// published instead or Globalnet, which only allocates IPv4 addresses, provides the IPs of the headless endpoints.
+	if len(ipFamilies) > 1 && controller.serviceIP == "" && !(controller.isHeadless && globalIngressIPCache != nil) {
+		for _, family := range ipFamilies {
+			controller.addressTypes = append(controller.addressTypes, discovery.AddressType(family))
+		}
+	}
+
+	for _, gate := range readinessGates {
+		controller.readinessGates = append(controller.readinessGates, corev1.PodConditionType(gate))
+	}
+
+	if podSelector, ok := serviceImport.Annotations[keys.endpointPodSelector]; ok {
+		selector, err := labels.Parse(podSelector)
+		if err != nil {
+			return nil, errors.Wrapf(errInvalidPodSelector, "error parsing %q: %v", podSelector, err)
+		}
+
+		controller.podSelector = selector
+	}
+
+	return controller, nil
+}
+
+// stopIfDoneWhileStarting stops the EndpointController if the given context is done before the returned function is
+// called to signal that it started. The function returns an error if the EndpointController was stopped. If it isn't
+// called, because the EndpointController failed to start, the EndpointController is stopped once the context is done.
+func (e *EndpointController) stopIfDoneWhileStarting(ctx context.Context) func() error {
+	var (
+		mutex   sync.Mutex
+		started bool
+		stopped bool
+	)
+
+	startedCh := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if !started {
+				stopped = true
+
+				e.stopOnce.Do(func() {
+					close(e.stopCh)
+				})
+			}
+		case <-startedCh:
+		}
+	}()
+
+	return func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		started = true
+		close(startedCh)
+
+		if stopped {
+			return errors.Wrap(ctx.Err(), "the EndpointController was stopped while starting")
+		}
+
+		return nil
+	}
+}
+
+// resync re-creates or updates the EndpointSlice from the current Endpoints, if any, regardless of whether they changed.
+func (e *EndpointController) resync() {
+	select {
+	case <-e.stopCh:
+		return
+	default:
+	}
+
+	obj, found, err := e.endpointsSyncer.GetResource(e.serviceName, e.serviceImportSourceNameSpace)
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving Endpoints", "endpoints", klog.KRef(e.serviceImportSourceNameSpace, e.serviceName))
+		return
+	}
+
+	if !found {
+		return
+	}
+
+	converted, retry := e.endpointSliceFromEndpoints(obj.(*corev1.Endpoints), syncer.Update)
+	if retry || converted == nil {
+		return
+	}
+
+	endpointSlice := converted.(*discovery.EndpointSlice)
+	endpointSlice.SetGroupVersionKind(discovery.SchemeGroupVersion.WithKind("EndpointSlice"))
+
+	if err := e.federator.Distribute(endpointSlice); err != nil {
+		klog.ErrorS(err, "Error re-syncing EndpointSlice",
+			"endpointSlice", klog.KRef(e.serviceImportSourceNameSpace, endpointSlice.Name))
+	}
+}
+
+// stop stops the EndpointController and deletes its EndpointSlices, returning an error if they couldn't all be
+// deleted.
+func (e *EndpointController) stop(ctx context.Context) error {
+	e.stopSyncers()
+
+	return deleteEndpointSlices(ctx, e.localClient, e.serviceImportSourceNameSpace, e.serviceName, e.clusterID, e.keys, e.dryRun)
+}
+
+// stopSyncers stops the EndpointController's syncers, leaving its EndpointSlices as is.
+func (e *EndpointController) stopSyncers() {
 	e.stopOnce.Do(func() {
 		close(e.stopCh)
-		e.cleanup()
 	})
 }
 
-func (e *EndpointController) cleanup() {
-	resourceClient := e.localClient.Resource(schema.GroupVersionResource{
+// exit records that the EndpointController stopped working with the given error, signaling it on its exited channel
+// so it's restarted.
+func (e *EndpointController) exit(err error) {
+	e.exitOnce.Do(func() {
+		e.exitErr = err
+		close(e.exited)
+	})
+}
+
+// recoverPanic recovers a panic in one of the EndpointController's syncers, which then exits rather than crashing
+// the agent.
+func (e *EndpointController) recoverPanic() {
+	if r := recover(); r != nil {
+		e.exit(errors.Errorf("panic in the endpoint controller for service %s/%s: %v", e.serviceImportSourceNameSpace,
+			e.serviceName, r))
+	}
+}
+
+// deleteEndpointSlices deletes the local EndpointSlices created by this cluster for the given service, in batches of
+// endpointSliceDeletionBatchSize, within endpointSliceDeletionTimeout. If dryRun is set, the deletes are only dry runs.
+func deleteEndpointSlices(ctx context.Context, localClient dynamic.Interface, serviceNamespace, serviceName, clusterID string,
+	keys *metadataKeys, dryRun bool,
+) error {
+	resourceClient := localClient.Resource(schema.GroupVersionResource{
 		Group:    discovery.SchemeGroupVersion.Group,
 		Version:  discovery.SchemeGroupVersion.Version,
 		Resource: "endpointslices",
-	}).Namespace(e.serviceImportSourceNameSpace)
+	}).Namespace(serviceNamespace)
 
-	// MCS-compliant labels
-	err := resourceClient.DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{
-		LabelSelector: labels.SelectorFromSet(map[string]string{
-			lhconstants.LabelSourceNamespace:  e.serviceImportSourceNameSpace,
-			lhconstants.MCSLabelSourceCluster: e.clusterID,
-			lhconstants.MCSLabelServiceName:   e.serviceName,
-		}).String(),
-	})
+	ctx, cancel := context.WithTimeout(ctx, endpointSliceDeletionTimeout)
+	defer cancel()
 
-	if err != nil && !apierrors.IsNotFound(err) {
-		klog.Errorf("Error deleting the EndpointSlices associated with serviceImport %q: %v", e.serviceImportName, err)
+	// MCS-compliant labels
+	err := deleteInBatches(ctx, resourceClient, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(endpointSliceOwnerLabels(keys, serviceNamespace, serviceName, clusterID)).String(),
+	}, deleteOptions(dryRun), endpointSliceDeletionBatchSize)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting the EndpointSlices for service %s/%s", serviceNamespace, serviceName)
 	}
 
 	// Lighthouse-proprietary labels
-	err = resourceClient.DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{
+	err = deleteInBatches(ctx, resourceClient, metav1.ListOptions{
 		LabelSelector: labels.SelectorFromSet(map[string]string{
-			lhconstants.LabelSourceNamespace:         e.serviceImportSourceNameSpace,
-			lhconstants.LighthouseLabelSourceCluster: e.clusterID,
-			lhconstants.LighthouseLabelSourceName:    e.serviceName,
+			keys.sourceNamespace: serviceNamespace,
+			keys.sourceCluster:   clusterID,
+			keys.sourceName:      serviceName,
 		}).String(),
-	})
+	}, deleteOptions(dryRun), endpointSliceDeletionBatchSize)
 
-	if err != nil && !apierrors.IsNotFound(err) {
-		klog.Errorf("Error deleting the EndpointSlices associated with serviceImport %q: %v", e.serviceImportName, err)
+	return errors.Wrapf(err, "error deleting the EndpointSlices for service %s/%s", serviceNamespace, serviceName)
+}
+
+// endpointSliceOwnerLabels returns the labels identifying the EndpointSlices created by this cluster for the given service.
+// They're set on creation and used as the selector for listing and deleting, so the EndpointSlices never depend on the
+// labels chosen by the user for the service.
+func endpointSliceOwnerLabels(keys *metadataKeys, serviceNamespace, serviceName, clusterID string) map[string]string {
+	return map[string]string{
+		keys.sourceNamespace:              serviceNamespace,
+		lhconstants.MCSLabelSourceCluster: clusterID,
+		lhconstants.MCSLabelServiceName:   serviceName,
 	}
 }
 
 func (e *EndpointController) endpointsToEndpointSlice(obj runtime.Object, numRequeues int, op syncer.Operation) (runtime.Object, bool) {
+	defer e.recoverPanic()
+
 	endPoints := obj.(*corev1.Endpoints)
 
-	endpointSliceName := endPoints.Name + "-" + e.clusterID
+	endpointSliceName := e.endpointSliceName(endPoints.Name)
 
 	if op == syncer.Delete {
-		klog.V(log.DEBUG).Infof("Endpoints %s/%s deleted", endPoints.Namespace, endPoints.Name)
+		klog.V(log.DEBUG).InfoS("Endpoints changed", "endpoints", klog.KObj(endPoints), "action", op)
+
+		e.setEndpoints(nil)
+
+		if err := e.syncExtraEndpointSlices(endpointSliceName, nil); err != nil {
+			klog.ErrorS(err, "Error deleting the additional EndpointSlices", "endpoints", klog.KObj(endPoints))
+			return nil, true
+		}
+
+		e.recordSync(nil)
 
 		return &discovery.EndpointSlice{
 			ObjectMeta: metav1.ObjectMeta{
@@ -146,51 +401,217 @@ func (e *EndpointController) endpointsToEndpointSlice(obj runtime.Object, numReq
 	}
 
 	if op == syncer.Create {
-		klog.V(log.DEBUG).Infof("Endpoints %s/%s created", endPoints.Namespace, endPoints.Name)
+		klog.V(log.DEBUG).InfoS("Endpoints changed", "endpoints", klog.KObj(endPoints), "action", op)
 	} else {
-		klog.V(log.TRACE).Infof("Endpoints %s/%s updated", endPoints.Namespace, endPoints.Name)
+		klog.V(log.TRACE).InfoS("Endpoints changed", "endpoints", klog.KObj(endPoints), "action", op)
 	}
 
+	e.setEndpoints(endPoints)
+
 	return e.endpointSliceFromEndpoints(endPoints, op)
 }
 
+func (e *EndpointController) podToEndpointSlice(obj runtime.Object, numRequeues int, op syncer.Operation) (runtime.Object, bool) {
+	defer e.recoverPanic()
+
+	// A deleted pod is removed from the Endpoints so there's nothing to do here.
+	if op == syncer.Delete {
+		return nil, false
+	}
+
+	pod := obj.(*corev1.Pod)
+
+	endpoints := e.getEndpoints()
+	if endpoints == nil || !endpointsReferencePod(endpoints, pod.Name) {
+		return nil, false
+	}
+
+	klog.V(log.TRACE).InfoS("Pod for Endpoints changed", "pod", klog.KObj(pod), "endpoints", endpoints.Name, "action", op)
+
+	return e.endpointSliceFromEndpoints(endpoints, syncer.Update)
+}
+
+func (e *EndpointController) setEndpoints(endpoints *corev1.Endpoints) {
+	if e.podSyncer == nil {
+		return
+	}
+
+	e.endpointsMutex.Lock()
+	defer e.endpointsMutex.Unlock()
+
+	e.endpoints = endpoints
+}
+
+func (e *EndpointController) getEndpoints() *corev1.Endpoints {
+	e.endpointsMutex.Lock()
+	defer e.endpointsMutex.Unlock()
+
+	return e.endpoints
+}
+
 func (e *EndpointController) endpointSliceFromEndpoints(endpoints *corev1.Endpoints, op syncer.Operation) (
 	runtime.Object, bool,
 ) {
+	slices, retry := e.buildEndpointSlices(endpoints, e.cachedPod)
+	if retry {
+		return nil, true
+	}
+
+	if len(endpoints.Subsets) > 0 {
+		_, divergences := reconcileEndpointPorts(e.importPorts, endpoints.Subsets[0].Ports)
+		e.portsDiverged(divergences)
+	}
+
+	endpointSlice := slices[0]
+
+	if err := e.syncExtraEndpointSlices(endpointSlice.Name, slices[1:]); err != nil {
+		klog.ErrorS(err, "Error syncing the additional EndpointSlices", "endpoints", klog.KObj(endpoints))
+		return nil, true
+	}
+
+	e.recordSync(slices)
+
+	if op == syncer.Create {
+		klog.V(log.DEBUG).InfoS("Returning EndpointSlice", "endpointSlice", endpointSlice)
+	} else {
+		klog.V(log.TRACE).InfoS("Returning EndpointSlice", "endpointSlice", endpointSlice)
+	}
+
+	return endpointSlice, false
+}
+
+// recordSync records the given EndpointSlices as those last distributed, for the controller's info.
+func (e *EndpointController) recordSync(slices []*discovery.EndpointSlice) {
+	numEndpoints := 0
+	for _, endpointSlice := range slices {
+		numEndpoints += len(endpointSlice.Endpoints)
+	}
+
+	e.syncInfoMutex.Lock()
+	defer e.syncInfoMutex.Unlock()
+
+	e.numEndpointSlices = len(slices)
+	e.numEndpoints = numEndpoints
+	e.lastSync = time.Now()
+}
+
+// info returns a snapshot of the EndpointController's state for the ServiceImport with the given key.
+func (e *EndpointController) info(key string) EndpointControllerInfo {
+	e.syncInfoMutex.Lock()
+	defer e.syncInfoMutex.Unlock()
+
+	info := EndpointControllerInfo{
+		ServiceImport:    key,
+		ServiceNamespace: e.serviceImportSourceNameSpace,
+		ServiceName:      e.serviceName,
+		ClusterID:        e.clusterID,
+		UID:              e.serviceImportUID,
+		EndpointSlices:   e.numEndpointSlices,
+		Endpoints:        e.numEndpoints,
+	}
+
+	if !e.lastSync.IsZero() {
+		lastSync := metav1.NewTime(e.lastSync)
+		info.LastSync = &lastSync
+	}
+
+	return info
+}
+
+// endpointSlicesFor synchronously builds the EndpointSlices for the given Endpoints, the backing pods being looked up
+// in the given list. The EndpointSlice distributed by the Endpoints syncer comes first, followed by the additional ones
+// split off from it or, for a dual-stack service, of the secondary IP family. It has no side effects: nothing is
+// distributed or deleted, the EndpointController's record of its additional EndpointSlices is left as is and the
+// divergences of the ports aren't reported, so the EndpointController need not be started. An error is returned if
+// the IP of an endpoint isn't available yet.
+func (e *EndpointController) endpointSlicesFor(endpoints *corev1.Endpoints, pods []*corev1.Pod) (
+	[]*discovery.EndpointSlice, error,
+) {
+	podsByName := map[string]*corev1.Pod{}
+	for _, pod := range pods {
+		podsByName[pod.Name] = pod
+	}
+
+	slices, retry := e.buildEndpointSlices(endpoints, func(address *corev1.EndpointAddress) *corev1.Pod {
+		return podsByName[address.TargetRef.Name]
+	})
+	if retry {
+		return nil, errors.Errorf("the IPs of the endpoints of %s/%s aren't all available yet", endpoints.Namespace,
+			endpoints.Name)
+	}
+
+	return slices, nil
+}
+
+// buildEndpointSlices builds the EndpointSlices for the given Endpoints, as described by endpointSlicesFor, looking up
+// the backing pods with the given podGetter. It returns true if it should be retried.
+func (e *EndpointController) buildEndpointSlices(endpoints *corev1.Endpoints, getPod podGetter) (
+	[]*discovery.EndpointSlice, bool,
+) {
+	name := e.endpointSliceName(endpoints.Name)
+
+	addressTypes := e.addressTypes
+	if len(addressTypes) == 0 {
+		addressTypes = []discovery.AddressType{discovery.AddressTypeIPv4}
+
+		if len(endpoints.Subsets) > 0 &&
+			allAddressesIPv6(append(endpoints.Subsets[0].Addresses, endpoints.Subsets[0].NotReadyAddresses...)) {
+			addressTypes[0] = discovery.AddressTypeIPv6
+		}
+	}
+
+	var slices []*discovery.EndpointSlice
+
+	for i, addressType := range addressTypes {
+		sliceName := name
+		if i > 0 {
+			sliceName = addressTypeEndpointSliceName(name, addressType)
+		}
+
+		addressTypeSlices, retry := e.endpointSlicesFromEndpoints(endpoints, sliceName, addressType, getPod)
+		if retry {
+			return nil, true
+		}
+
+		slices = append(slices, addressTypeSlices...)
+	}
+
+	return slices, false
+}
+
+// endpointSlicesFromEndpoints returns the EndpointSlice with the given name and address type for the given Endpoints,
+// followed by those split off from it.
+func (e *EndpointController) endpointSlicesFromEndpoints(endpoints *corev1.Endpoints, name string,
+	addressType discovery.AddressType, getPod podGetter,
+) ([]*discovery.EndpointSlice, bool) {
 	endpointSlice := &discovery.EndpointSlice{}
 
-	endpointSlice.Name = endpoints.Name + "-" + e.clusterID
-	endpointSlice.Labels = map[string]string{
-		discovery.LabelManagedBy:          lhconstants.LabelValueManagedBy,
-		lhconstants.LabelSourceNamespace:  e.serviceImportSourceNameSpace,
-		lhconstants.MCSLabelSourceCluster: e.clusterID,
-		lhconstants.MCSLabelServiceName:   e.serviceName,
+	endpointSlice.Name = name
+	endpointSlice.Labels = endpointSliceOwnerLabels(e.keys, e.serviceImportSourceNameSpace, e.serviceName, e.clusterID)
+	endpointSlice.Labels[discovery.LabelManagedBy] = lhconstants.LabelValueManagedBy
+
+	if e.serviceImportLabel != "" {
+		endpointSlice.Labels[e.keys.serviceImportName] = e.serviceImportLabel
 	}
 
-	endpointSlice.AddressType = discovery.AddressTypeIPv4
+	endpointSlice.AddressType = addressType
+
+	metadata := map[string]map[string]string{}
 
 	if len(endpoints.Subsets) > 0 {
 		subset := endpoints.Subsets[0]
-		for i := range subset.Ports {
-			endpointSlice.Ports = append(endpointSlice.Ports, discovery.EndpointPort{
-				Port:     &subset.Ports[i].Port,
-				Name:     &subset.Ports[i].Name,
-				Protocol: &subset.Ports[i].Protocol,
-			})
-		}
 
-		if allAddressesIPv6(append(subset.Addresses, subset.NotReadyAddresses...)) {
-			endpointSlice.AddressType = discovery.AddressTypeIPv6
-		}
+		endpointSlice.Ports, _ = reconcileEndpointPorts(e.importPorts, subset.Ports)
 
-		newEndpoints, retry := e.getEndpointsFromAddresses(subset.Addresses, endpointSlice.AddressType, true)
+		newEndpoints, retry := e.getEndpointsFromAddresses(subset.Addresses, endpointSlice.AddressType, true, metadata, getPod)
 		if retry {
 			return nil, true
 		}
 
 		endpointSlice.Endpoints = append(endpointSlice.Endpoints, newEndpoints...)
 
-		newEndpoints, retry = e.getEndpointsFromAddresses(subset.NotReadyAddresses, endpointSlice.AddressType, false)
+		newEndpoints, retry = e.getEndpointsFromAddresses(subset.NotReadyAddresses, endpointSlice.AddressType, false, metadata,
+			getPod)
 		if retry {
 			// TODO: We may not want unready endpoints at all
 			return nil, true
@@ -199,47 +620,309 @@ func (e *EndpointController) endpointSliceFromEndpoints(endpoints *corev1.Endpoi
 		endpointSlice.Endpoints = append(endpointSlice.Endpoints, newEndpoints...)
 	}
 
-	if op == syncer.Create {
-		klog.V(log.DEBUG).Infof("Returning EndpointSlice: %#v", endpointSlice)
-	} else {
-		klog.V(log.TRACE).Infof("Returning EndpointSlice: %#v", endpointSlice)
+	if e.serviceIP != "" {
+		e.setServiceIPEndpoint(endpointSlice)
+		return []*discovery.EndpointSlice{endpointSlice}, false
 	}
 
-	return endpointSlice, false
+	slices := append([]*discovery.EndpointSlice{endpointSlice}, e.splitEndpointSlice(endpointSlice)...)
+
+	if len(metadata) > 0 {
+		for _, es := range slices {
+			es.Annotations = map[string]string{
+				e.keys.endpointMetadata: encodeEndpointMetadata(es, metadata),
+			}
+		}
+	}
+
+	return slices, false
+}
+
+// portsDiverged reports the given divergences between the ServiceImport's ports and those of the backing service,
+// logging and recording a warning event only when they change so they're not repeated on every Endpoints update.
+func (e *EndpointController) portsDiverged(divergences []string) {
+	description := strings.Join(divergences, "; ")
+
+	e.portDivergenceMutex.Lock()
+	changed := description != e.portDivergence
+	e.portDivergence = description
+	e.portDivergenceMutex.Unlock()
+
+	if !changed || description == "" {
+		return
+	}
+
+	klog.Warningf("The ports of service \"%s/%s\" diverge from those of ServiceImport %q, which take precedence: %s",
+		e.serviceImportSourceNameSpace, e.serviceName, e.serviceImportName, description)
+
+	if e.eventRecorder != nil {
+		e.eventRecorder.Eventf(e.eventTarget, corev1.EventTypeWarning, servicePortsDivergedReason,
+			"The ports of service %s/%s diverge: %s", e.serviceImportSourceNameSpace, e.serviceName, description)
+	}
+}
+
+// endpointSliceName returns the name of the primary EndpointSlice of the Endpoints with the given name. The
+// EndpointSlices of a ServiceImport backed by Services in multiple namespaces are all synced to the broker's namespace
+// so their names also carry the service's namespace, separated by a dot, which can't occur in a service name.
+func (e *EndpointController) endpointSliceName(endpointsName string) string {
+	if e.serviceImportLabel != "" {
+		return endpointsName + "." + e.serviceImportSourceNameSpace + "-" + e.clusterID
+	}
+
+	return endpointsName + "-" + e.clusterID
+}
+
+// addressTypeEndpointSliceName returns the name of the EndpointSlice of the given secondary address type of a dual-stack
+// service whose primary EndpointSlice has the given name. As for the additional EndpointSlices, the suffix is separated
+// by a dot so the name can't clash with the EndpointSlice of a service from another cluster.
+func addressTypeEndpointSliceName(name string, addressType discovery.AddressType) string {
+	return name + "." + strings.ToLower(string(addressType))
 }
 
+// splitEndpointSlice moves the endpoints of the given EndpointSlice exceeding maxEndpointsPerSlice to additional
+// EndpointSlices, with the same labels and ports, which are returned in order.
+func (e *EndpointController) splitEndpointSlice(endpointSlice *discovery.EndpointSlice) []*discovery.EndpointSlice {
+	if e.maxEndpointsPerSlice <= 0 || len(endpointSlice.Endpoints) <= e.maxEndpointsPerSlice {
+		return nil
+	}
+
+	endpoints := endpointSlice.Endpoints
+	endpointSlice.Endpoints = endpoints[:e.maxEndpointsPerSlice]
+
+	var extraSlices []*discovery.EndpointSlice
+
+	for start := e.maxEndpointsPerSlice; start < len(endpoints); start += e.maxEndpointsPerSlice {
+		end := start + e.maxEndpointsPerSlice
+		if end > len(endpoints) {
+			end = len(endpoints)
+		}
+
+		extraSlice := &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   extraEndpointSliceName(endpointSlice.Name, len(extraSlices)+1),
+				Labels: map[string]string{},
+			},
+			AddressType: endpointSlice.AddressType,
+			Ports:       endpointSlice.Ports,
+			Endpoints:   endpoints[start:end],
+		}
+
+		for k, v := range endpointSlice.Labels {
+			extraSlice.Labels[k] = v
+		}
+
+		extraSlices = append(extraSlices, extraSlice)
+	}
+
+	return extraSlices
+}
+
+// extraEndpointSliceName returns the name of the given additional EndpointSlice, numbered from 1, of the EndpointSlice
+// with the given name. The number is separated by a dot, which can't occur in a cluster ID, so the name can't clash
+// with the EndpointSlice of a service from another cluster.
+func extraEndpointSliceName(name string, n int) string {
+	return name + "." + strconv.Itoa(n)
+}
+
+// syncExtraEndpointSlices distributes the given additional EndpointSlices of the EndpointSlice with the given name and
+// deletes the previously distributed ones that are no longer needed. Those are initially found by listing as they may
+// have been left by a previous run of the agent.
+func (e *EndpointController) syncExtraEndpointSlices(name string, extraSlices []*discovery.EndpointSlice) error {
+	e.extraSlicesMutex.Lock()
+	defer e.extraSlicesMutex.Unlock()
+
+	for _, extraSlice := range extraSlices {
+		extraSlice.SetGroupVersionKind(discovery.SchemeGroupVersion.WithKind("EndpointSlice"))
+
+		if err := e.federator.Distribute(extraSlice); err != nil {
+			return errors.Wrapf(err, "error distributing EndpointSlice %q", extraSlice.Name)
+		}
+	}
+
+	resourceClient := e.localClient.Resource(schema.GroupVersionResource{
+		Group:    discovery.SchemeGroupVersion.Group,
+		Version:  discovery.SchemeGroupVersion.Version,
+		Resource: "endpointslices",
+	}).Namespace(e.serviceImportSourceNameSpace)
+
+	names := map[string]bool{}
+	for _, extraSlice := range extraSlices {
+		names[extraSlice.Name] = true
+	}
+
+	surplus, err := e.surplusEndpointSlices(resourceClient, name, names)
+	if err != nil {
+		return err
+	}
+
+	for _, surplusName := range surplus {
+		err := resourceClient.Delete(context.TODO(), surplusName, deleteOptions(e.dryRun))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "error deleting EndpointSlice %q", surplusName)
+		}
+	}
+
+	e.extraSliceNames = names
+
+	return nil
+}
+
+// surplusEndpointSlices returns the names of the additional EndpointSlices of the EndpointSlice with the given name
+// other than the given ones.
+func (e *EndpointController) surplusEndpointSlices(resourceClient dynamic.ResourceInterface, name string,
+	extraSliceNames map[string]bool,
+) ([]string, error) {
+	surplus := []string{}
+
+	if e.extraSliceNames != nil {
+		for extraName := range e.extraSliceNames {
+			if !extraSliceNames[extraName] {
+				surplus = append(surplus, extraName)
+			}
+		}
+
+		sort.Strings(surplus)
+
+		return surplus, nil
+	}
+
+	list, err := resourceClient.List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(endpointSliceOwnerLabels(e.keys, e.serviceImportSourceNameSpace, e.serviceName,
+			e.clusterID)).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the EndpointSlices")
+	}
+
+	for i := range list.Items {
+		if n := list.Items[i].GetName(); n != name && !extraSliceNames[n] {
+			surplus = append(surplus, list.Items[i].GetName())
+		}
+	}
+
+	return surplus, nil
+}
+
+// setServiceIPEndpoint replaces the endpoints of the given EndpointSlice, built from the backing pods, with a single
+// endpoint for the service IP that is ready if any of the pod endpoints is ready. If there are no pod endpoints, the
+// EndpointSlice is left without endpoints so the service isn't considered available.
+func (e *EndpointController) setServiceIPEndpoint(endpointSlice *discovery.EndpointSlice) {
+	podEndpoints := endpointSlice.Endpoints
+
+	endpointSlice.Endpoints = nil
+	endpointSlice.Annotations = nil
+	endpointSlice.Ports = nil
+
+	endpointSlice.AddressType = discovery.AddressTypeIPv4
+	if utilnet.IsIPv6String(e.serviceIP) {
+		endpointSlice.AddressType = discovery.AddressTypeIPv6
+	}
+
+	for i := range e.servicePorts {
+		endpointSlice.Ports = append(endpointSlice.Ports, discovery.EndpointPort{
+			Name:        &e.servicePorts[i].Name,
+			Protocol:    &e.servicePorts[i].Protocol,
+			Port:        &e.servicePorts[i].Port,
+			AppProtocol: e.servicePorts[i].AppProtocol,
+		})
+	}
+
+	if len(podEndpoints) == 0 {
+		return
+	}
+
+	ready := false
+
+	for i := range podEndpoints {
+		if podEndpoints[i].Conditions.Ready != nil && *podEndpoints[i].Conditions.Ready {
+			ready = true
+			break
+		}
+	}
+
+	endpointSlice.Endpoints = []discovery.Endpoint{{
+		Addresses:  []string{e.serviceIP},
+		Conditions: discovery.EndpointConditions{Ready: &ready},
+	}}
+}
+
+// getEndpointsFromAddresses returns the endpoints for the given addresses. The metadata of each endpoint, if any, is
+// added to the given metadata map keyed by the endpoint's address.
 func (e *EndpointController) getEndpointsFromAddresses(addresses []corev1.EndpointAddress, addressType discovery.AddressType,
-	ready bool,
+	ready bool, metadata map[string]map[string]string, getPod podGetter,
 ) ([]discovery.Endpoint, bool) {
 	endpoints := []discovery.Endpoint{}
-	isIPv6AddressType := addressType == discovery.AddressTypeIPv6
 
 	for i := range addresses {
 		address := &addresses[i]
-		if utilnet.IsIPv6String(address.IP) == isIPv6AddressType {
-			endpoint, retry := e.endpointFromAddress(address, ready)
+		if ip := e.addressIP(address, addressType, getPod); ip != "" && e.matchesPodSelector(address, getPod) &&
+			e.passesEndpointFilter(address, getPod) {
+			endpoint, retry := e.endpointFromAddress(address, ip, ready, getPod)
 			if retry {
 				return nil, true
 			}
 
 			endpoints = append(endpoints, *endpoint)
+
+			if m := e.getEndpointMetadata(address, getPod); len(m) > 0 {
+				metadata[endpoint.Addresses[0]] = m
+			}
 		}
 	}
 
 	return endpoints, false
 }
 
-func (e *EndpointController) endpointFromAddress(address *corev1.EndpointAddress, ready bool) (*discovery.Endpoint, bool) {
-	ip := e.getIP(address)
+// addressIP returns the IP of the given address of the given address type or an empty string if it has none. The IP of
+// the secondary type of a dual-stack service is that of the backing pod.
+func (e *EndpointController) addressIP(address *corev1.EndpointAddress, addressType discovery.AddressType,
+	getPod podGetter,
+) string {
+	isIPv6AddressType := addressType == discovery.AddressTypeIPv6
+	if utilnet.IsIPv6String(address.IP) == isIPv6AddressType {
+		return address.IP
+	}
+
+	if len(e.addressTypes) == 0 || address.TargetRef == nil {
+		return ""
+	}
+
+	pod := getPod(address)
+	if pod == nil {
+		return ""
+	}
+
+	for i := range pod.Status.PodIPs {
+		if utilnet.IsIPv6String(pod.Status.PodIPs[i].IP) == isIPv6AddressType {
+			return pod.Status.PodIPs[i].IP
+		}
+	}
+
+	return ""
+}
+
+func (e *EndpointController) endpointFromAddress(address *corev1.EndpointAddress, addressIP string, ready bool,
+	getPod podGetter,
+) (*discovery.Endpoint, bool) {
+	ip := e.getIP(address, addressIP)
 
 	if ip == "" {
 		return nil, true
 	}
 
+	// As for the upstream EndpointSlices, a terminating endpoint may be serving but isn't ready.
+	serving := ready && e.passesReadinessGates(address, getPod) && e.isPodReady(address, getPod)
+	terminating := e.isTerminating(address, getPod)
+	ready = serving && !terminating
+
 	endpoint := &discovery.Endpoint{
-		Addresses:  []string{ip},
-		Conditions: discovery.EndpointConditions{Ready: &ready},
-		NodeName:   address.NodeName,
+		Addresses: []string{ip},
+		Conditions: discovery.EndpointConditions{
+			Ready:       &ready,
+			Serving:     &serving,
+			Terminating: &terminating,
+		},
+		NodeName: address.NodeName,
 	}
 
 	/*
@@ -256,9 +939,243 @@ func (e *EndpointController) endpointFromAddress(address *corev1.EndpointAddress
 		endpoint.Hostname = &address.TargetRef.Name
 	}
 
+	e.setZone(endpoint)
+
 	return endpoint, false
 }
 
+// setZone sets the zone of the given endpoint, and the hint to consume it from that zone, to the zone of its node, if
+// topology is published and the node is in a zone.
+func (e *EndpointController) setZone(endpoint *discovery.Endpoint) {
+	if e.nodeZoneCache == nil || endpoint.NodeName == nil {
+		return
+	}
+
+	zone, found := e.nodeZoneCache.getZone(*endpoint.NodeName)
+	if !found {
+		return
+	}
+
+	endpoint.Zone = &zone
+	endpoint.Hints = &discovery.EndpointHints{ForZones: []discovery.ForZone{{Name: zone}}}
+}
+
+// passesReadinessGates returns true if the pod backing the given address has all the configured readiness gate
+// conditions set to True. Addresses that aren't backed by a pod aren't subject to the readiness gates.
+func (e *EndpointController) passesReadinessGates(address *corev1.EndpointAddress, getPod podGetter) bool {
+	if len(e.readinessGates) == 0 || address.TargetRef == nil {
+		return true
+	}
+
+	pod := getPod(address)
+	if pod == nil {
+		klog.V(log.DEBUG).InfoS("Pod not found - treating as not ready",
+			"pod", klog.KRef(e.serviceImportSourceNameSpace, address.TargetRef.Name))
+		return false
+	}
+
+	for _, gate := range e.readinessGates {
+		if !podConditionTrue(pod, gate) {
+			klog.V(log.DEBUG).InfoS("Pod does not pass readiness gate", "pod", klog.KObj(pod), "readinessGate", gate)
+			return false
+		}
+	}
+
+	return true
+}
+
+// isPodReady returns false if the service publishes its not-ready addresses and the pod backing the given address isn't
+// ready. The Endpoints of such a service list all its addresses as ready so they're published with the readiness of
+// their pod instead. Otherwise, or if the pod isn't found, it returns true.
+func (e *EndpointController) isPodReady(address *corev1.EndpointAddress, getPod podGetter) bool {
+	if !e.publishNotReadyAddresses || address.TargetRef == nil {
+		return true
+	}
+
+	pod := getPod(address)
+
+	return pod == nil || podConditionTrue(pod, corev1.PodReady)
+}
+
+// isTerminating returns true if the pod backing the given address is being deleted. Terminating pods are normally
+// removed from the Endpoints but are retained if the service publishes not ready addresses. If the pod isn't found, e.g.
+// because the pods aren't watched, the address is considered not terminating.
+func (e *EndpointController) isTerminating(address *corev1.EndpointAddress, getPod podGetter) bool {
+	if address.TargetRef == nil {
+		return false
+	}
+
+	pod := getPod(address)
+
+	return pod != nil && pod.DeletionTimestamp != nil
+}
+
+// matchesPodSelector returns true if the pod backing the given address matches the configured pod selector, in which
+// case the address is published. Addresses that aren't backed by a pod aren't subject to the pod selector.
+func (e *EndpointController) matchesPodSelector(address *corev1.EndpointAddress, getPod podGetter) bool {
+	if e.podSelector == nil || address.TargetRef == nil {
+		return true
+	}
+
+	pod := getPod(address)
+	if pod == nil {
+		klog.V(log.DEBUG).InfoS("Pod not found - excluding it",
+			"pod", klog.KRef(e.serviceImportSourceNameSpace, address.TargetRef.Name))
+		return false
+	}
+
+	return e.podSelector.Matches(labels.Set(pod.Labels))
+}
+
+// passesEndpointFilter returns whether the pod backing the given address, if any, passes the endpoint filter, if set.
+func (e *EndpointController) passesEndpointFilter(address *corev1.EndpointAddress, getPod podGetter) bool {
+	if e.endpointFilter == nil || address.TargetRef == nil {
+		return true
+	}
+
+	pod := getPod(address)
+	if pod == nil {
+		klog.V(log.DEBUG).InfoS("Pod not found - excluding it",
+			"pod", klog.KRef(e.serviceImportSourceNameSpace, address.TargetRef.Name))
+		return false
+	}
+
+	return e.endpointFilter(pod)
+}
+
+// ExcludeAnnotatedPods is an EndpointFilter that excludes the endpoints backed by the pods annotated with
+// EndpointExcludeAnnotation set to "true".
+func ExcludeAnnotatedPods(pod *corev1.Pod) bool {
+	return pod.Annotations[lhconstants.EndpointExcludeAnnotation] != "true"
+}
+
+// getEndpointMetadata returns the values of the configured metadata keys from the labels, or otherwise the annotations,
+// of the pod backing the given address.
+func (e *EndpointController) getEndpointMetadata(address *corev1.EndpointAddress, getPod podGetter) map[string]string {
+	if len(e.metadataKeys) == 0 || address.TargetRef == nil {
+		return nil
+	}
+
+	pod := getPod(address)
+	if pod == nil {
+		return nil
+	}
+
+	metadata := map[string]string{}
+
+	for _, key := range e.metadataKeys {
+		if value, ok := pod.Labels[key]; ok {
+			metadata[key] = value
+		} else if value, ok := pod.Annotations[key]; ok {
+			metadata[key] = value
+		}
+	}
+
+	return metadata
+}
+
+// encodeEndpointMetadata encodes the given per-endpoint metadata as the JSON value of the EndpointMetadataAnnotation.
+// Endpoints are added in the EndpointSlice's order until maxEndpointMetadataSize is reached so the annotation stays
+// well within the total annotation size limit - the metadata of the remaining endpoints is omitted.
+func encodeEndpointMetadata(endpointSlice *discovery.EndpointSlice, metadata map[string]map[string]string) string {
+	included := map[string]map[string]string{}
+	size := len("{}")
+
+	for i := range endpointSlice.Endpoints {
+		address := endpointSlice.Endpoints[i].Addresses[0]
+
+		m, ok := metadata[address]
+		if !ok {
+			continue
+		}
+
+		entry, err := json.Marshal(map[string]map[string]string{address: m})
+		if err != nil {
+			klog.ErrorS(err, "Error encoding the metadata for endpoint", "address", address)
+			continue
+		}
+
+		// The entry's enclosing braces are replaced by a separating comma in the encoded map.
+		entrySize := len(entry) - 1
+		if size+entrySize > maxEndpointMetadataSize {
+			klog.Warningf("The endpoint metadata for EndpointSlice %q exceeds %d bytes - omitting it for %d of %d endpoints",
+				endpointSlice.Name, maxEndpointMetadataSize, len(metadata)-len(included), len(metadata))
+
+			break
+		}
+
+		size += entrySize
+		included[address] = m
+	}
+
+	encoded, err := json.Marshal(included)
+	if err != nil {
+		klog.ErrorS(err, "Error encoding the endpoint metadata for EndpointSlice", "endpointSlice", endpointSlice.Name)
+		return "{}"
+	}
+
+	return string(encoded)
+}
+
+// podGetter returns the pod backing the given address, which must have a TargetRef, or nil if it isn't found.
+type podGetter func(address *corev1.EndpointAddress) *corev1.Pod
+
+// cachedPod returns the pod backing the given address from the pod syncer's cache or nil if it isn't found or the pods
+// aren't watched.
+func (e *EndpointController) cachedPod(address *corev1.EndpointAddress) *corev1.Pod {
+	if e.podSyncer == nil {
+		return nil
+	}
+
+	obj, found, err := e.podSyncer.GetResource(address.TargetRef.Name, e.serviceImportSourceNameSpace)
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving pod", "pod", klog.KRef(e.serviceImportSourceNameSpace, address.TargetRef.Name))
+		return nil
+	}
+
+	if !found {
+		return nil
+	}
+
+	return obj.(*corev1.Pod)
+}
+
+func podConditionTrue(pod *corev1.Pod, condType corev1.PodConditionType) bool {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == condType {
+			return pod.Status.Conditions[i].Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func podsEquivalent(obj1, obj2 *unstructured.Unstructured) bool {
+	c1, _, _ := unstructured.NestedSlice(obj1.Object, "status", "conditions")
+	c2, _, _ := unstructured.NestedSlice(obj2.Object, "status", "conditions")
+	ips1, _, _ := unstructured.NestedSlice(obj1.Object, "status", "podIPs")
+	ips2, _, _ := unstructured.NestedSlice(obj2.Object, "status", "podIPs")
+
+	return equality.Semantic.DeepEqual(c1, c2) && equality.Semantic.DeepEqual(ips1, ips2) &&
+		equality.Semantic.DeepEqual(obj1.GetLabels(), obj2.GetLabels()) &&
+		equality.Semantic.DeepEqual(obj1.GetAnnotations(), obj2.GetAnnotations()) &&
+		equality.Semantic.DeepEqual(obj1.GetDeletionTimestamp(), obj2.GetDeletionTimestamp())
+}
+
+func endpointsReferencePod(endpoints *corev1.Endpoints, podName string) bool {
+	for i := range endpoints.Subsets {
+		for _, addresses := range [][]corev1.EndpointAddress{endpoints.Subsets[i].Addresses, endpoints.Subsets[i].NotReadyAddresses} {
+			for j := range addresses {
+				if addresses[j].TargetRef != nil && addresses[j].TargetRef.Name == podName {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
 func allAddressesIPv6(addresses []corev1.EndpointAddress) bool {
 	if len(addresses) == 0 {
 		return false
@@ -273,7 +1190,7 @@ func allAddressesIPv6(addresses []corev1.EndpointAddress) bool {
 	return true
 }
 
-func (e *EndpointController) getIP(address *corev1.EndpointAddress) string {
+func (e *EndpointController) getIP(address *corev1.EndpointAddress, addressIP string) string {
 	if e.isHeadless && e.globalIngressIPCache != nil {
 		obj, found := e.globalIngressIPCache.getForPod(e.serviceImportSourceNameSpace, address.TargetRef.Name)
 
@@ -283,11 +1200,11 @@ func (e *EndpointController) getIP(address *corev1.EndpointAddress) string {
 		}
 
 		if ip == "" {
-			klog.Infof("GlobalIP for EndpointAddress %q is not allocated yet", address.TargetRef.Name)
+			klog.InfoS("GlobalIP for EndpointAddress is not allocated yet", "pod", address.TargetRef.Name)
 		}
 
 		return ip
 	}
 
-	return address.IP
+	return addressIP
 }
@@ -0,0 +1,211 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/fake"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+var _ = Describe("EndpointController endpointSlicesFor", func() {
+	const namespace = "service-ns"
+
+	var (
+		serviceImport *mcsv1a1.ServiceImport
+		endpoints     *corev1.Endpoints
+		pods          []*corev1.Pod
+		ipFamilies    []corev1.IPFamily
+		filter        EndpointFilter
+		labelPrefix   string
+		maxEndpoints  int
+		client        *fake.DynamicClient
+		controller    *EndpointController
+		slices        []*discovery.EndpointSlice
+	)
+
+	newPod := func(name string, podLabels map[string]string, ips ...string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: podLabels}}
+		for _, ip := range ips {
+			pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+		}
+
+		return pod
+	}
+
+	addressesOf := func(endpointSlice *discovery.EndpointSlice) []string {
+		addresses := []string{}
+		for i := range endpointSlice.Endpoints {
+			addresses = append(addresses, endpointSlice.Endpoints[i].Addresses...)
+		}
+
+		return addresses
+	}
+
+	BeforeEach(func() {
+		serviceImport = &mcsv1a1.ServiceImport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "nginx-service-ns-east",
+				Annotations: map[string]string{},
+			},
+			Spec: mcsv1a1.ServiceImportSpec{Type: mcsv1a1.ClusterSetIP},
+		}
+
+		endpoints = &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: namespace},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{
+					{IP: "192.168.5.1", TargetRef: &corev1.ObjectReference{Name: "one"}},
+					{IP: "192.168.5.2", TargetRef: &corev1.ObjectReference{Name: "two"}},
+				},
+			}},
+		}
+
+		pods = []*corev1.Pod{
+			newPod("one", map[string]string{"app": "a"}, "192.168.5.1", "fd00::1"),
+			newPod("two", map[string]string{"app": "b"}, "192.168.5.2", "fd00::2"),
+		}
+
+		ipFamilies = nil
+		filter = nil
+		labelPrefix = ""
+		maxEndpoints = DefaultMaxEndpointsPerSlice
+	})
+
+	JustBeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(discovery.AddToScheme(scheme)).To(Succeed())
+
+		client = fake.NewDynamicClient(scheme)
+
+		var err error
+
+		controller, err = newEndpointController(client, serviceImport, namespace, "nginx", "east", newMetadataKeys(labelPrefix),
+			nil, nil, nil, nil, filter, ipFamilies, false, false, false, maxEndpoints)
+		Expect(err).To(Succeed())
+
+		slices, err = controller.endpointSlicesFor(endpoints, pods)
+		Expect(err).To(Succeed())
+	})
+
+	It("should build an EndpointSlice with all the endpoints", func() {
+		Expect(slices).To(HaveLen(1))
+		Expect(slices[0].Name).To(Equal("nginx-east"))
+		Expect(slices[0].AddressType).To(Equal(discovery.AddressTypeIPv4))
+		Expect(addressesOf(slices[0])).To(Equal([]string{"192.168.5.1", "192.168.5.2"}))
+	})
+
+	It("should label the EndpointSlice with the owner labels used to select it for deletion", func() {
+		Expect(slices).To(HaveLen(1))
+		Expect(labels.SelectorFromSet(endpointSliceOwnerLabels(newMetadataKeys(labelPrefix), namespace, "nginx", "east")).Matches(
+			labels.Set(slices[0].Labels))).To(BeTrue())
+	})
+
+	When("the endpoints exceed the maximum per EndpointSlice", func() {
+		BeforeEach(func() {
+			maxEndpoints = 1
+		})
+
+		It("should split them without distributing or recording the additional EndpointSlices", func() {
+			Expect(slices).To(HaveLen(2))
+			Expect(slices[1].Name).To(Equal("nginx-east.1"))
+			Expect(addressesOf(slices[1])).To(Equal([]string{"192.168.5.2"}))
+			Expect(client.Actions()).To(BeEmpty())
+			Expect(controller.extraSliceNames).To(BeNil())
+		})
+	})
+
+	When("a label prefix is set", func() {
+		BeforeEach(func() {
+			labelPrefix = "mcs.example.com/"
+		})
+
+		It("should label the EndpointSlice with the prefixed keys", func() {
+			Expect(slices).To(HaveLen(1))
+			Expect(slices[0].Labels).To(HaveKeyWithValue("mcs.example.com/sourceNamespace", namespace))
+			Expect(slices[0].Labels).ToNot(HaveKey(lhconstants.LabelSourceNamespace))
+			Expect(labels.SelectorFromSet(endpointSliceOwnerLabels(newMetadataKeys(labelPrefix), namespace, "nginx", "east")).Matches(
+				labels.Set(slices[0].Labels))).To(BeTrue())
+		})
+	})
+
+	When("a pod selector is set", func() {
+		BeforeEach(func() {
+			serviceImport.Annotations[lhconstants.EndpointPodSelectorAnnotation] = "app=a"
+		})
+
+		It("should only include the endpoints of the given pods matching it", func() {
+			Expect(slices).To(HaveLen(1))
+			Expect(addressesOf(slices[0])).To(Equal([]string{"192.168.5.1"}))
+		})
+	})
+
+	When("an endpoint filter is set", func() {
+		BeforeEach(func() {
+			filter = ExcludeAnnotatedPods
+			pods[1].Annotations = map[string]string{lhconstants.EndpointExcludeAnnotation: "true"}
+		})
+
+		It("should exclude the endpoints of the given pods it rejects", func() {
+			Expect(slices).To(HaveLen(1))
+			Expect(addressesOf(slices[0])).To(Equal([]string{"192.168.5.1"}))
+		})
+	})
+
+	When("a pod is terminating", func() {
+		BeforeEach(func() {
+			now := metav1.Now()
+			pods[1].DeletionTimestamp = &now
+		})
+
+		It("should mark its endpoint as terminating", func() {
+			Expect(slices).To(HaveLen(1))
+			Expect(*slices[0].Endpoints[0].Conditions.Terminating).To(BeFalse())
+			Expect(*slices[0].Endpoints[1].Conditions.Terminating).To(BeTrue())
+			Expect(*slices[0].Endpoints[1].Conditions.Ready).To(BeFalse())
+		})
+	})
+
+	When("the service is dual-stack", func() {
+		BeforeEach(func() {
+			ipFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+		})
+
+		It("should build an EndpointSlice for each IP family from the given pods' IPs", func() {
+			Expect(slices).To(HaveLen(2))
+			Expect(slices[0].AddressType).To(Equal(discovery.AddressTypeIPv4))
+			Expect(addressesOf(slices[0])).To(Equal([]string{"192.168.5.1", "192.168.5.2"}))
+			Expect(slices[1].Name).To(Equal("nginx-east.ipv6"))
+			Expect(slices[1].AddressType).To(Equal(discovery.AddressTypeIPv6))
+			Expect(addressesOf(slices[1])).To(Equal([]string{"fd00::1", "fd00::2"}))
+
+			for _, endpointSlice := range slices {
+				Expect(labels.SelectorFromSet(endpointSliceOwnerLabels(newMetadataKeys(labelPrefix), namespace, "nginx", "east")).Matches(
+					labels.Set(endpointSlice.Labels))).To(BeTrue())
+			}
+		})
+	})
+})
@@ -0,0 +1,287 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/syncer"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+// EndpointsSynced is the type of the condition reporting whether a service's EndpointSlices are synced to a cluster.
+const EndpointsSynced mcsv1a1.ServiceExportConditionType = "EndpointsSynced"
+
+// Reasons of a cluster's EndpointsSynced condition, besides those of the Warning events recorded on the ServiceImport.
+const (
+	endpointControllersStartedReason  = "EndpointControllersStarted"
+	endpointControllerExitedReason    = "EndpointControllerExited"
+	serviceImportDeletedReason        = "ServiceImportDeleted"
+	endpointSliceDeletionFailedReason = "EndpointSliceDeletionFailed"
+)
+
+// Reasons of the aggregated EndpointsSynced condition.
+const (
+	allClustersSyncedReason   = "AllClustersSynced"
+	clustersNotSyncedReason   = "ClustersNotSynced"
+	clustersSyncPendingReason = "ClustersSyncPending"
+	noClustersReason          = "NoClusters"
+)
+
+// AggregateEndpointsSynced rolls up the given per-cluster EndpointsSynced conditions, ignoring those of other types,
+// into an overall EndpointsSynced condition. It's True if every cluster's condition is True, False if any cluster's is
+// False and otherwise Unknown, with a message listing the clusters that aren't synced. Its LastTransitionTime is the
+// latest of the clusters' conditions.
+func AggregateEndpointsSynced(conditions []ClusterCondition) mcsv1a1.ServiceExportCondition {
+	var notSynced, pending []string
+
+	aggregated := mcsv1a1.ServiceExportCondition{Type: EndpointsSynced}
+	numClusters := 0
+
+	for i := range conditions {
+		condition := &conditions[i].Condition
+		if condition.Type != EndpointsSynced {
+			continue
+		}
+
+		numClusters++
+
+		switch condition.Status {
+		case corev1.ConditionTrue:
+		case corev1.ConditionFalse:
+			notSynced = append(notSynced, conditions[i].ClusterID)
+		default:
+			pending = append(pending, conditions[i].ClusterID)
+		}
+
+		if condition.LastTransitionTime != nil && (aggregated.LastTransitionTime == nil ||
+			aggregated.LastTransitionTime.Before(condition.LastTransitionTime)) {
+			aggregated.LastTransitionTime = condition.LastTransitionTime.DeepCopy()
+		}
+	}
+
+	sort.Strings(notSynced)
+	sort.Strings(pending)
+
+	var reason, msg string
+
+	switch {
+	case numClusters == 0:
+		aggregated.Status = corev1.ConditionUnknown
+		reason, msg = noClustersReason, "No cluster reported whether the endpoints are synced"
+	case len(notSynced) > 0:
+		aggregated.Status = corev1.ConditionFalse
+		reason = clustersNotSyncedReason
+		msg = fmt.Sprintf("The endpoints aren't synced in %d of %d clusters: %v", len(notSynced), numClusters, notSynced)
+	case len(pending) > 0:
+		aggregated.Status = corev1.ConditionUnknown
+		reason = clustersSyncPendingReason
+		msg = fmt.Sprintf("The endpoints sync is pending in %d of %d clusters: %v", len(pending), numClusters, pending)
+	default:
+		aggregated.Status = corev1.ConditionTrue
+		reason = allClustersSyncedReason
+		msg = fmt.Sprintf("The endpoints are synced in all %d clusters", numClusters)
+	}
+
+	aggregated.Reason = &reason
+	aggregated.Message = &msg
+
+	return aggregated
+}
+
+// endpointsSyncedOf returns the cluster's EndpointsSynced condition recorded, JSON-encoded, under the given annotation
+// key of the given ServiceImport annotations or nil if there's none or it can't be decoded.
+func endpointsSyncedOf(annotations map[string]string, key string) *mcsv1a1.ServiceExportCondition {
+	encoded, ok := annotations[key]
+	if !ok {
+		return nil
+	}
+
+	condition := &mcsv1a1.ServiceExportCondition{}
+	if err := json.Unmarshal([]byte(encoded), condition); err != nil {
+		klog.ErrorS(err, "Error decoding the EndpointsSynced condition", "annotation", key, "value", encoded)
+		return nil
+	}
+
+	if condition.Type != EndpointsSynced {
+		klog.ErrorS(nil, "Unexpected condition type in the EndpointsSynced annotation", "annotation", key,
+			"type", condition.Type)
+		return nil
+	}
+
+	return condition
+}
+
+// setEndpointsSynced records this cluster's EndpointsSynced condition on its local ServiceImport with the given name
+// and namespace. The ServiceImport status has no conditions so it's recorded in an annotation, which is synced with
+// the ServiceImport to the other clusters. The ServiceImport isn't updated if the condition didn't change and the
+// LastTransitionTime is only changed if its status changes.
+func (c *ServiceImportController) setEndpointsSynced(ctx context.Context, name, namespace string, status corev1.ConditionStatus,
+	reason, msg string,
+) {
+	if c.dryRun {
+		return
+	}
+
+	client := c.localClient.Resource(serviceImportGVR).Namespace(namespace)
+
+	err := retryOnConflict(func() error {
+		obj, err := client.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "error retrieving ServiceImport")
+		}
+
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+
+		now := metav1.Now()
+		condition := &mcsv1a1.ServiceExportCondition{
+			Type:               EndpointsSynced,
+			Status:             status,
+			LastTransitionTime: &now,
+			Reason:             &reason,
+			Message:            &msg,
+		}
+
+		if existing := endpointsSyncedOf(annotations, c.keys.endpointsSynced); existing != nil {
+			if serviceExportConditionEqual(existing, condition) {
+				return nil
+			}
+
+			if existing.Status == status {
+				condition.LastTransitionTime = existing.LastTransitionTime
+			}
+		}
+
+		encoded, err := json.Marshal(condition)
+		if err != nil {
+			return errors.Wrap(err, "error encoding the EndpointsSynced condition")
+		}
+
+		annotations[c.keys.endpointsSynced] = string(encoded)
+		obj.SetAnnotations(annotations)
+
+		_, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+
+		return errors.Wrap(err, "error updating ServiceImport")
+	})
+	if err != nil {
+		klog.ErrorS(err, "Error setting the EndpointsSynced condition", "serviceImport", klog.KRef(namespace, name),
+			"status", status, "reason", reason)
+	}
+}
+
+// serviceImportToEndpointsSynced is the transform of the ServiceImports synced to and from the broker that aggregates
+// the clusters' EndpointsSynced conditions. It doesn't change the ServiceImport.
+func (a *Controller) serviceImportToEndpointsSynced(obj runtime.Object, _ int, op syncer.Operation) (runtime.Object, bool) {
+	if serviceImport, ok := obj.(*mcsv1a1.ServiceImport); ok {
+		a.aggregateEndpointsSynced(serviceImport, op)
+	}
+
+	return obj, false
+}
+
+// aggregateEndpointsSynced records the EndpointsSynced condition of the cluster of the given ServiceImport, Unknown if
+// it has none yet, and sets the EndpointsSynced condition of the local ServiceExport of its service, if any, to the
+// aggregate of those of all the clusters exporting the service. The conditions are tracked as the ServiceImports are
+// synced, rather than read from the informer caches, as a ServiceImport synced from the broker isn't in the local cache
+// yet.
+func (a *Controller) aggregateEndpointsSynced(serviceImport *mcsv1a1.ServiceImport, op syncer.Operation) {
+	name := serviceImport.Labels[a.keys.sourceName]
+	namespace := serviceImport.Labels[a.keys.sourceNamespace]
+	clusterID := serviceImport.Labels[a.keys.sourceCluster]
+
+	if name == "" || clusterID == "" {
+		return
+	}
+
+	key := namespace + "/" + name
+
+	// Only the tracked conditions are guarded, not the ServiceExport lookup and update, so the ServiceImports of other
+	// services aren't held up by the API call.
+	conditions := a.trackEndpointsSynced(key, clusterID, serviceImport, op)
+
+	_, found, err := a.serviceExportSyncer.GetResource(name, namespace)
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving ServiceExport", "serviceExport", key)
+		return
+	}
+
+	if !found {
+		return
+	}
+
+	aggregated := AggregateEndpointsSynced(conditions)
+	if aggregated.LastTransitionTime == nil {
+		now := metav1.Now()
+		aggregated.LastTransitionTime = &now
+	}
+
+	a.setExportedServiceCondition(name, namespace, &aggregated)
+}
+
+// trackEndpointsSynced records, or forgets on deletion, the EndpointsSynced condition of the given cluster for the
+// service with the given key and returns a snapshot of the conditions of all the clusters exporting the service.
+func (a *Controller) trackEndpointsSynced(key, clusterID string, serviceImport *mcsv1a1.ServiceImport, op syncer.Operation,
+) []ClusterCondition {
+	a.endpointsSyncedMutex.Lock()
+	defer a.endpointsSyncedMutex.Unlock()
+
+	clusters := a.endpointsSynced[key]
+
+	if op == syncer.Delete {
+		delete(clusters, clusterID)
+
+		if len(clusters) == 0 {
+			delete(a.endpointsSynced, key)
+		}
+	} else {
+		if clusters == nil {
+			clusters = map[string]mcsv1a1.ServiceExportCondition{}
+			a.endpointsSynced[key] = clusters
+		}
+
+		condition := endpointsSyncedOf(serviceImport.Annotations, a.keys.endpointsSynced)
+		if condition == nil {
+			condition = &mcsv1a1.ServiceExportCondition{Type: EndpointsSynced, Status: corev1.ConditionUnknown}
+		}
+
+		clusters[clusterID] = *condition
+	}
+
+	conditions := make([]ClusterCondition, 0, len(clusters))
+	for clusterID, condition := range clusters {
+		conditions = append(conditions, ClusterCondition{ClusterID: clusterID, Condition: *condition.DeepCopy()})
+	}
+
+	return conditions
+}
@@ -0,0 +1,255 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/federate"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+var _ = Describe("AggregateEndpointsSynced", func() {
+	var (
+		conditions []controller.ClusterCondition
+		now        metav1.Time
+	)
+
+	newCondition := func(clusterID string, condType mcsv1a1.ServiceExportConditionType, status corev1.ConditionStatus,
+		transitionTime metav1.Time,
+	) controller.ClusterCondition {
+		return controller.ClusterCondition{
+			ClusterID: clusterID,
+			Condition: mcsv1a1.ServiceExportCondition{
+				Type:               condType,
+				Status:             status,
+				LastTransitionTime: &transitionTime,
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		now = metav1.NewTime(time.Now().Truncate(time.Second))
+		conditions = nil
+	})
+
+	When("all the clusters report the endpoints as synced", func() {
+		BeforeEach(func() {
+			conditions = []controller.ClusterCondition{
+				newCondition("east", controller.EndpointsSynced, corev1.ConditionTrue, metav1.NewTime(now.Add(-time.Minute))),
+				newCondition("west", controller.EndpointsSynced, corev1.ConditionTrue, now),
+			}
+		})
+
+		It("should return a True condition with the latest transition time", func() {
+			aggregated := controller.AggregateEndpointsSynced(conditions)
+			Expect(aggregated.Type).To(Equal(controller.EndpointsSynced))
+			Expect(aggregated.Status).To(Equal(corev1.ConditionTrue))
+			Expect(*aggregated.Reason).To(Equal("AllClustersSynced"))
+			Expect(*aggregated.Message).To(ContainSubstring("all 2 clusters"))
+			Expect(aggregated.LastTransitionTime.Equal(&now)).To(BeTrue())
+		})
+	})
+
+	When("some clusters report the endpoints as not synced", func() {
+		BeforeEach(func() {
+			conditions = []controller.ClusterCondition{
+				newCondition("west", controller.EndpointsSynced, corev1.ConditionFalse, now),
+				newCondition("east", controller.EndpointsSynced, corev1.ConditionTrue, now),
+				newCondition("north", controller.EndpointsSynced, corev1.ConditionUnknown, now),
+				newCondition("south", controller.EndpointsSynced, corev1.ConditionFalse, now),
+			}
+		})
+
+		It("should return a False condition listing those clusters", func() {
+			aggregated := controller.AggregateEndpointsSynced(conditions)
+			Expect(aggregated.Status).To(Equal(corev1.ConditionFalse))
+			Expect(*aggregated.Reason).To(Equal("ClustersNotSynced"))
+			Expect(*aggregated.Message).To(ContainSubstring("2 of 4 clusters: [south west]"))
+		})
+	})
+
+	When("some clusters haven't yet reported whether the endpoints are synced", func() {
+		BeforeEach(func() {
+			conditions = []controller.ClusterCondition{
+				newCondition("east", controller.EndpointsSynced, corev1.ConditionTrue, now),
+				newCondition("west", controller.EndpointsSynced, corev1.ConditionUnknown, now),
+			}
+		})
+
+		It("should return an Unknown condition listing those clusters", func() {
+			aggregated := controller.AggregateEndpointsSynced(conditions)
+			Expect(aggregated.Status).To(Equal(corev1.ConditionUnknown))
+			Expect(*aggregated.Reason).To(Equal("ClustersSyncPending"))
+			Expect(*aggregated.Message).To(ContainSubstring("1 of 2 clusters: [west]"))
+		})
+	})
+
+	When("no cluster reports an EndpointsSynced condition", func() {
+		BeforeEach(func() {
+			conditions = []controller.ClusterCondition{
+				newCondition("east", mcsv1a1.ServiceExportValid, corev1.ConditionFalse, now),
+			}
+		})
+
+		It("should return an Unknown condition", func() {
+			aggregated := controller.AggregateEndpointsSynced(conditions)
+			Expect(aggregated.Status).To(Equal(corev1.ConditionUnknown))
+			Expect(*aggregated.Reason).To(Equal("NoClusters"))
+			Expect(aggregated.LastTransitionTime).To(BeNil())
+		})
+	})
+})
+
+var _ = Describe("EndpointsSynced condition", func() {
+	var t *testDriver
+
+	awaitEndpointsSynced := func(status corev1.ConditionStatus, reason, msg string) {
+		t.awaitServiceExportStatus(&mcsv1a1.ServiceExportCondition{
+			Type:    controller.EndpointsSynced,
+			Status:  status,
+			Reason:  &reason,
+			Message: &msg,
+		})
+	}
+
+	BeforeEach(func() {
+		t = newTestDiver()
+	})
+
+	JustBeforeEach(func() {
+		t.justBeforeEach()
+		t.createService()
+		t.createEndpoints()
+		t.createServiceExport()
+	})
+
+	AfterEach(func() {
+		t.afterEach()
+	})
+
+	When("the service is exported only by the local cluster", func() {
+		It("should set the ServiceExport's condition to True once the local endpoints are synced", func() {
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+			awaitEndpointsSynced(corev1.ConditionTrue, "AllClustersSynced", "The endpoints are synced in all 1 clusters")
+		})
+
+		It("should record the local cluster's condition on the ServiceImport synced to the other clusters", func() {
+			Eventually(func() corev1.ConditionStatus {
+				obj, err := t.cluster2.localServiceImportClient.Get(context.TODO(),
+					t.service.Name+"-"+t.service.Namespace+"-"+clusterID1, metav1.GetOptions{})
+				if err != nil {
+					return ""
+				}
+
+				condition := &mcsv1a1.ServiceExportCondition{}
+				if json.Unmarshal([]byte(obj.GetAnnotations()[lhconstants.EndpointsSyncedAnnotation]), condition) != nil {
+					return ""
+				}
+
+				return condition.Status
+			}, 5).Should(Equal(corev1.ConditionTrue))
+		})
+	})
+
+	When("another cluster also exports the service", func() {
+		remoteName := func() string {
+			return t.service.Name + "-" + t.service.Namespace + "-" + clusterID2
+		}
+
+		setRemoteEndpointsSynced := func(status corev1.ConditionStatus) {
+			now := metav1.Now()
+			reason := "Reported"
+			msg := "Reported by " + clusterID2
+
+			encoded, err := json.Marshal(&mcsv1a1.ServiceExportCondition{
+				Type:               controller.EndpointsSynced,
+				Status:             status,
+				LastTransitionTime: &now,
+				Reason:             &reason,
+				Message:            &msg,
+			})
+			Expect(err).To(Succeed())
+
+			obj, err := t.brokerServiceImportClient.Get(context.TODO(), remoteName(), metav1.GetOptions{})
+			Expect(err).To(Succeed())
+
+			annotations := obj.GetAnnotations()
+			annotations[lhconstants.EndpointsSyncedAnnotation] = string(encoded)
+			obj.SetAnnotations(annotations)
+
+			_, err = t.brokerServiceImportClient.Update(context.TODO(), obj, metav1.UpdateOptions{})
+			Expect(err).To(Succeed())
+		}
+
+		JustBeforeEach(func() {
+			test.CreateResource(t.brokerServiceImportClient, &mcsv1a1.ServiceImport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: remoteName(),
+					Annotations: map[string]string{
+						lhconstants.OriginName:      t.service.Name,
+						lhconstants.OriginNamespace: t.service.Namespace,
+					},
+					Labels: map[string]string{
+						lhconstants.LighthouseLabelSourceName:    t.service.Name,
+						lhconstants.LabelSourceNamespace:         t.service.Namespace,
+						lhconstants.LighthouseLabelSourceCluster: clusterID2,
+						federate.ClusterIDLabelKey:               clusterID2,
+					},
+				},
+				Spec: mcsv1a1.ServiceImportSpec{
+					Type: mcsv1a1.ClusterSetIP,
+					IPs:  []string{"10.253.9.2"},
+				},
+			})
+
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+		})
+
+		It("should set the ServiceExport's condition to Unknown until the other cluster reports its endpoints as synced", func() {
+			awaitEndpointsSynced(corev1.ConditionUnknown, "ClustersSyncPending",
+				"The endpoints sync is pending in 1 of 2 clusters: [west]")
+
+			setRemoteEndpointsSynced(corev1.ConditionTrue)
+			awaitEndpointsSynced(corev1.ConditionTrue, "AllClustersSynced", "The endpoints are synced in all 2 clusters")
+		})
+
+		It("should set the ServiceExport's condition to False if the other cluster reports its endpoints as not synced", func() {
+			setRemoteEndpointsSynced(corev1.ConditionFalse)
+			awaitEndpointsSynced(corev1.ConditionFalse, "ClustersNotSynced", "The endpoints aren't synced in 1 of 2 clusters: [west]")
+		})
+
+		It("should no longer account for the other cluster once it unexports the service", func() {
+			setRemoteEndpointsSynced(corev1.ConditionFalse)
+			awaitEndpointsSynced(corev1.ConditionFalse, "ClustersNotSynced", "The endpoints aren't synced in 1 of 2 clusters: [west]")
+
+			Expect(t.brokerServiceImportClient.Delete(context.TODO(), remoteName(), metav1.DeleteOptions{})).To(Succeed())
+			awaitEndpointsSynced(corev1.ConditionTrue, "AllClustersSynced", "The endpoints are synced in all 1 clusters")
+		})
+	})
+})
@@ -28,12 +28,18 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// newGlobalIngressIPCache creates a cache of the GlobalIngressIPs in the given namespaces or, if none are given, in
+// all namespaces.
 // nolint:gocritic // (hugeParam) This function modifies config so we don't want to pass by pointer.
-func newGlobalIngressIPCache(config watcher.Config) (*globalIngressIPCache, error) {
+func newGlobalIngressIPCache(config watcher.Config, namespaces []string) (*globalIngressIPCache, error) {
 	c := &globalIngressIPCache{}
 
-	config.ResourceConfigs = []watcher.ResourceConfig{
-		{
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, namespace := range namespaces {
+		config.ResourceConfigs = append(config.ResourceConfigs, watcher.ResourceConfig{
 			Name:         "GlobalIngressIP watcher",
 			ResourceType: GetGlobalIngressIPObj(),
 			Handler: watcher.EventHandlerFuncs{
@@ -50,8 +56,8 @@ func newGlobalIngressIPCache(config watcher.Config) (*globalIngressIPCache, erro
 					return false
 				},
 			},
-			SourceNamespace: metav1.NamespaceAll,
-		},
+			SourceNamespace: namespace,
+		})
 	}
 
 	var err error
@@ -20,7 +20,7 @@ package controller
 
 import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/klog"
+	"k8s.io/klog/v2"
 )
 
 const (
@@ -49,7 +49,7 @@ func parseIngressIP(obj *unstructured.Unstructured) *IngressIP {
 
 	gip.target, found, err = unstructured.NestedString(obj.Object, "spec", "target")
 	if !found || err != nil {
-		klog.Errorf("target field not found in spec %#v", obj.Object)
+		klog.ErrorS(err, "target field not found in spec", "globalIngressIP", klog.KObj(obj), "spec", obj.Object)
 		return nil
 	}
 
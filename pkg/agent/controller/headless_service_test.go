@@ -19,8 +19,26 @@ limitations under the License.
 package controller_test
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/fake"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
 	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/testing"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
 var _ = Describe("Headless service syncing", func() {
@@ -63,6 +81,231 @@ var _ = Describe("Headless service syncing", func() {
 		})
 	})
 
+	When("multiple ServiceImport workers are configured", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.Concurrency = 4
+		})
+
+		It("should correctly sync a ServiceImport and EndpointSlice", func() {
+			t.createEndpoints()
+			t.createServiceExport()
+
+			t.awaitHeadlessServiceImport()
+			t.awaitEndpointSlice()
+		})
+	})
+
+	When("the number of endpoints exceeds the configured maximum per EndpointSlice", func() {
+		awaitEndpointCount := func(name string, expected int) {
+			Eventually(func() int {
+				obj, err := t.cluster2.localEndpointSliceClient.Get(context.TODO(), name, metav1.GetOptions{})
+				if err != nil {
+					return -1
+				}
+
+				endpoints, _, _ := unstructured.NestedSlice(obj.Object, "endpoints")
+
+				return len(endpoints)
+			}, 5).Should(Equal(expected))
+		}
+
+		BeforeEach(func() {
+			t.cluster1.agentSpec.MaxEndpointsPerSlice = 2
+		})
+
+		It("should split the endpoints across multiple EndpointSlices", func() {
+			t.createEndpoints()
+			t.createServiceExport()
+
+			t.awaitHeadlessServiceImport()
+
+			name := t.endpoints.Name + "-" + clusterID1
+
+			awaitEndpointCount(name, 2)
+			awaitEndpointCount(name+".1", 1)
+
+			By("Adding endpoints")
+
+			t.endpoints.Subsets[0].Addresses = append(t.endpoints.Subsets[0].Addresses,
+				corev1.EndpointAddress{IP: "192.168.5.3"}, corev1.EndpointAddress{IP: "192.168.5.4"})
+			t.updateEndpoints()
+
+			awaitEndpointCount(name, 2)
+			awaitEndpointCount(name+".1", 2)
+			awaitEndpointCount(name+".2", 1)
+
+			By("Removing endpoints")
+
+			t.endpoints.Subsets[0].Addresses = t.endpoints.Subsets[0].Addresses[:2]
+			t.updateEndpoints()
+
+			awaitEndpointCount(name+".1", 1)
+			test.AwaitNoResource(t.cluster1.localEndpointSliceClient, name+".2")
+			test.AwaitNoResource(t.cluster2.localEndpointSliceClient, name+".2")
+
+			By("Deleting the ServiceExport")
+
+			t.deleteServiceExport()
+
+			test.AwaitNoResource(t.cluster1.localEndpointSliceClient, name+".1")
+		})
+	})
+
+	When("a pod listed as ready by the Endpoints isn't ready", func() {
+		JustBeforeEach(func() {
+			// The Endpoints of a service that publishes its not-ready addresses list them as ready.
+			pod := newPod("two")
+			pod.Status.Conditions[0].Status = corev1.ConditionFalse
+			t.createPod(pod)
+
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+		})
+
+		Context("and the service doesn't publish its not-ready addresses", func() {
+			It("should publish the endpoints with the readiness from the Endpoints", func() {
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": true,
+					"10.253.6.1":  false,
+				})
+			})
+		})
+
+		Context("and the service publishes its not-ready addresses", func() {
+			BeforeEach(func() {
+				t.service.Spec.PublishNotReadyAddresses = true
+			})
+
+			It("should include the not-ready endpoints without marking them ready", func() {
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": false,
+					"10.253.6.1":  false,
+				})
+			})
+		})
+
+		Context("and the service's publishNotReadyAddresses is toggled", func() {
+			It("should update the readiness of the endpoints", func() {
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": true,
+					"10.253.6.1":  false,
+				})
+
+				t.service.Spec.PublishNotReadyAddresses = true
+				t.updateService()
+
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": false,
+					"10.253.6.1":  false,
+				})
+
+				t.service.Spec.PublishNotReadyAddresses = false
+				t.updateService()
+
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": true,
+					"10.253.6.1":  false,
+				})
+			})
+		})
+	})
+
+	When("the pods of the service are watched", func() {
+		podListSelectors := func() []string {
+			selectors := []string{}
+
+			for _, action := range t.cluster1.localDynClient.(*fake.DynamicClient).Actions() {
+				if action.GetVerb() == "list" && action.GetResource().Resource == "pods" {
+					selectors = append(selectors, action.(testing.ListAction).GetListRestrictions().Labels.String())
+				}
+			}
+
+			return selectors
+		}
+
+		JustBeforeEach(func() {
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+		})
+
+		It("should only watch those selected by the service", func() {
+			Eventually(t.cluster1.agentController.EndpointControllers, 5).Should(HaveLen(1))
+			Expect(podListSelectors()).To(HaveEach("app=test"))
+
+			By("Updating the service's selector")
+
+			t.service.Spec.Selector = map[string]string{"app": "other"}
+			t.updateService()
+
+			Eventually(podListSelectors, 5).Should(ContainElement("app=other"))
+			Expect(podListSelectors()).To(HaveEach(Or(Equal("app=test"), Equal("app=other"))))
+		})
+	})
+
+	When("the service is dual-stack", func() {
+		awaitEndpointSliceIPs := func(name string, addressType discovery.AddressType, expectedIPs ...string) {
+			Eventually(func() []string {
+				obj, err := t.cluster2.localEndpointSliceClient.Get(context.TODO(), name, metav1.GetOptions{})
+				if err != nil {
+					return nil
+				}
+
+				endpointSlice := &discovery.EndpointSlice{}
+				Expect(scheme.Scheme.Convert(obj, endpointSlice, nil)).To(Succeed())
+
+				if endpointSlice.AddressType != addressType {
+					return nil
+				}
+
+				ips := []string{}
+				for i := range endpointSlice.Endpoints {
+					ips = append(ips, endpointSlice.Endpoints[i].Addresses...)
+				}
+
+				return ips
+			}, 5).Should(ConsistOf(expectedIPs))
+		}
+
+		BeforeEach(func() {
+			t.service.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+		})
+
+		It("should sync an EndpointSlice for each IP family", func() {
+			for name, ips := range map[string][]string{"one": {"192.168.5.1", "fd00::1"}, "two": {"192.168.5.2", "fd00::2"}} {
+				pod := newPod(name)
+				for _, ip := range ips {
+					pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+				}
+
+				t.createPod(pod)
+			}
+
+			t.createEndpoints()
+			t.createServiceExport()
+
+			Expect(t.awaitBrokerServiceImport(mcsv1a1.Headless, "").Annotations).To(
+				HaveKeyWithValue(lhconstants.IPFamiliesAnnotation, "IPv4,IPv6"))
+
+			name := t.endpoints.Name + "-" + clusterID1
+
+			awaitEndpointSliceIPs(name, discovery.AddressTypeIPv4, "192.168.5.1", "192.168.5.2", "10.253.6.1")
+			awaitEndpointSliceIPs(name+".ipv6", discovery.AddressTypeIPv6, "fd00::1", "fd00::2")
+
+			By("Deleting the ServiceExport")
+
+			t.deleteServiceExport()
+
+			test.AwaitNoResource(t.cluster1.localEndpointSliceClient, name+".ipv6")
+		})
+	})
+
 	When("the Endpoints for a service are updated", func() {
 		It("should update the ServiceImport and EndpointSlice", func() {
 			t.createEndpoints()
@@ -78,6 +321,447 @@ var _ = Describe("Headless service syncing", func() {
 		})
 	})
 
+	When("a pod backing an endpoint is terminating", func() {
+		It("should mark the endpoint as terminating and not ready", func() {
+			pod := newPod("one")
+			t.createPod(pod)
+			t.createPod(newPod("two"))
+
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+
+			t.awaitEndpointSliceReadiness(map[string]bool{
+				"192.168.5.1": true,
+				"192.168.5.2": true,
+				"10.253.6.1":  false,
+			})
+
+			now := metav1.Now()
+			pod.DeletionTimestamp = &now
+			t.updatePod(pod)
+
+			t.awaitEndpointSliceReadiness(map[string]bool{
+				"192.168.5.1": false,
+				"192.168.5.2": true,
+				"10.253.6.1":  false,
+			})
+
+			obj, err := t.cluster2.localEndpointSliceClient.Get(context.TODO(), t.endpoints.Name+"-"+clusterID1, metav1.GetOptions{})
+			Expect(err).To(Succeed())
+
+			endpointSlice := &discovery.EndpointSlice{}
+			Expect(scheme.Scheme.Convert(obj, endpointSlice, nil)).To(Succeed())
+
+			serving, terminating := true, true
+			Expect(endpointSlice.Endpoints[0].Conditions).To(Equal(discovery.EndpointConditions{
+				Ready:       &notReady,
+				Serving:     &serving,
+				Terminating: &terminating,
+			}))
+		})
+	})
+
+	When("topology publishing is enabled", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.PublishTopology = true
+		})
+
+		It("should publish the zone of each endpoint whose node has a zone label", func() {
+			zone := "zone-a"
+			unlabeledNodeName := "unlabeled-node"
+
+			nodes := t.cluster1.localDynClient.Resource(corev1.SchemeGroupVersion.WithResource("nodes"))
+			test.CreateResource(nodes, &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   nodeName,
+					Labels: map[string]string{corev1.LabelTopologyZone: zone},
+				},
+			})
+			test.CreateResource(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: unlabeledNodeName}})
+
+			t.endpoints.Subsets[0].NotReadyAddresses[0].NodeName = &unlabeledNodeName
+
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+
+			var endpointSlice *discovery.EndpointSlice
+
+			Eventually(func() *string {
+				obj, err := t.cluster2.localEndpointSliceClient.Get(context.TODO(), t.endpoints.Name+"-"+clusterID1, metav1.GetOptions{})
+				if err != nil {
+					return nil
+				}
+
+				endpointSlice = &discovery.EndpointSlice{}
+				Expect(scheme.Scheme.Convert(obj, endpointSlice, nil)).To(Succeed())
+				Expect(endpointSlice.Endpoints).To(HaveLen(3))
+
+				return endpointSlice.Endpoints[1].Zone
+			}, 5).Should(Equal(&zone))
+
+			Expect(endpointSlice.Endpoints[1].Hints).To(Equal(&discovery.EndpointHints{
+				ForZones: []discovery.ForZone{{Name: zone}},
+			}))
+
+			Expect(endpointSlice.Endpoints[0].Zone).To(BeNil())
+			Expect(endpointSlice.Endpoints[0].Hints).To(BeNil())
+			Expect(endpointSlice.Endpoints[2].Zone).To(BeNil())
+			Expect(endpointSlice.Endpoints[2].Hints).To(BeNil())
+		})
+	})
+
+	When("readiness gates are configured", func() {
+		const readinessGate = corev1.PodConditionType("example.io/app-ready")
+
+		var pod *corev1.Pod
+
+		BeforeEach(func() {
+			t.cluster1.agentSpec.ReadinessGates = []string{string(readinessGate)}
+		})
+
+		JustBeforeEach(func() {
+			t.createPod(newPod("one", corev1.PodCondition{Type: readinessGate, Status: corev1.ConditionTrue}))
+
+			pod = newPod("two", corev1.PodCondition{Type: readinessGate, Status: corev1.ConditionFalse})
+			t.createPod(pod)
+
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+		})
+
+		It("should mark an endpoint as not ready if its pod fails a readiness gate", func() {
+			t.awaitEndpointSliceReadiness(map[string]bool{
+				"192.168.5.1": true,
+				"192.168.5.2": false,
+				"10.253.6.1":  false,
+			})
+		})
+
+		Context("and the readiness gate condition later passes", func() {
+			It("should update the EndpointSlice", func() {
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": false,
+					"10.253.6.1":  false,
+				})
+
+				pod.Status.Conditions[1].Status = corev1.ConditionTrue
+				t.updatePod(pod)
+
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": true,
+					"10.253.6.1":  false,
+				})
+			})
+		})
+	})
+
+	When("an endpoint pod selector is configured", func() {
+		var pod *corev1.Pod
+
+		BeforeEach(func() {
+			t.serviceExport.SetAnnotations(map[string]string{lhconstants.EndpointPodSelectorAnnotation: "expose-externally=true"})
+		})
+
+		JustBeforeEach(func() {
+			exposed := map[string]string{"expose-externally": "true"}
+
+			t.createPod(newPodWithLabels("one", exposed))
+			t.createPod(newPodWithLabels("not-ready", exposed))
+
+			pod = newPodWithLabels("two", map[string]string{"expose-externally": "false"})
+			t.createPod(pod)
+
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+		})
+
+		It("should only include the endpoints whose pods match the selector", func() {
+			t.awaitEndpointSliceReadiness(map[string]bool{
+				"192.168.5.1": true,
+				"10.253.6.1":  false,
+			})
+		})
+
+		Context("and a pod's labels are later updated to match", func() {
+			It("should update the EndpointSlice", func() {
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"10.253.6.1":  false,
+				})
+
+				pod.Labels["expose-externally"] = "true"
+				t.updatePod(pod)
+
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": true,
+					"10.253.6.1":  false,
+				})
+			})
+		})
+
+		Context("and the selector is later updated", func() {
+			It("should update the EndpointSlice", func() {
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"10.253.6.1":  false,
+				})
+
+				t.updateServiceExportAnnotations(map[string]string{lhconstants.EndpointPodSelectorAnnotation: "expose-externally=false"})
+
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.2": true,
+				})
+			})
+		})
+	})
+
+	When("endpoint metadata keys are configured", func() {
+		var pod *corev1.Pod
+
+		awaitEndpointMetadata := func(expected map[string]map[string]string) {
+			Eventually(func() map[string]map[string]string {
+				obj, err := t.cluster2.localEndpointSliceClient.Get(context.TODO(), t.endpoints.Name+"-"+clusterID1, metav1.GetOptions{})
+				if err != nil {
+					return nil
+				}
+
+				metadata := map[string]map[string]string{}
+
+				value, ok := obj.GetAnnotations()[lhconstants.EndpointMetadataAnnotation]
+				if ok {
+					Expect(json.Unmarshal([]byte(value), &metadata)).To(Succeed())
+				}
+
+				return metadata
+			}, 5).Should(Equal(expected))
+		}
+
+		BeforeEach(func() {
+			t.cluster1.agentSpec.EndpointMetadataKeys = []string{"zone", "version"}
+		})
+
+		JustBeforeEach(func() {
+			pod = newPodWithLabels("one", map[string]string{"zone": "zone-a", "app": "test"})
+			pod.Annotations = map[string]string{"version": "v2"}
+			t.createPod(pod)
+
+			t.createPod(newPodWithLabels("two", map[string]string{"app": "test"}))
+			t.createPod(newPodWithLabels("not-ready", map[string]string{"zone": "zone-b"}))
+
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+		})
+
+		It("should publish the configured pod labels and annotations for each endpoint", func() {
+			awaitEndpointMetadata(map[string]map[string]string{
+				"192.168.5.1": {"zone": "zone-a", "version": "v2"},
+				"10.253.6.1":  {"zone": "zone-b"},
+			})
+		})
+
+		Context("and a pod's labels are later updated", func() {
+			It("should update the EndpointSlice", func() {
+				awaitEndpointMetadata(map[string]map[string]string{
+					"192.168.5.1": {"zone": "zone-a", "version": "v2"},
+					"10.253.6.1":  {"zone": "zone-b"},
+				})
+
+				pod.Labels["zone"] = "zone-c"
+				t.updatePod(pod)
+
+				awaitEndpointMetadata(map[string]map[string]string{
+					"192.168.5.1": {"zone": "zone-c", "version": "v2"},
+					"10.253.6.1":  {"zone": "zone-b"},
+				})
+			})
+		})
+
+		Context("and the metadata exceeds the size limit", func() {
+			BeforeEach(func() {
+				t.cluster1.agentSpec.EndpointMetadataKeys = []string{"notes"}
+			})
+
+			JustBeforeEach(func() {
+				notes := strings.Repeat("x", 70*1024)
+
+				two := newPodWithLabels("two", map[string]string{"app": "test"})
+				two.Annotations = map[string]string{"notes": notes}
+				t.updatePod(two)
+
+				pod.Annotations = map[string]string{"notes": notes}
+				t.updatePod(pod)
+			})
+
+			It("should omit the metadata of the endpoints beyond the limit", func() {
+				awaitEndpointMetadata(map[string]map[string]string{
+					"192.168.5.1": {"notes": strings.Repeat("x", 70*1024)},
+				})
+			})
+		})
+	})
+
+	When("an endpoint filter is configured", func() {
+		var pod *corev1.Pod
+
+		BeforeEach(func() {
+			t.cluster1.endpointFilter = controller.ExcludeAnnotatedPods
+		})
+
+		JustBeforeEach(func() {
+			t.createPod(newPodWithLabels("one", nil))
+			t.createPod(newPodWithLabels("not-ready", nil))
+
+			pod = newPodWithLabels("two", nil)
+			pod.Annotations = map[string]string{lhconstants.EndpointExcludeAnnotation: "true"}
+			t.createPod(pod)
+
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+		})
+
+		It("should exclude the endpoints whose pods it rejects", func() {
+			t.awaitEndpointSliceReadiness(map[string]bool{
+				"192.168.5.1": true,
+				"10.253.6.1":  false,
+			})
+		})
+
+		Context("and a pod is later updated to pass it", func() {
+			It("should update the EndpointSlice", func() {
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"10.253.6.1":  false,
+				})
+
+				pod.Annotations = nil
+				t.updatePod(pod)
+
+				t.awaitEndpointSliceReadiness(map[string]bool{
+					"192.168.5.1": true,
+					"192.168.5.2": true,
+					"10.253.6.1":  false,
+				})
+			})
+		})
+	})
+
+	When("an invalid endpoint pod selector is configured", func() {
+		BeforeEach(func() {
+			t.serviceExport.SetAnnotations(map[string]string{lhconstants.EndpointPodSelectorAnnotation: "expose-externally in (true"})
+		})
+
+		It("should update the ServiceExport status and not export the service", func() {
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitServiceExportStatus(newServiceExportCondition(corev1.ConditionFalse, "InvalidEndpointPodSelector"))
+			t.awaitNoServiceImport(t.brokerServiceImportClient)
+		})
+
+		Context("and the selector is later corrected", func() {
+			It("should export the service", func() {
+				t.createEndpoints()
+				t.createServiceExport()
+				t.awaitServiceExportStatus(newServiceExportCondition(corev1.ConditionFalse, "InvalidEndpointPodSelector"))
+
+				t.updateServiceExportAnnotations(map[string]string{lhconstants.EndpointPodSelectorAnnotation: "expose-externally in (true)"})
+
+				t.awaitHeadlessServiceImport()
+				t.awaitServiceExportStatus(newServiceExportCondition(corev1.ConditionTrue, ""))
+			})
+		})
+	})
+
+	When("a local ServiceImport is deleted", func() {
+		It("should stop its EndpointController and delete the EndpointSlice", func() {
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitHeadlessServiceImport()
+			t.awaitEndpointSlice()
+
+			Expect(t.cluster1.localServiceImportClient.Delete(context.TODO(), t.service.Name+"-"+t.service.Namespace+"-"+clusterID1,
+				metav1.DeleteOptions{})).To(Succeed())
+			t.awaitNoEndpointSlice(t.cluster1.localEndpointSliceClient)
+
+			t.endpoints.Subsets[0].Addresses = append(t.endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: "192.168.5.10"})
+			t.updateEndpoints()
+
+			time.Sleep(300 * time.Millisecond)
+			t.awaitNoEndpointSlice(t.cluster1.localEndpointSliceClient)
+		})
+	})
+
+	When("a ServiceExport lists multiple origin namespaces", func() {
+		const otherNamespace = "other-service-ns"
+
+		var serviceImportName string
+
+		endpointSliceClient := func(c *cluster, namespace string) dynamic.ResourceInterface {
+			return c.localDynClient.Resource(discovery.SchemeGroupVersion.WithResource("endpointslices")).Namespace(namespace)
+		}
+
+		BeforeEach(func() {
+			t.serviceExport.Annotations = map[string]string{lhconstants.OriginNamespacesAnnotation: otherNamespace + ", " + serviceNamespace}
+			serviceImportName = t.service.Name + "-" + t.service.Namespace + "-" + clusterID1
+		})
+
+		JustBeforeEach(func() {
+			t.createEndpoints()
+
+			otherEndpoints := t.endpoints.DeepCopy()
+			otherEndpoints.Namespace = otherNamespace
+			otherEndpoints.Subsets[0].Addresses = []corev1.EndpointAddress{{IP: "192.168.5.20"}}
+			test.CreateResource(t.cluster1.localDynClient.Resource(corev1.SchemeGroupVersion.WithResource("endpoints")).
+				Namespace(otherNamespace), otherEndpoints)
+
+			t.createServiceExport()
+		})
+
+		It("should sync the EndpointSlices of each namespace to the other clusters", func() {
+			for _, c := range []*cluster{&t.cluster1, &t.cluster2} {
+				serviceImport := c.awaitServiceImport(t.service, mcsv1a1.Headless, "")
+				Expect(serviceImport.Annotations).To(HaveKeyWithValue(lhconstants.OriginNamespacesAnnotation,
+					serviceNamespace+","+otherNamespace))
+
+				for _, namespace := range []string{serviceNamespace, otherNamespace} {
+					endpointSlice := test.AwaitResource(endpointSliceClient(c, namespace),
+						t.endpoints.Name+"."+namespace+"-"+clusterID1)
+					Expect(endpointSlice.GetLabels()).To(HaveKeyWithValue(lhconstants.LabelServiceImportName, serviceImportName))
+					Expect(endpointSlice.GetLabels()).To(HaveKeyWithValue(lhconstants.LabelSourceNamespace, namespace))
+				}
+			}
+
+			By("Deleting the ServiceExport")
+
+			t.deleteServiceExport()
+
+			for _, c := range []*cluster{&t.cluster1, &t.cluster2} {
+				for _, namespace := range []string{serviceNamespace, otherNamespace} {
+					test.AwaitNoResource(endpointSliceClient(c, namespace), t.endpoints.Name+"."+namespace+"-"+clusterID1)
+				}
+			}
+		})
+
+		Context("and one of them isn't watched", func() {
+			BeforeEach(func() {
+				t.cluster1.agentSpec.WatchNamespaces = []string{serviceNamespace}
+			})
+
+			It("should update the ServiceExport status and not sync a ServiceImport", func() {
+				t.awaitServiceExportStatus(newServiceExportCondition(corev1.ConditionFalse, "InvalidOriginNamespaces"))
+				t.awaitNoServiceImport(t.cluster1.localServiceImportClient)
+			})
+		})
+	})
+
 	When("a ServiceExport is deleted", func() {
 		It("should delete the ServiceImport and EndpointSlice", func() {
 			t.createEndpoints()
@@ -88,5 +772,38 @@ var _ = Describe("Headless service syncing", func() {
 			t.deleteServiceExport()
 			t.awaitHeadlessServiceUnexported()
 		})
+
+		Context("and listing the EndpointSlices to delete initially fails", func() {
+			It("should retry until the EndpointSlice is deleted", func() {
+				t.createEndpoints()
+				t.createServiceExport()
+				t.awaitHeadlessServiceImport()
+				t.awaitEndpointSlice()
+
+				// Only fail once the informers have listed the EndpointSlices, so it's the deletion's list that fails.
+				fake.FailOnAction(&t.cluster1.localDynClient.(*fake.DynamicClient).Fake, "endpointslices", "list",
+					apierrors.NewServiceUnavailable("fake"), true)
+
+				t.deleteServiceExport()
+				t.awaitHeadlessServiceUnexported()
+			})
+		})
+
+		Context("and deleting the EndpointSlice initially fails", func() {
+			BeforeEach(func() {
+				fake.FailOnAction(&t.cluster1.localDynClient.(*fake.DynamicClient).Fake, "endpointslices", "delete",
+					apierrors.NewServiceUnavailable("fake"), true)
+			})
+
+			It("should retry until the EndpointSlice is deleted", func() {
+				t.createEndpoints()
+				t.createServiceExport()
+				t.awaitHeadlessServiceImport()
+				t.awaitEndpointSlice()
+
+				t.deleteServiceExport()
+				t.awaitHeadlessServiceUnexported()
+			})
+		})
 	})
 })
@@ -0,0 +1,65 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import "sync"
+
+// keyedMutex provides mutual exclusion per key. The per-key mutexes are reference counted so they're removed once no
+// longer in use.
+type keyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*refCountedMutex
+}
+
+type refCountedMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the mutex for the given key and returns the function that unlocks it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mutex.Lock()
+
+	if k.locks == nil {
+		k.locks = map[string]*refCountedMutex{}
+	}
+
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refCountedMutex{}
+		k.locks[key] = m
+	}
+
+	m.refs++
+	k.mutex.Unlock()
+
+	m.Lock()
+
+	return func() {
+		m.Unlock()
+
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+
+		m.refs--
+		if m.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
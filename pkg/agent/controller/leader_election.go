@@ -0,0 +1,119 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultLeaderElectionLeaseName = "lighthouse-agent"
+
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// ErrLeadershipLost is returned by RunWithLeaderElection if the leadership was lost before the context was done.
+var ErrLeadershipLost = errors.New("leader election lost")
+
+// RunWithLeaderElection blocks contending for the leader election Lease with the given identity and runs the agent
+// controllers while this replica is the leader, so only one of multiple agent replicas processes the ServiceExports
+// and ServiceImports. The controllers are stopped, and all EndpointControllers with them, when the given context is
+// done or the leadership is lost. The agent can't be restarted once stopped so, if the leadership is lost,
+// ErrLeadershipLost is returned and the caller is expected to exit.
+func (a *Controller) RunWithLeaderElection(ctx context.Context, identity string) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      a.leaseName,
+			Namespace: a.leaseNamespace,
+		},
+		Client: a.kubeClientSet.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	started := make(chan struct{})
+	startResult := make(chan error, 1)
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            a.leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leadingCtx context.Context) {
+				klog.InfoS("Acquired the leader election Lease", "lease", klog.KRef(a.leaseNamespace, a.leaseName), "identity", identity)
+				close(started)
+
+				err := a.Start(leadingCtx)
+				if err != nil {
+					cancel()
+				}
+
+				startResult <- err
+			},
+			OnStoppedLeading: func() {
+				klog.InfoS("No longer the leader - stopping the controllers", "lease", klog.KRef(a.leaseNamespace, a.leaseName))
+			},
+			OnNewLeader: func(current string) {
+				if current != identity {
+					klog.InfoS("New leader elected", "lease", klog.KRef(a.leaseNamespace, a.leaseName), "leader", current)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating the leader elector")
+	}
+
+	// Run returns once the context is done or, if the Lease was acquired, once the leadership is lost.
+	elector.Run(leaderCtx)
+
+	select {
+	case <-started:
+	default:
+		return nil
+	}
+
+	if err := <-startResult; err != nil {
+		return err
+	}
+
+	<-a.serviceImportController.stopped
+
+	if ctx.Err() == nil {
+		return ErrLeadershipLost
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Leader election", func() {
+	const identity = "east-agent-1"
+
+	var (
+		t         *testDriver
+		ctx       context.Context
+		cancel    context.CancelFunc
+		runResult chan error
+	)
+
+	BeforeEach(func() {
+		t = newTestDiver()
+		t.doStart = false
+		ctx, cancel = context.WithCancel(context.Background())
+		runResult = make(chan error, 1)
+	})
+
+	JustBeforeEach(func() {
+		t.justBeforeEach()
+		Expect(t.cluster2.agentController.Start(t.ctx)).To(Succeed())
+
+		agentController, runCtx, result := t.cluster1.agentController, ctx, runResult
+
+		go func() {
+			result <- agentController.RunWithLeaderElection(runCtx, identity)
+		}()
+
+		t.createService()
+		t.createEndpoints()
+		t.createServiceExport()
+	})
+
+	AfterEach(func() {
+		cancel()
+		t.afterEach()
+	})
+
+	getLease := func() (*coordinationv1.Lease, error) {
+		return t.cluster1.localKubeClient.CoordinationV1().Leases(t.cluster1.agentSpec.Namespace).Get(context.TODO(),
+			controller.DefaultLeaderElectionLeaseName, metav1.GetOptions{})
+	}
+
+	When("no other replica holds the Lease", func() {
+		It("should acquire the Lease and run the controllers", func() {
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+			t.cluster1.awaitEndpointSlice(t)
+			Expect(t.cluster1.agentController.Ready()).To(BeTrue())
+
+			lease, err := getLease()
+			Expect(err).To(Succeed())
+			Expect(*lease.Spec.HolderIdentity).To(Equal(identity))
+		})
+
+		Context("and the context is subsequently done", func() {
+			It("should stop the EndpointControllers and return", func() {
+				t.cluster1.awaitEndpointSlice(t)
+
+				cancel()
+
+				Eventually(runResult, 5*time.Second).Should(Receive(BeNil()))
+				Eventually(t.cluster1.agentController.Ready).Should(BeFalse())
+				test.AwaitNoResource(t.cluster1.localEndpointSliceClient, t.endpoints.Name+"-"+clusterID1)
+			})
+		})
+	})
+
+	When("another replica holds the Lease", func() {
+		BeforeEach(func() {
+			holder := "east-agent-2"
+			duration := int32(60)
+			now := metav1.NewMicroTime(time.Now())
+
+			_, err := t.cluster1.localKubeClient.CoordinationV1().Leases(t.cluster1.agentSpec.Namespace).Create(context.TODO(),
+				&coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{Name: controller.DefaultLeaderElectionLeaseName},
+					Spec: coordinationv1.LeaseSpec{
+						HolderIdentity:       &holder,
+						LeaseDurationSeconds: &duration,
+						AcquireTime:          &now,
+						RenewTime:            &now,
+					},
+				}, metav1.CreateOptions{})
+			Expect(err).To(Succeed())
+		})
+
+		It("should not run the controllers", func() {
+			Consistently(func() error {
+				_, err := t.cluster1.localServiceImportClient.Get(context.TODO(),
+					t.service.Name+"-"+t.service.Namespace+"-"+clusterID1, metav1.GetOptions{})
+				return err
+			}, 500*time.Millisecond).ShouldNot(Succeed())
+
+			Expect(t.cluster1.agentController.Ready()).To(BeFalse())
+
+			_, err := t.cluster1.localEndpointSliceClient.Get(context.TODO(), t.endpoints.Name+"-"+clusterID1,
+				metav1.GetOptions{})
+			Expect(err).ToNot(Succeed())
+		})
+	})
+})
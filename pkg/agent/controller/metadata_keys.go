@@ -0,0 +1,68 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+)
+
+// DefaultLabelPrefix is the prefix of the keys of the Lighthouse labels and annotations set on the generated
+// ServiceImports and EndpointSlices, that of the lhconstants keys.
+const DefaultLabelPrefix = lhconstants.DefaultLabelPrefix
+
+// metadataKeys are the keys of the Lighthouse labels and annotations the agent sets on the ServiceImports and
+// EndpointSlices it generates, and reads back from them, under the configured prefix. The annotations set by the user
+// on the exported Services, ServiceExports and pods keep the lhconstants keys.
+type metadataKeys struct {
+	sourceName              string
+	sourceNamespace         string
+	sourceCluster           string
+	serviceImportName       string
+	ipFamilyPolicy          string
+	ipFamilies              string
+	clusterSetTrafficPolicy string
+	endpointPodSelector     string
+	exportTimestamp         string
+	endpointMetadata        string
+	originNamespaces        string
+	endpointsSynced         string
+}
+
+// newMetadataKeys returns the metadataKeys under the given prefix or, if empty, DefaultLabelPrefix. The DNS server reads
+// the keys under the same prefix, as derived by lhconstants.WithLabelPrefix.
+func newMetadataKeys(prefix string) *metadataKeys {
+	withPrefix := func(key string) string {
+		return lhconstants.WithLabelPrefix(prefix, key)
+	}
+
+	return &metadataKeys{
+		sourceName:              withPrefix(lhconstants.LighthouseLabelSourceName),
+		sourceNamespace:         withPrefix(lhconstants.LabelSourceNamespace),
+		sourceCluster:           withPrefix(lhconstants.LighthouseLabelSourceCluster),
+		serviceImportName:       withPrefix(lhconstants.LabelServiceImportName),
+		ipFamilyPolicy:          withPrefix(lhconstants.IPFamilyPolicyAnnotation),
+		ipFamilies:              withPrefix(lhconstants.IPFamiliesAnnotation),
+		clusterSetTrafficPolicy: withPrefix(lhconstants.ClusterSetTrafficPolicyAnnotation),
+		endpointPodSelector:     withPrefix(lhconstants.EndpointPodSelectorAnnotation),
+		exportTimestamp:         withPrefix(lhconstants.ExportTimestampAnnotation),
+		endpointMetadata:        withPrefix(lhconstants.EndpointMetadataAnnotation),
+		originNamespaces:        withPrefix(lhconstants.OriginNamespacesAnnotation),
+		endpointsSynced:         withPrefix(lhconstants.EndpointsSyncedAnnotation),
+	}
+}
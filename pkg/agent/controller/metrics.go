@@ -0,0 +1,199 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ServiceImportReconcileDurationName = "submariner_service_import_reconcile_duration_seconds"
+	ServiceImportReconcileFailuresName = "submariner_service_import_reconcile_failures"
+	ServiceImportReconcileRetriesName  = "submariner_service_import_reconcile_retries"
+	ServiceImportReconcilePendingName  = "submariner_service_import_reconcile_pending_retries"
+	ServiceImportReconcileStuckName    = "submariner_service_import_reconcile_stuck"
+
+	resultLabel = "result"
+	reasonLabel = "reason"
+	keyLabel    = "key"
+
+	reconcileSucceeded = "success"
+	reconcileFailed    = "failure"
+
+	// Failure reasons for the ServiceImportReconcileFailuresName metric.
+	invalidPodSelectorFailure      = "invalid-pod-selector"
+	endpointControllerStartFailure = "endpoint-controller-start-error"
+	reconcileTimeoutFailure        = "reconcile-timeout"
+	endpointControllerExitFailure  = "endpoint-controller-exit"
+)
+
+// serviceImportMetrics tracks the ServiceImport watcher's reconciliation of local ServiceImports into
+// EndpointControllers. The watcher's work queue is internal to the syncer so its depth is approximated by the number of
+// ServiceImports awaiting a retry.
+type serviceImportMetrics struct {
+	reconcileDuration *prometheus.HistogramVec
+	reconcileFailures *prometheus.CounterVec
+	reconcileRetries  *prometheus.GaugeVec
+	pendingRetries    prometheus.Gauge
+	stuckRetries      prometheus.Gauge
+	// retrying maps the keys of the ServiceImports awaiting a retry to the time of their last failed reconciliation.
+	retrying sync.Map
+	// stuck holds the keys of the ServiceImports awaiting a retry whose reconciliation has been retried more than
+	// stuckThreshold times.
+	stuck          sync.Map
+	stuckThreshold int
+}
+
+// newServiceImportMetrics returns the metrics registered with the given registerer, defaulting to the Prometheus one,
+// reporting the ServiceImports retried more than the given number of times, defaulting to DefaultStuckRequeueThreshold,
+// as stuck.
+func newServiceImportMetrics(registerer prometheus.Registerer, stuckThreshold int) *serviceImportMetrics {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	if stuckThreshold == 0 {
+		stuckThreshold = DefaultStuckRequeueThreshold
+	}
+
+	m := &serviceImportMetrics{stuckThreshold: stuckThreshold}
+
+	m.reconcileDuration = register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    ServiceImportReconcileDurationName,
+		Help:    "Duration of ServiceImport reconciliations by result",
+		Buckets: prometheus.DefBuckets,
+	}, []string{resultLabel})).(*prometheus.HistogramVec)
+
+	m.reconcileFailures = register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: ServiceImportReconcileFailuresName,
+		Help: "Count of failed ServiceImport reconciliations by reason",
+	}, []string{reasonLabel})).(*prometheus.CounterVec)
+
+	m.reconcileRetries = register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: ServiceImportReconcileRetriesName,
+		Help: "Number of times the reconciliation of a ServiceImport has been retried",
+	}, []string{keyLabel})).(*prometheus.GaugeVec)
+
+	m.pendingRetries = register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: ServiceImportReconcilePendingName,
+		Help: "Number of ServiceImports whose reconciliation is awaiting a retry",
+	})).(prometheus.Gauge)
+
+	m.stuckRetries = register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: ServiceImportReconcileStuckName,
+		Help: "Number of ServiceImports awaiting a retry whose reconciliation has been retried more than the stuck threshold",
+	})).(prometheus.Gauge)
+
+	return m
+}
+
+// register registers the given collector or, if an equivalent collector is already registered, returns the existing
+// one so multiple controllers can share the registerer.
+func register(registerer prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	err := registerer.Register(collector)
+	if err == nil {
+		return collector
+	}
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return alreadyRegistered.ExistingCollector
+	}
+
+	klog.ErrorS(err, "Error registering metric")
+
+	return collector
+}
+
+// observeReconcile records the outcome of a reconciliation of the ServiceImport with the given key that started at the
+// given time, returning true if it thereby became stuck, that is, it failed and has been retried more than the stuck
+// threshold.
+func (m *serviceImportMetrics) observeReconcile(key string, start time.Time, numRequeues int, requeue bool) bool {
+	result := reconcileSucceeded
+	if requeue {
+		result = reconcileFailed
+	}
+
+	m.reconcileDuration.With(prometheus.Labels{resultLabel: result}).Observe(time.Since(start).Seconds())
+
+	if requeue {
+		now := time.Now()
+		if _, loaded := m.retrying.LoadOrStore(key, now); loaded {
+			m.retrying.Store(key, now)
+		} else {
+			m.pendingRetries.Inc()
+		}
+
+		m.reconcileRetries.With(prometheus.Labels{keyLabel: key}).Set(float64(numRequeues))
+
+		if numRequeues <= m.stuckThreshold {
+			return false
+		}
+
+		if _, loaded := m.stuck.LoadOrStore(key, true); loaded {
+			return false
+		}
+
+		m.stuckRetries.Inc()
+
+		return true
+	}
+
+	m.forget(key)
+
+	return false
+}
+
+// forget clears the retry state of the ServiceImport with the given key.
+func (m *serviceImportMetrics) forget(key string) {
+	if _, loaded := m.retrying.LoadAndDelete(key); loaded {
+		m.pendingRetries.Dec()
+		m.reconcileRetries.Delete(prometheus.Labels{keyLabel: key})
+	}
+
+	if _, loaded := m.stuck.LoadAndDelete(key); loaded {
+		m.stuckRetries.Dec()
+	}
+}
+
+// sweep clears the retry state of the ServiceImports whose last failed reconciliation is older than the given age and
+// which, per the given function, no longer exist so won't be reconciled again. It returns the keys of those cleared.
+func (m *serviceImportMetrics) sweep(maxAge time.Duration, exists func(key string) bool) []string {
+	swept := []string{}
+
+	m.retrying.Range(func(key, lastFailure interface{}) bool {
+		if time.Since(lastFailure.(time.Time)) > maxAge && !exists(key.(string)) {
+			m.forget(key.(string))
+			swept = append(swept, key.(string))
+		}
+
+		return true
+	})
+
+	return swept
+}
+
+func (m *serviceImportMetrics) incFailure(reason string) {
+	m.reconcileFailures.With(prometheus.Labels{reasonLabel: reason}).Inc()
+}
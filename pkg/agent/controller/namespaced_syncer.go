@@ -0,0 +1,127 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/submariner-io/admiral/pkg/syncer"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// namespacedSyncer is a syncer.Interface combining a resource syncer for each of a set of namespaces.
+type namespacedSyncer struct {
+	syncers map[string]syncer.Interface
+}
+
+// newNamespacedResourceSyncer creates a resource syncer from the given config or, if namespaces are given, one for each
+// of them in place of the config's source namespace, combined into a namespacedSyncer.
+func newNamespacedResourceSyncer(config *syncer.ResourceSyncerConfig, namespaces []string) (syncer.Interface, error) {
+	if len(namespaces) == 0 {
+		return syncer.NewResourceSyncer(config) // nolint:wrapcheck // Let the caller wrap
+	}
+
+	// The syncers share the sync counter as it can only be registered once.
+	if config.SyncCounter == nil && config.SyncCounterOpts != nil {
+		config.SyncCounter = prometheus.NewGaugeVec(*config.SyncCounterOpts,
+			[]string{syncer.DirectionLabel, syncer.OperationLabel, syncer.SyncerNameLabel})
+		prometheus.MustRegister(config.SyncCounter)
+	}
+
+	s := &namespacedSyncer{syncers: map[string]syncer.Interface{}}
+
+	for _, namespace := range namespaces {
+		namespaceConfig := *config
+		namespaceConfig.Name = fmt.Sprintf("%s in namespace %q", config.Name, namespace)
+		namespaceConfig.SourceNamespace = namespace
+
+		namespaceSyncer, err := syncer.NewResourceSyncer(&namespaceConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating the syncer for namespace %q", namespace)
+		}
+
+		s.syncers[namespace] = namespaceSyncer
+	}
+
+	return s, nil
+}
+
+func (s *namespacedSyncer) Start(stopCh <-chan struct{}) error {
+	for namespace, namespaceSyncer := range s.syncers {
+		if err := namespaceSyncer.Start(stopCh); err != nil {
+			return errors.Wrapf(err, "error starting the syncer for namespace %q", namespace)
+		}
+	}
+
+	return nil
+}
+
+func (s *namespacedSyncer) AwaitStopped() {
+	for _, namespaceSyncer := range s.syncers {
+		namespaceSyncer.AwaitStopped()
+	}
+}
+
+// GetResource returns the resource from the syncer for its namespace. Resources in other namespaces aren't found.
+func (s *namespacedSyncer) GetResource(name, namespace string) (runtime.Object, bool, error) {
+	namespaceSyncer, ok := s.syncers[namespace]
+	if !ok {
+		return nil, false, nil
+	}
+
+	return namespaceSyncer.GetResource(name, namespace) // nolint:wrapcheck // Let the caller wrap
+}
+
+func (s *namespacedSyncer) ListResources() ([]runtime.Object, error) {
+	resources := []runtime.Object{}
+
+	for namespace, namespaceSyncer := range s.syncers {
+		list, err := namespaceSyncer.ListResources()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing the resources in namespace %q", namespace)
+		}
+
+		resources = append(resources, list...)
+	}
+
+	return resources, nil
+}
+
+// Reconcile reconciles each namespace's syncer with the listed resources in its namespace. Resources in other
+// namespaces are ignored.
+func (s *namespacedSyncer) Reconcile(resourceLister func() []runtime.Object) {
+	for namespace, namespaceSyncer := range s.syncers {
+		namespace := namespace
+
+		namespaceSyncer.Reconcile(func() []runtime.Object {
+			resources := []runtime.Object{}
+
+			for _, resource := range resourceLister() {
+				if m, err := meta.Accessor(resource); err == nil && m.GetNamespace() == namespace {
+					resources = append(resources, resource)
+				}
+			}
+
+			return resources
+		})
+	}
+}
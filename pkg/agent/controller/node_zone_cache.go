@@ -0,0 +1,82 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/watcher"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// nolint:gocritic // (hugeParam) This function modifies config so we don't want to pass by pointer.
+func newNodeZoneCache(config watcher.Config) (*nodeZoneCache, error) {
+	c := &nodeZoneCache{}
+
+	config.ResourceConfigs = []watcher.ResourceConfig{
+		{
+			Name:         "Node watcher",
+			ResourceType: &corev1.Node{},
+			Handler: watcher.EventHandlerFuncs{
+				OnCreateFunc: func(obj runtime.Object, numRequeues int) bool {
+					c.onCreateOrUpdate(obj.(*corev1.Node))
+					return false
+				},
+				OnUpdateFunc: func(obj runtime.Object, numRequeues int) bool {
+					c.onCreateOrUpdate(obj.(*corev1.Node))
+					return false
+				},
+				OnDeleteFunc: func(obj runtime.Object, numRequeues int) bool {
+					c.byNode.Delete(obj.(*corev1.Node).Name)
+					return false
+				},
+			},
+		},
+	}
+
+	var err error
+
+	c.watcher, err = watcher.New(&config)
+
+	return c, errors.Wrap(err, "error creating Node watcher")
+}
+
+func (c *nodeZoneCache) start(stopCh <-chan struct{}) error {
+	return errors.Wrap(c.watcher.Start(stopCh), "error starting Node watcher")
+}
+
+func (c *nodeZoneCache) onCreateOrUpdate(node *corev1.Node) {
+	zone, ok := node.Labels[corev1.LabelTopologyZone]
+	if !ok || zone == "" {
+		c.byNode.Delete(node.Name)
+		return
+	}
+
+	c.byNode.Store(node.Name, zone)
+}
+
+// getZone returns the zone of the given node or false if it isn't known.
+func (c *nodeZoneCache) getZone(nodeName string) (string, bool) {
+	v, found := c.byNode.Load(nodeName)
+	if !found {
+		return "", false
+	}
+
+	return v.(string), true
+}
@@ -0,0 +1,93 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+const servicePortsDivergedReason = "ServicePortsDiverged"
+
+// reconcileEndpointPorts returns the ports of an EndpointSlice built from the given ports of the backing service's
+// Endpoints, reconciled against the given ports declared by the ServiceImport, along with a description of each
+// divergence between them. The ServiceImport's ports take precedence: the Endpoints ports are matched to them by name,
+// in the ServiceImport's order, taking the ServiceImport's protocol on a conflict, and the Endpoints ports it doesn't
+// declare are dropped. The port numbers are taken from the Endpoints as they're the ports the endpoints listen on. If
+// the ServiceImport declares no ports, the Endpoints ports are returned as is.
+func reconcileEndpointPorts(importPorts []mcsv1a1.ServicePort, endpointsPorts []corev1.EndpointPort,
+) ([]discovery.EndpointPort, []string) {
+	if len(importPorts) == 0 {
+		ports := make([]discovery.EndpointPort, 0, len(endpointsPorts))
+
+		for i := range endpointsPorts {
+			ports = append(ports, discovery.EndpointPort{
+				Name:     &endpointsPorts[i].Name,
+				Protocol: &endpointsPorts[i].Protocol,
+				Port:     &endpointsPorts[i].Port,
+			})
+		}
+
+		return ports, nil
+	}
+
+	byName := map[string]*corev1.EndpointPort{}
+	for i := range endpointsPorts {
+		byName[endpointsPorts[i].Name] = &endpointsPorts[i]
+	}
+
+	var divergences []string
+
+	ports := make([]discovery.EndpointPort, 0, len(importPorts))
+
+	for i := range importPorts {
+		importPort := &importPorts[i]
+
+		endpointsPort, found := byName[importPort.Name]
+		if !found {
+			divergences = append(divergences, fmt.Sprintf("port %q isn't exposed by the service", importPort.Name))
+			continue
+		}
+
+		delete(byName, importPort.Name)
+
+		if endpointsPort.Protocol != importPort.Protocol {
+			divergences = append(divergences, fmt.Sprintf("port %q has protocol %s instead of %s", importPort.Name,
+				endpointsPort.Protocol, importPort.Protocol))
+		}
+
+		ports = append(ports, discovery.EndpointPort{
+			Name:     &importPort.Name,
+			Protocol: &importPort.Protocol,
+			Port:     &endpointsPort.Port,
+		})
+	}
+
+	// Iterate in the Endpoints order, rather than over the map, so the divergences are deterministic.
+	for i := range endpointsPorts {
+		if _, found := byName[endpointsPorts[i].Name]; found {
+			divergences = append(divergences, fmt.Sprintf("port %q isn't declared by the ServiceImport", endpointsPorts[i].Name))
+		}
+	}
+
+	return ports, divergences
+}
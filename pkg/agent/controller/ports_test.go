@@ -0,0 +1,86 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+var _ = Describe("reconcileEndpointPorts", func() {
+	type port struct {
+		name     string
+		protocol corev1.Protocol
+		port     int32
+	}
+
+	portsOf := func(endpointPorts []discovery.EndpointPort) []port {
+		ports := []port{}
+		for i := range endpointPorts {
+			ports = append(ports, port{name: *endpointPorts[i].Name, protocol: *endpointPorts[i].Protocol, port: *endpointPorts[i].Port})
+		}
+
+		return ports
+	}
+
+	DescribeTable("should reconcile the Endpoints ports against the ServiceImport ports",
+		func(importPorts []mcsv1a1.ServicePort, endpointsPorts []corev1.EndpointPort, expected []port, expectedDivergences int) {
+			ports, divergences := reconcileEndpointPorts(importPorts, endpointsPorts)
+			Expect(portsOf(ports)).To(Equal(expected))
+			Expect(divergences).To(HaveLen(expectedDivergences))
+		},
+		Entry("when the ServiceImport declares no ports",
+			nil,
+			[]corev1.EndpointPort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080}},
+			[]port{{"http", corev1.ProtocolTCP, 8080}}, 0),
+		Entry("when they match",
+			[]mcsv1a1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80}},
+			[]corev1.EndpointPort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080}},
+			[]port{{"http", corev1.ProtocolTCP, 8080}}, 0),
+		Entry("when they're in a different order",
+			[]mcsv1a1.ServicePort{
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80},
+				{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53},
+			},
+			[]corev1.EndpointPort{
+				{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 5353},
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080},
+			},
+			[]port{{"http", corev1.ProtocolTCP, 8080}, {"dns", corev1.ProtocolUDP, 5353}}, 0),
+		Entry("when the protocols conflict",
+			[]mcsv1a1.ServicePort{{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53}},
+			[]corev1.EndpointPort{{Name: "dns", Protocol: corev1.ProtocolTCP, Port: 5353}},
+			[]port{{"dns", corev1.ProtocolUDP, 5353}}, 1),
+		Entry("when the names conflict",
+			[]mcsv1a1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80}},
+			[]corev1.EndpointPort{{Name: "web", Protocol: corev1.ProtocolTCP, Port: 8080}},
+			[]port{}, 2),
+		Entry("when the Endpoints has an additional port",
+			[]mcsv1a1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80}},
+			[]corev1.EndpointPort{
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080},
+				{Name: "metrics", Protocol: corev1.ProtocolTCP, Port: 9090},
+			},
+			[]port{{"http", corev1.ProtocolTCP, 8080}}, 1),
+	)
+})
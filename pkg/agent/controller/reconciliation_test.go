@@ -19,9 +19,14 @@ limitations under the License.
 package controller_test
 
 import (
+	"context"
+	"time"
+
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 	"github.com/submariner-io/admiral/pkg/syncer/test"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
@@ -155,4 +160,97 @@ var _ = Describe("Reconciliation", func() {
 			t.awaitNoEndpointSlice(t.cluster2.localEndpointSliceClient)
 		})
 	})
+
+	When("a local EndpointSlice is stale on startup with no corresponding ServiceImport", func() {
+		BeforeEach(func() {
+			t.service.Spec.ClusterIP = corev1.ClusterIPNone
+		})
+
+		JustBeforeEach(func() {
+			t.createEndpoints()
+		})
+
+		It("should delete the EndpointSlice on startup", func() {
+			endpointSlice := t.cluster1.awaitEndpointSlice(t)
+
+			t.afterEach()
+			t = newTestDiver()
+
+			test.CreateResource(t.cluster1.localEndpointSliceClient, endpointSlice)
+			t.cluster1.start(t, *t.syncerConfig)
+
+			t.awaitNoEndpointSlice(t.cluster1.localEndpointSliceClient)
+		})
+	})
+
+	When("a local EndpointSlice exists on startup for an exported Service", func() {
+		BeforeEach(func() {
+			t.service.Spec.ClusterIP = corev1.ClusterIPNone
+		})
+
+		JustBeforeEach(func() {
+			t.createEndpoints()
+		})
+
+		It("should adopt the EndpointSlice", func() {
+			serviceImport := t.cluster1.awaitServiceImport(t.service, mcsv1a1.Headless, "")
+			endpointSlice := t.cluster1.awaitEndpointSlice(t)
+
+			t.afterEach()
+			t = newTestDiver()
+			t.service.Spec.ClusterIP = corev1.ClusterIPNone
+
+			test.CreateResource(t.cluster1.localServiceImportClient, serviceImport)
+			test.CreateResource(t.cluster1.localEndpointSliceClient, endpointSlice)
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+			t.cluster1.start(t, *t.syncerConfig)
+
+			time.Sleep(300 * time.Millisecond)
+			t.cluster1.awaitServiceImport(t.service, mcsv1a1.Headless, "")
+			t.cluster1.awaitEndpointSlice(t)
+		})
+	})
+
+	When("periodic reconciliation is enabled and a local EndpointSlice is deleted out of band", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.ReconcileInterval = 100 * time.Millisecond
+			t.service.Spec.ClusterIP = corev1.ClusterIPNone
+		})
+
+		JustBeforeEach(func() {
+			t.createEndpoints()
+		})
+
+		It("should re-create the EndpointSlice on the next reconciliation", func() {
+			endpointSlice := t.cluster1.awaitEndpointSlice(t)
+
+			Expect(t.cluster1.localEndpointSliceClient.Delete(context.TODO(), endpointSlice.Name,
+				metav1.DeleteOptions{})).To(Succeed())
+
+			t.cluster1.awaitEndpointSlice(t)
+		})
+	})
+
+	When("periodic reconciliation is disabled and a local EndpointSlice is deleted out of band", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.ReconcileInterval = -1
+			t.service.Spec.ClusterIP = corev1.ClusterIPNone
+		})
+
+		JustBeforeEach(func() {
+			t.createEndpoints()
+		})
+
+		It("should not re-create the EndpointSlice", func() {
+			endpointSlice := t.cluster1.awaitEndpointSlice(t)
+
+			Expect(t.cluster1.localEndpointSliceClient.Delete(context.TODO(), endpointSlice.Name,
+				metav1.DeleteOptions{})).To(Succeed())
+
+			time.Sleep(300 * time.Millisecond)
+			test.AwaitNoResource(t.cluster1.localEndpointSliceClient, endpointSlice.Name)
+		})
+	})
 })
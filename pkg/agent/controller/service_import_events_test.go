@@ -0,0 +1,141 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/fake"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+var _ = Describe("ServiceImport reconciliation events", func() {
+	var t *testDriver
+
+	BeforeEach(func() {
+		t = newTestDiver()
+		t.service.Spec.ClusterIP = corev1.ClusterIPNone
+	})
+
+	JustBeforeEach(func() {
+		t.justBeforeEach()
+	})
+
+	AfterEach(func() {
+		t.afterEach()
+	})
+
+	When("a local ServiceImport has an invalid endpoint pod selector", func() {
+		JustBeforeEach(func() {
+			t.createLocalServiceImportWithPodSelector("expose-externally in (true")
+		})
+
+		It("should record a Warning event on the ServiceImport", func() {
+			Eventually(func() []corev1.Event {
+				events, err := t.cluster1.localKubeClient.CoreV1().Events(test.LocalNamespace).List(context.TODO(),
+					metav1.ListOptions{})
+				Expect(err).To(Succeed())
+
+				return events.Items
+			}, 5).Should(ContainElement(And(
+				HaveField("Type", corev1.EventTypeWarning),
+				HaveField("Reason", "InvalidEndpointPodSelector"),
+				HaveField("InvolvedObject.Kind", "ServiceImport"),
+				HaveField("InvolvedObject.Name", t.service.Name+"-"+t.service.Namespace+"-"+clusterID1))))
+		})
+	})
+
+	When("the ports of a local ServiceImport diverge from those of the Endpoints", func() {
+		BeforeEach(func() {
+			t.service.Spec.ClusterIP = "10.253.9.1"
+			t.service.Spec.Ports = []corev1.ServicePort{{Name: "port-1", Protocol: corev1.ProtocolUDP, Port: 1234}}
+		})
+
+		JustBeforeEach(func() {
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+		})
+
+		It("should use the ServiceImport's ports and record a Warning event on the ServiceImport", func() {
+			Eventually(func() []corev1.Event {
+				events, err := t.cluster1.localKubeClient.CoreV1().Events(test.LocalNamespace).List(context.TODO(),
+					metav1.ListOptions{})
+				Expect(err).To(Succeed())
+
+				return events.Items
+			}, 5).Should(ContainElement(And(
+				HaveField("Type", corev1.EventTypeWarning),
+				HaveField("Reason", "ServicePortsDiverged"),
+				HaveField("InvolvedObject.Kind", "ServiceImport"))))
+
+			endpointSlice := &discovery.EndpointSlice{}
+			Expect(scheme.Scheme.Convert(test.AwaitResource(t.cluster1.localEndpointSliceClient, t.endpoints.Name+"-"+clusterID1),
+				endpointSlice, nil)).To(Succeed())
+			Expect(endpointSlice.Ports).To(HaveLen(1))
+			Expect(*endpointSlice.Ports[0].Protocol).To(Equal(corev1.ProtocolUDP))
+		})
+	})
+
+	When("the reconciliation of a local ServiceImport times out", func() {
+		var endpointsListFails *fake.FailOnActionReactor
+
+		BeforeEach(func() {
+			t.cluster1.agentSpec.ReconcileTimeout = 300 * time.Millisecond
+
+			// The Endpoints syncer's cache can't sync while listing fails so starting the EndpointController blocks.
+			endpointsListFails = fake.FailOnAction(&t.cluster1.localDynClient.(*fake.DynamicClient).Fake, "endpoints", "list",
+				nil, false)
+		})
+
+		JustBeforeEach(func() {
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+		})
+
+		It("should record the timeout and retry the reconciliation", func() {
+			Eventually(func() []corev1.Event {
+				events, err := t.cluster1.localKubeClient.CoreV1().Events(test.LocalNamespace).List(context.TODO(),
+					metav1.ListOptions{})
+				Expect(err).To(Succeed())
+
+				return events.Items
+			}, 5).Should(ContainElement(And(
+				HaveField("Type", corev1.EventTypeWarning),
+				HaveField("Reason", "ReconcileTimedOut"),
+				HaveField("InvolvedObject.Kind", "ServiceImport"))))
+
+			Expect(counterValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcileFailuresName,
+				"reconcile-timeout")).To(BeNumerically(">", 0))
+
+			endpointsListFails.Fail(false)
+
+			t.awaitEndpointSlice()
+		})
+	})
+})
@@ -0,0 +1,246 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+var _ = Describe("ServiceImport reconciliation metrics", func() {
+	var t *testDriver
+
+	BeforeEach(func() {
+		t = newTestDiver()
+		t.service.Spec.ClusterIP = corev1.ClusterIPNone
+	})
+
+	JustBeforeEach(func() {
+		t.justBeforeEach()
+	})
+
+	AfterEach(func() {
+		t.afterEach()
+	})
+
+	When("a headless Service is exported", func() {
+		JustBeforeEach(func() {
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+		})
+
+		It("should record a successful reconciliation", func() {
+			t.awaitHeadlessServiceImport()
+
+			Eventually(func() uint64 {
+				return histogramSampleCount(t.cluster1.metricsRegistry, controller.ServiceImportReconcileDurationName,
+					"success")
+			}).Should(BeNumerically(">", 0))
+
+			Expect(gaugeValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcilePendingName)).To(BeZero())
+		})
+
+		It("should report its EndpointController", func() {
+			t.awaitHeadlessServiceImport()
+
+			Eventually(func() []controller.EndpointControllerInfo {
+				return t.cluster1.agentController.EndpointControllers()
+			}, 5).Should(ConsistOf(And(
+				HaveField("ServiceImport", test.LocalNamespace+"/"+t.service.Name+"-"+t.service.Namespace+"-"+clusterID1),
+				HaveField("ServiceNamespace", t.service.Namespace),
+				HaveField("ServiceName", t.service.Name),
+				HaveField("ClusterID", clusterID1),
+				HaveField("EndpointSlices", 1),
+				HaveField("Endpoints", 3),
+				HaveField("LastSync", Not(BeNil())))))
+
+			t.deleteServiceExport()
+
+			Eventually(t.cluster1.agentController.EndpointControllers, 5).Should(BeEmpty())
+		})
+	})
+
+	When("a ServiceImport from another cluster is synced to the local cluster", func() {
+		JustBeforeEach(func() {
+			test.CreateResource(t.cluster1.localServiceImportClient, &mcsv1a1.ServiceImport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: t.service.Name + "-" + t.service.Namespace + "-" + clusterID2,
+					Annotations: map[string]string{
+						lhconstants.OriginName:      t.service.Name,
+						lhconstants.OriginNamespace: t.service.Namespace,
+					},
+					Labels: map[string]string{
+						lhconstants.LighthouseLabelSourceCluster: clusterID2,
+					},
+				},
+				Spec: mcsv1a1.ServiceImportSpec{
+					Type: mcsv1a1.Headless,
+				},
+			})
+		})
+
+		It("should not reconcile it", func() {
+			Consistently(func() uint64 {
+				return histogramSampleCount(t.cluster1.metricsRegistry, controller.ServiceImportReconcileDurationName, "success") +
+					histogramSampleCount(t.cluster1.metricsRegistry, controller.ServiceImportReconcileDurationName, "failure")
+			}, 300*time.Millisecond).Should(BeZero())
+		})
+	})
+
+	When("a local ServiceImport has an invalid endpoint pod selector", func() {
+		JustBeforeEach(func() {
+			t.createLocalServiceImportWithPodSelector("expose-externally in (true")
+		})
+
+		It("should record the failure and the pending retry", func() {
+			Eventually(func() float64 {
+				return counterValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcileFailuresName,
+					"invalid-pod-selector")
+			}).Should(BeNumerically(">", 0))
+
+			Eventually(func() float64 {
+				return gaugeValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcilePendingName)
+			}).Should(Equal(float64(1)))
+		})
+
+		Context("and multiple workers are configured", func() {
+			BeforeEach(func() {
+				t.cluster1.agentSpec.Concurrency = 4
+			})
+
+			It("should retry the reconciliation", func() {
+				Eventually(func() float64 {
+					return counterValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcileFailuresName,
+						"invalid-pod-selector")
+				}).Should(BeNumerically(">", 1))
+
+				Expect(gaugeValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcilePendingName)).To(Equal(float64(1)))
+			})
+		})
+
+		Context("and it's retried more than the stuck requeue threshold", func() {
+			BeforeEach(func() {
+				t.cluster1.agentSpec.Concurrency = 4
+				t.cluster1.agentSpec.StuckRequeueThreshold = 3
+			})
+
+			It("should report it as stuck until it's successfully reconciled", func() {
+				Eventually(func() float64 {
+					return gaugeValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcileStuckName)
+				}).Should(Equal(float64(1)))
+
+				Eventually(func() []corev1.Event {
+					events, err := t.cluster1.localKubeClient.CoreV1().Events(test.LocalNamespace).List(context.TODO(),
+						metav1.ListOptions{})
+					Expect(err).To(Succeed())
+
+					return events.Items
+				}, 5).Should(ContainElement(And(
+					HaveField("Type", corev1.EventTypeWarning),
+					HaveField("Reason", "ReconcileStuck"),
+					HaveField("InvolvedObject.Kind", "ServiceImport"))))
+
+				serviceImport := test.AwaitResource(t.cluster1.localServiceImportClient,
+					t.service.Name+"-"+t.service.Namespace+"-"+clusterID1)
+				serviceImport.SetAnnotations(map[string]string{
+					lhconstants.OriginName:                    t.service.Name,
+					lhconstants.OriginNamespace:               t.service.Namespace,
+					lhconstants.EndpointPodSelectorAnnotation: "expose-externally=true",
+				})
+				test.UpdateResource(t.cluster1.localServiceImportClient, serviceImport)
+
+				Eventually(func() float64 {
+					return gaugeValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcileStuckName)
+				}).Should(BeZero())
+
+				Eventually(func() float64 {
+					return gaugeValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcilePendingName)
+				}).Should(BeZero())
+			})
+		})
+
+		Context("and the retry backoff is configured", func() {
+			BeforeEach(func() {
+				t.cluster1.agentSpec.RetryBaseDelay = time.Hour
+				t.cluster1.agentSpec.RetryMaxDelay = time.Hour
+			})
+
+			It("should not retry before the backoff delay", func() {
+				Eventually(func() float64 {
+					return counterValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcileFailuresName,
+						"invalid-pod-selector")
+				}).Should(Equal(float64(1)))
+
+				Consistently(func() float64 {
+					return counterValue(t.cluster1.metricsRegistry, controller.ServiceImportReconcileFailuresName,
+						"invalid-pod-selector")
+				}, 500*time.Millisecond).Should(Equal(float64(1)))
+			})
+		})
+	})
+})
+
+func findMetric(registry *prometheus.Registry, name, labelValue string) *dto.Metric {
+	families, err := registry.Gather()
+	Expect(err).To(Succeed())
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.Metric {
+			if labelValue == "" {
+				return metric
+			}
+
+			for _, label := range metric.Label {
+				if label.GetValue() == labelValue {
+					return metric
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func histogramSampleCount(registry *prometheus.Registry, name, labelValue string) uint64 {
+	return findMetric(registry, name, labelValue).GetHistogram().GetSampleCount()
+}
+
+func counterValue(registry *prometheus.Registry, name, labelValue string) float64 {
+	return findMetric(registry, name, labelValue).GetCounter().GetValue()
+}
+
+func gaugeValue(registry *prometheus.Registry, name string) float64 {
+	return findMetric(registry, name, "").GetGauge().GetValue()
+}
@@ -19,8 +19,21 @@ limitations under the License.
 package controller_test
 
 import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
 	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
@@ -59,6 +72,59 @@ var _ = Describe("ServiceImport syncing", func() {
 		})
 	})
 
+	When("the watched namespaces are restricted", func() {
+		When("the Service's namespace is watched", func() {
+			BeforeEach(func() {
+				t.cluster1.agentSpec.WatchNamespaces = []string{"other", serviceNamespace}
+				t.cluster2.agentSpec.WatchNamespaces = []string{serviceNamespace}
+			})
+
+			It("should sync a ServiceImport and EndpointSlice", func() {
+				t.createService()
+				t.createEndpoints()
+				t.createServiceExport()
+				t.awaitServiceExported(t.service.Spec.ClusterIP)
+				t.awaitEndpointSlice()
+			})
+		})
+
+		When("the Service's namespace isn't watched", func() {
+			BeforeEach(func() {
+				t.cluster1.agentSpec.WatchNamespaces = []string{"other"}
+			})
+
+			It("should not sync a ServiceImport", func() {
+				t.createService()
+				t.createServiceExport()
+
+				Consistently(func() error {
+					_, err := t.cluster1.localServiceImportClient.Get(context.TODO(),
+						t.service.Name+"-"+t.service.Namespace+"-"+clusterID1, metav1.GetOptions{})
+					return err
+				}, 500*time.Millisecond).ShouldNot(Succeed())
+			})
+		})
+	})
+
+	When("a ServiceLister is configured", func() {
+		var lister *fakeServiceLister
+
+		BeforeEach(func() {
+			lister = &fakeServiceLister{services: map[string]*corev1.Service{
+				t.service.Namespace + "/" + t.service.Name: t.service,
+			}}
+
+			t.cluster1.serviceLister = lister
+		})
+
+		It("should use it to look up the Service to export", func() {
+			t.createServiceExport()
+			t.cluster1.awaitServiceImport(t.service, mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP)
+			t.awaitBrokerServiceImport(mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP)
+			Expect(lister.lookups()).ToNot(BeZero())
+		})
+	})
+
 	When("a ServiceExport is deleted after a ServiceImport is synced", func() {
 		It("should delete the ServiceImport", func() {
 			t.createService()
@@ -144,4 +210,233 @@ var _ = Describe("ServiceImport syncing", func() {
 			t.awaitServiceExported(t.service.Spec.ClusterIP)
 		})
 	})
+
+	When("a Service has an IP family policy", func() {
+		for _, p := range []corev1.IPFamilyPolicyType{corev1.IPFamilyPolicySingleStack, corev1.IPFamilyPolicyPreferDualStack,
+			corev1.IPFamilyPolicyRequireDualStack} {
+			policy := p
+
+			It(fmt.Sprintf("should carry the %s policy into the ServiceImport", policy), func() {
+				t.service.Spec.IPFamilyPolicy = &policy
+				t.createService()
+				t.createServiceExport()
+				t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+				Expect(t.awaitBrokerServiceImport(mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP).Annotations).To(
+					HaveKeyWithValue(lhconstants.IPFamilyPolicyAnnotation, string(policy)))
+				Expect(t.cluster2.awaitServiceImport(t.service, mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP).Annotations).To(
+					HaveKeyWithValue(lhconstants.IPFamilyPolicyAnnotation, string(policy)))
+			})
+		}
+	})
+
+	When("a Service has no IP family policy", func() {
+		It("should not set the IP family policy annotation on the ServiceImport", func() {
+			t.createService()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+			Expect(t.awaitBrokerServiceImport(mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP).Annotations).ToNot(
+				HaveKey(lhconstants.IPFamilyPolicyAnnotation))
+		})
+	})
+
+	When("a Service has a clusterset traffic policy", func() {
+		It("should carry the policy into the ServiceImport", func() {
+			t.service.Annotations = map[string]string{
+				lhconstants.ClusterSetTrafficPolicyAnnotation: lhconstants.ClusterSetTrafficPolicyLocal,
+			}
+
+			t.createService()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+			Expect(t.awaitBrokerServiceImport(mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP).Annotations).To(
+				HaveKeyWithValue(lhconstants.ClusterSetTrafficPolicyAnnotation, lhconstants.ClusterSetTrafficPolicyLocal))
+			Expect(t.cluster2.awaitServiceImport(t.service, mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP).Annotations).To(
+				HaveKeyWithValue(lhconstants.ClusterSetTrafficPolicyAnnotation, lhconstants.ClusterSetTrafficPolicyLocal))
+		})
+	})
+
+	When("the clusterset traffic policy of an exported Service is updated", func() {
+		awaitTrafficPolicy := func(matcher types.GomegaMatcher) {
+			Eventually(func() map[string]string {
+				obj, err := t.brokerServiceImportClient.Get(context.TODO(), t.service.Name+"-"+t.service.Namespace+"-"+clusterID1,
+					metav1.GetOptions{})
+				if err != nil {
+					return nil
+				}
+
+				return obj.GetAnnotations()
+			}, 5).Should(matcher)
+		}
+
+		It("should update the policy in the ServiceImport", func() {
+			t.createService()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+			By("Setting the policy")
+
+			t.service.Annotations = map[string]string{
+				lhconstants.ClusterSetTrafficPolicyAnnotation: lhconstants.ClusterSetTrafficPolicyLocal,
+			}
+			t.updateService()
+
+			awaitTrafficPolicy(HaveKeyWithValue(lhconstants.ClusterSetTrafficPolicyAnnotation, lhconstants.ClusterSetTrafficPolicyLocal))
+
+			By("Removing the policy")
+
+			t.service.Annotations = nil
+			t.updateService()
+
+			awaitTrafficPolicy(And(HaveKey(lhconstants.OriginName), Not(HaveKey(lhconstants.ClusterSetTrafficPolicyAnnotation))))
+		})
+	})
+
+	testServiceIPEndpoints := func() {
+		It("should sync an EndpointSlice with a single endpoint for the service IP", func() {
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+			var endpointSlice *discovery.EndpointSlice
+
+			Eventually(func() []discovery.Endpoint {
+				obj, err := t.cluster1.localEndpointSliceClient.Get(context.TODO(), t.endpoints.Name+"-"+clusterID1,
+					metav1.GetOptions{})
+				if err != nil {
+					return nil
+				}
+
+				endpointSlice = &discovery.EndpointSlice{}
+				Expect(scheme.Scheme.Convert(obj, endpointSlice, nil)).To(Succeed())
+
+				return endpointSlice.Endpoints
+			}).Should(HaveLen(1))
+
+			ready := true
+			Expect(endpointSlice.Endpoints[0]).To(Equal(discovery.Endpoint{
+				Addresses:  []string{t.service.Spec.ClusterIP},
+				Conditions: discovery.EndpointConditions{Ready: &ready},
+			}))
+			Expect(endpointSlice.Ports).To(HaveLen(len(t.service.Spec.Ports)))
+		})
+	}
+
+	When("service IP endpoints are enabled and a ClusterIP Service is exported", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.ServiceIPEndpoints = true
+		})
+
+		testServiceIPEndpoints()
+	})
+
+	When("the gateway endpoint mode is set and a ClusterIP Service is exported", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.EndpointMode = controller.EndpointModeGateway
+		})
+
+		testServiceIPEndpoints()
+	})
+
+	When("the agent is stopped after a Service is exported", func() {
+		It("should stop the EndpointControllers and delete the local EndpointSlice", func() {
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+			t.cluster1.awaitEndpointSlice(t)
+
+			t.cancel()
+			t.ctx, t.cancel = context.WithCancel(context.Background())
+
+			test.AwaitNoResource(t.cluster1.localEndpointSliceClient, t.endpoints.Name+"-"+clusterID1)
+		})
+	})
+
+	When("the ports of a local ServiceImport are updated", func() {
+		BeforeEach(func() {
+			t.service.Spec.Ports = []corev1.ServicePort{{Name: "port-1", Protocol: corev1.ProtocolTCP, Port: 1234}}
+		})
+
+		It("should update the ports of the EndpointSlice", func() {
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+			name := "port-1"
+			var port int32 = 1234
+			tcp := corev1.ProtocolTCP
+			t.cluster1.awaitEndpointSlicePorts(t.endpoints, discovery.EndpointPort{Name: &name, Protocol: &tcp, Port: &port})
+
+			serviceImport := t.cluster1.awaitServiceImport(t.service, mcsv1a1.ClusterSetIP, t.service.Spec.ClusterIP)
+			serviceImport.Spec.Ports[0].Protocol = corev1.ProtocolUDP
+			test.UpdateResource(t.cluster1.localServiceImportClient, serviceImport)
+
+			udp := corev1.ProtocolUDP
+			t.cluster1.awaitEndpointSlicePorts(t.endpoints, discovery.EndpointPort{Name: &name, Protocol: &udp, Port: &port})
+			t.cluster2.awaitEndpointSlicePorts(t.endpoints, discovery.EndpointPort{Name: &name, Protocol: &udp, Port: &port})
+		})
+	})
+
+	When("a port is added to an exported Service", func() {
+		BeforeEach(func() {
+			t.service.Spec.Ports = []corev1.ServicePort{{Name: "port-1", Protocol: corev1.ProtocolTCP, Port: 1234}}
+		})
+
+		It("should update the ports in the ServiceImport and the EndpointSlice", func() {
+			t.createService()
+			t.createEndpoints()
+			t.createServiceExport()
+			t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+			t.service.Spec.Ports = append(t.service.Spec.Ports, corev1.ServicePort{
+				Name:     "http",
+				Protocol: corev1.ProtocolTCP,
+				Port:     8080,
+			})
+			t.updateService()
+
+			t.endpoints.Subsets[0].Ports = append(t.endpoints.Subsets[0].Ports, corev1.EndpointPort{
+				Name:     "http",
+				Protocol: corev1.ProtocolTCP,
+				Port:     8080,
+			})
+			t.updateEndpoints()
+
+			t.awaitUpdatedServiceImportPorts(t.service.Spec.Ports)
+
+			expected := make([]discovery.EndpointPort, len(t.endpoints.Subsets[0].Ports))
+			for i := range t.endpoints.Subsets[0].Ports {
+				expected[i] = discovery.EndpointPort{
+					Name:     &t.endpoints.Subsets[0].Ports[i].Name,
+					Protocol: &t.endpoints.Subsets[0].Ports[i].Protocol,
+					Port:     &t.endpoints.Subsets[0].Ports[i].Port,
+				}
+			}
+
+			t.cluster1.awaitEndpointSlicePorts(t.endpoints, expected...)
+			t.cluster2.awaitEndpointSlicePorts(t.endpoints, expected...)
+		})
+	})
 })
+
+type fakeServiceLister struct {
+	services   map[string]*corev1.Service
+	numLookups int32
+}
+
+func (l *fakeServiceLister) GetService(name, namespace string) (*corev1.Service, bool, error) {
+	atomic.AddInt32(&l.numLookups, 1)
+
+	svc, found := l.services[namespace+"/"+name]
+
+	return svc, found, nil
+}
+
+func (l *fakeServiceLister) lookups() int32 {
+	return atomic.LoadInt32(&l.numLookups)
+}
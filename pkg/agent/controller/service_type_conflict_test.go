@@ -0,0 +1,224 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/federate"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeKubeClient "k8s.io/client-go/kubernetes/fake"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+var _ = Describe("Service type conflicts", func() {
+	var (
+		t               *testDriver
+		remoteType      mcsv1a1.ServiceImportType
+		remoteExportAge time.Duration
+	)
+
+	BeforeEach(func() {
+		t = newTestDiver()
+		t.serviceExport.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+		remoteType = mcsv1a1.Headless
+	})
+
+	JustBeforeEach(func() {
+		t.justBeforeEach()
+
+		remoteServiceImport := &mcsv1a1.ServiceImport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: t.service.Name + "-" + t.service.Namespace + "-" + clusterID2,
+				Annotations: map[string]string{
+					lhconstants.OriginName:      t.service.Name,
+					lhconstants.OriginNamespace: t.service.Namespace,
+					lhconstants.ExportTimestampAnnotation: t.serviceExport.CreationTimestamp.Add(remoteExportAge).UTC().
+						Format(time.RFC3339),
+				},
+				Labels: map[string]string{
+					lhconstants.LighthouseLabelSourceName:    t.service.Name,
+					lhconstants.LabelSourceNamespace:         t.service.Namespace,
+					lhconstants.LighthouseLabelSourceCluster: clusterID2,
+					federate.ClusterIDLabelKey:               clusterID2,
+				},
+			},
+			Spec: mcsv1a1.ServiceImportSpec{
+				Type: remoteType,
+			},
+		}
+
+		if remoteType == mcsv1a1.ClusterSetIP {
+			remoteServiceImport.Spec.IPs = []string{"10.253.9.2"}
+		}
+
+		test.CreateResource(t.brokerServiceImportClient, remoteServiceImport)
+		test.AwaitResource(t.cluster1.localServiceImportClient, remoteServiceImport.Name)
+
+		t.createService()
+		t.createEndpoints()
+		t.createServiceExport()
+	})
+
+	AfterEach(func() {
+		t.afterEach()
+	})
+
+	awaitConflictStatus := func() {
+		reason := "ConflictingType"
+		t.awaitServiceExportStatus(&mcsv1a1.ServiceExportCondition{
+			Type:   mcsv1a1.ServiceExportConflict,
+			Status: corev1.ConditionTrue,
+			Reason: &reason,
+		})
+
+		t.awaitNoServiceImport(t.brokerServiceImportClient)
+	}
+
+	When("the first exporter wins", func() {
+		Context("and another cluster exported the service as Headless first", func() {
+			BeforeEach(func() {
+				remoteExportAge = -time.Minute
+			})
+
+			It("should not export the service and should set the Conflict condition", func() {
+				awaitConflictStatus()
+			})
+		})
+
+		Context("and the conflict is then resolved", func() {
+			otherReason := "Checked"
+
+			BeforeEach(func() {
+				remoteExportAge = -time.Minute
+
+				now := metav1.Now()
+				message := "Checked by another controller"
+				t.serviceExport.Status.Conditions = []mcsv1a1.ServiceExportCondition{{
+					Type:               "example.io/Checked",
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: &now,
+					Reason:             &otherReason,
+					Message:            &message,
+				}}
+			})
+
+			It("should export the service, clearing the Conflict condition and retaining the other conditions", func() {
+				awaitConflictStatus()
+
+				Expect(t.brokerServiceImportClient.Delete(context.TODO(), t.service.Name+"-"+t.service.Namespace+"-"+clusterID2,
+					metav1.DeleteOptions{})).To(Succeed())
+
+				t.awaitServiceExported(t.service.Spec.ClusterIP)
+
+				noReason := ""
+				t.awaitServiceExportStatus(newServiceExportCondition(corev1.ConditionTrue, ""),
+					&mcsv1a1.ServiceExportCondition{
+						Type:   mcsv1a1.ServiceExportConflict,
+						Status: corev1.ConditionFalse,
+						Reason: &noReason,
+					},
+					&mcsv1a1.ServiceExportCondition{
+						Type:   "example.io/Checked",
+						Status: corev1.ConditionTrue,
+						Reason: &otherReason,
+					})
+			})
+		})
+
+		Context("and another cluster exported the service as Headless afterwards", func() {
+			BeforeEach(func() {
+				remoteExportAge = time.Minute
+			})
+
+			It("should export the service", func() {
+				t.awaitServiceExported(t.service.Spec.ClusterIP)
+			})
+		})
+	})
+
+	When("ClusterSetIP wins", func() {
+		BeforeEach(func() {
+			t.cluster1.agentSpec.ServiceTypeConflictPolicy = controller.ClusterSetIPWins
+			remoteExportAge = -time.Minute
+		})
+
+		Context("and another cluster exported the service as Headless first", func() {
+			It("should export the service", func() {
+				t.awaitServiceExported(t.service.Spec.ClusterIP)
+			})
+		})
+
+		Context("and another cluster exported the service as ClusterSetIP", func() {
+			BeforeEach(func() {
+				t.service.Spec.ClusterIP = corev1.ClusterIPNone
+				remoteType = mcsv1a1.ClusterSetIP
+				remoteExportAge = time.Minute
+			})
+
+			It("should not export the Headless service and should set the Conflict condition", func() {
+				awaitConflictStatus()
+			})
+		})
+	})
+})
+
+var _ = Describe("Service type conflict policy validation", func() {
+	When("an invalid policy is specified", func() {
+		It("should fail to create the agent controller", func() {
+			t := newTestDiver()
+
+			syncerConfig := *t.syncerConfig
+			syncerConfig.LocalClient = t.cluster1.localDynClient
+
+			_, err := controller.New(&controller.AgentSpecification{
+				ClusterID:                 clusterID1,
+				Namespace:                 test.LocalNamespace,
+				ServiceTypeConflictPolicy: "LastExporter",
+			}, syncerConfig, fakeKubeClient.NewSimpleClientset(), controller.AgentConfig{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("Retry backoff validation", func() {
+	When("the retry base delay is greater than the max delay", func() {
+		It("should fail to create the agent controller", func() {
+			t := newTestDiver()
+
+			syncerConfig := *t.syncerConfig
+			syncerConfig.LocalClient = t.cluster1.localDynClient
+
+			_, err := controller.New(&controller.AgentSpecification{
+				ClusterID:      clusterID1,
+				Namespace:      test.LocalNamespace,
+				RetryBaseDelay: time.Minute,
+				RetryMaxDelay:  time.Second,
+			}, syncerConfig, fakeKubeClient.NewSimpleClientset(), controller.AgentConfig{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -19,43 +19,131 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/submariner-io/admiral/pkg/federate"
 	"github.com/submariner-io/admiral/pkg/log"
+	"github.com/submariner-io/admiral/pkg/resource"
 	"github.com/submariner-io/admiral/pkg/syncer"
 	"github.com/submariner-io/admiral/pkg/watcher"
 	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	k8serrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/klog"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
-func newServiceImportController(spec *AgentSpecification, serviceSyncer syncer.Interface, restMapper meta.RESTMapper,
-	localClient dynamic.Interface, scheme *runtime.Scheme,
+const (
+	eventSourceComponent = "lighthouse-agent"
+
+	// Reasons of the Warning events recorded on a ServiceImport whose reconciliation failed.
+	invalidPodSelectorReason            = "InvalidEndpointPodSelector"
+	endpointControllerStartFailedReason = "EndpointControllerStartFailed"
+	reconcileTimedOutReason             = "ReconcileTimedOut"
+	reconcileStuckReason                = "ReconcileStuck"
+)
+
+// retryStateSweepInterval is the interval at which the retry state of the ServiceImports that no longer exist, and are
+// thus left without a further reconciliation to clear it, is swept.
+const retryStateSweepInterval = time.Minute
+
+func newServiceImportController(spec *AgentSpecification, serviceLister ServiceLister, restMapper meta.RESTMapper,
+	localClient dynamic.Interface, scheme *runtime.Scheme, kubeClientSet kubernetes.Interface, registerer prometheus.Registerer,
+	endpointFilter EndpointFilter, keys *metadataKeys,
 ) (*ServiceImportController, error) {
 	controller := &ServiceImportController{
-		serviceSyncer: serviceSyncer,
-		localClient:   localClient,
-		restMapper:    restMapper,
-		clusterID:     spec.ClusterID,
-		scheme:        scheme,
+		serviceLister:        serviceLister,
+		localClient:          localClient,
+		restMapper:           restMapper,
+		clusterID:            spec.ClusterID,
+		scheme:               scheme,
+		readinessGates:       spec.ReadinessGates,
+		endpointMetadataKeys: spec.EndpointMetadataKeys,
+		reconcileInterval:    spec.ReconcileInterval,
+		serviceIPEndpoints:   spec.endpointMode() == EndpointModeGateway,
+		metrics:              newServiceImportMetrics(registerer, spec.StuckRequeueThreshold),
+		drainTimeout:         spec.ShutdownDrainTimeout,
+		stopped:              make(chan struct{}),
+		eventBroadcaster:     record.NewBroadcaster(),
+		retryLimiter:         newRetryLimiter(spec),
+		concurrency:          spec.Concurrency,
+		dryRun:               spec.DryRun,
+		ctx:                  context.Background(),
+		maxEndpointsPerSlice: spec.MaxEndpointsPerSlice,
+		reconcileTimeout:     spec.ReconcileTimeout,
+		endpointFilter:       endpointFilter,
+		keys:                 keys,
+		watchNamespaces:      spec.WatchNamespaces,
+	}
+
+	if controller.concurrency > 1 {
+		controller.workQueue = workqueue.NewNamedRateLimitingQueue(controller.retryLimiter, "ServiceImport reconciler")
+	}
+
+	controller.eventRecorder = controller.eventBroadcaster.NewRecorder(scheme, corev1.EventSource{Component: eventSourceComponent})
+	// The events are recorded on the local ServiceImports, which all reside in the agent's namespace.
+	controller.eventSink = &typedcorev1.EventSinkImpl{Interface: kubeClientSet.CoreV1().Events(spec.Namespace)}
+
+	if controller.reconcileInterval == 0 {
+		controller.reconcileInterval = DefaultReconcileInterval
+	}
+
+	if controller.drainTimeout == 0 {
+		controller.drainTimeout = DefaultShutdownDrainTimeout
 	}
 
+	if controller.maxEndpointsPerSlice == 0 {
+		controller.maxEndpointsPerSlice = DefaultMaxEndpointsPerSlice
+	}
+
+	if controller.reconcileTimeout == 0 {
+		controller.reconcileTimeout = DefaultReconcileTimeout
+	}
+
+	// A ServiceImport still being retried fails again within the maximum retry delay so only the state of those that
+	// haven't for well beyond it is swept.
+	_, maxDelay, _, _, _ := retryParameters(spec)
+	controller.retryStateMaxAge = 10 * maxDelay
+	controller.retryStateSweepInterval = retryStateSweepInterval
+
 	var err error
 
 	controller.serviceImportSyncer, err = syncer.NewResourceSyncer(&syncer.ResourceSyncerConfig{
-		Name:            "ServiceImport watcher",
-		SourceClient:    localClient,
-		SourceNamespace: spec.Namespace,
-		Direction:       syncer.LocalToRemote,
-		RestMapper:      restMapper,
-		Federator:       federate.NewNoopFederator(),
-		ResourceType:    &mcsv1a1.ServiceImport{},
-		Transform:       controller.serviceImportToEndpointController,
-		Scheme:          scheme,
+		Name:                "ServiceImport watcher",
+		SourceClient:        localClient,
+		SourceNamespace:     spec.Namespace,
+		Direction:           syncer.LocalToRemote,
+		RestMapper:          restMapper,
+		Federator:           federate.NewNoopFederator(),
+		ResourceType:        &mcsv1a1.ServiceImport{},
+		Transform:           controller.serviceImportToEndpointController,
+		ShouldProcess:       controller.isLocalServiceImport,
+		ResourcesEquivalent: controller.serviceImportsEquivalent,
+		Scheme:              scheme,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating ServiceImport watcher")
@@ -66,87 +154,948 @@ func newServiceImportController(spec *AgentSpecification, serviceSyncer syncer.I
 			RestMapper: restMapper,
 			Client:     localClient,
 			Scheme:     scheme,
+		}, spec.WatchNamespaces)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.PublishTopology {
+		controller.nodeZoneCache, err = newNodeZoneCache(watcher.Config{
+			RestMapper: restMapper,
+			Client:     localClient,
+			Scheme:     scheme,
 		})
 	}
 
 	return controller, err
 }
 
-func (c *ServiceImportController) start(stopCh <-chan struct{}) error {
+func (c *ServiceImportController) start(ctx context.Context) error {
+	stopCh := ctx.Done()
+	c.ctx = ctx
+
 	if c.globalIngressIPCache != nil {
 		if err := c.globalIngressIPCache.start(stopCh); err != nil {
 			return err
 		}
 	}
 
+	if c.nodeZoneCache != nil {
+		if err := c.nodeZoneCache.start(stopCh); err != nil {
+			return err
+		}
+	}
+
+	c.eventBroadcaster.StartRecordingToSink(c.eventSink)
+
 	go func() {
 		<-stopCh
 
+		if c.workQueue != nil {
+			c.workQueue.ShutDown()
+		}
+
+		c.drain()
+
+		// The context is done so the EndpointSlices are deleted with a new one.
 		c.endpointControllers.Range(func(key, value interface{}) bool {
-			value.(*EndpointController).stop()
+			for _, endpointController := range value.([]*EndpointController) {
+				if err := endpointController.stop(context.Background()); err != nil {
+					klog.ErrorS(err, "Error deleting the EndpointSlices associated with the ServiceImport", "serviceImport", key)
+				}
+			}
+
 			return true
 		})
 
-		klog.Infof("ServiceImport Controller stopped")
+		c.eventBroadcaster.Shutdown()
+
+		klog.InfoS("ServiceImport Controller stopped")
+
+		close(c.stopped)
 	}()
 
+	for i := 0; c.workQueue != nil && i < c.concurrency; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+
 	if err := c.serviceImportSyncer.Start(stopCh); err != nil {
 		return errors.Wrap(err, "error starting ServiceImport watcher")
 	}
 
+	c.reconcileEndpointSlices(ctx)
+
+	if c.reconcileInterval > 0 {
+		go c.reconcilePeriodically(ctx)
+	}
+
+	go wait.Until(c.sweepRetryState, c.retryStateSweepInterval, stopCh)
+
 	return nil
 }
 
-func (c *ServiceImportController) serviceImportCreatedOrUpdated(serviceImport *mcsv1a1.ServiceImport, key string) bool {
-	if _, found := c.endpointControllers.Load(key); found {
-		klog.V(log.DEBUG).Infof("The endpoint controller is already running for %q", key)
+// sweepRetryState clears the retry state of the ServiceImports that no longer exist in the ServiceImport watcher's
+// cache and haven't failed to reconcile for retryStateMaxAge. This is normally cleared when the ServiceImport is
+// successfully reconciled or deleted, but is left behind if no such event is processed, e.g. if the ServiceImport
+// ceases to be local.
+func (c *ServiceImportController) sweepRetryState() {
+	swept := c.metrics.sweep(c.retryStateMaxAge, func(key string) bool {
+		namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+
+		_, found, err := c.serviceImportSyncer.GetResource(name, namespace)
+
+		// Keep the state if the ServiceImport's existence can't be determined.
+		return found || err != nil
+	})
+
+	for _, key := range swept {
+		if c.retryLimiter != nil {
+			c.retryLimiter.Forget(key)
+		}
+
+		klog.V(log.DEBUG).InfoS("Swept the retry state of a ServiceImport that no longer exists", "serviceImport", key)
+	}
+}
+
+// drain stops new ServiceImport reconciliations from starting and waits, up to the drain timeout, for the in-flight ones
+// to complete so no EndpointController is started after the running ones are stopped.
+func (c *ServiceImportController) drain() {
+	c.stopMutex.Lock()
+	c.stopping = true
+	c.stopMutex.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		c.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(c.drainTimeout):
+		klog.Warningf("Timed out after %v waiting for in-flight ServiceImport reconciliations to complete", c.drainTimeout)
+	}
+}
+
+// beginReconcile returns false if the controller is stopping, otherwise it tracks a reconciliation as in-flight until
+// endReconcile is called.
+func (c *ServiceImportController) beginReconcile() bool {
+	c.stopMutex.Lock()
+	defer c.stopMutex.Unlock()
+
+	if c.stopping {
 		return false
 	}
 
-	if serviceImport.GetLabels()[lhconstants.LighthouseLabelSourceCluster] != c.clusterID {
+	c.inFlight.Add(1)
+
+	return true
+}
+
+func (c *ServiceImportController) endReconcile() {
+	c.inFlight.Done()
+}
+
+func (c *ServiceImportController) reconcilePeriodically(ctx context.Context) {
+	ticker := time.NewTicker(c.reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.reconcile(ctx)
+		}
+	}
+}
+
+// reconcileEndpointSlices deletes the local EndpointSlices, created by this cluster before a restart, that don't
+// correspond to a local ServiceImport, e.g. because the ServiceImport was deleted while the agent wasn't running. The
+// EndpointSlices are matched to the ServiceImports by their owner labels rather than by name so all those of a live
+// ServiceImport, including its split and secondary address family EndpointSlices, are adopted by its EndpointController,
+// which updates them in place as their names are derived from the service, and deletes any it no longer needs.
+func (c *ServiceImportController) reconcileEndpointSlices(ctx context.Context) {
+	serviceImports, err := c.serviceImportSyncer.ListResources()
+	if err != nil {
+		klog.ErrorS(err, "Error listing ServiceImports")
+		return
+	}
+
+	expected := map[string]bool{}
+
+	for _, obj := range serviceImports {
+		serviceImport := obj.(*mcsv1a1.ServiceImport)
+		if serviceImport.GetLabels()[c.keys.sourceCluster] != c.clusterID {
+			continue
+		}
+
+		for _, namespace := range c.originNamespaces(serviceImport) {
+			expected[namespace+"/"+serviceImport.GetAnnotations()[lhconstants.OriginName]] = true
+		}
+	}
+
+	selector := labels.SelectorFromSet(map[string]string{
+		discovery.LabelManagedBy:          lhconstants.LabelValueManagedBy,
+		lhconstants.MCSLabelSourceCluster: c.clusterID,
+	})
+
+	// Only the EndpointSlices carrying the configured owner labels were created by the EndpointControllers.
+	for _, key := range []string{c.keys.sourceNamespace, lhconstants.MCSLabelServiceName} {
+		requirement, err := labels.NewRequirement(key, selection.Exists, nil)
+		if err != nil {
+			klog.ErrorS(err, "Error creating the EndpointSlice label requirement", "key", key)
+			return
+		}
+
+		selector = selector.Add(*requirement)
+	}
+
+	resourceClient := c.localClient.Resource(schema.GroupVersionResource{
+		Group:    discovery.SchemeGroupVersion.Group,
+		Version:  discovery.SchemeGroupVersion.Version,
+		Resource: "endpointslices",
+	})
+
+	namespaces := c.watchNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, namespace := range namespaces {
+		list, err := resourceClient.Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			klog.ErrorS(err, "Error listing the local EndpointSlices", "namespace", namespace)
+			continue
+		}
+
+		for i := range list.Items {
+			endpointSlice := &list.Items[i]
+			if expected[endpointSlice.GetNamespace()+"/"+endpointSlice.GetLabels()[lhconstants.MCSLabelServiceName]] {
+				continue
+			}
+
+			klog.InfoS("Deleting stale EndpointSlice with no corresponding ServiceImport", "endpointSlice",
+				klog.KObj(endpointSlice), "dryRun", c.dryRun)
+
+			err := resourceClient.Namespace(endpointSlice.GetNamespace()).Delete(ctx, endpointSlice.GetName(),
+				deleteOptions(c.dryRun))
+			if err != nil && !apierrors.IsNotFound(err) {
+				klog.ErrorS(err, "Error deleting stale EndpointSlice", "endpointSlice", klog.KObj(endpointSlice))
+			}
+		}
+	}
+}
+
+// reconcile lists the ServiceImports and re-syncs each local one, starting its EndpointController if it isn't running
+// and otherwise re-syncing its EndpointSlice, to recover from any missed events.
+func (c *ServiceImportController) reconcile(ctx context.Context) {
+	klog.V(log.DEBUG).InfoS("Reconciling all ServiceImports")
+
+	serviceImports, err := c.serviceImportSyncer.ListResources()
+	if err != nil {
+		klog.ErrorS(err, "Error listing ServiceImports")
+		return
+	}
+
+	if !c.beginReconcile() {
+		return
+	}
+
+	defer c.endReconcile()
+
+	for _, obj := range serviceImports {
+		serviceImport := obj.(*mcsv1a1.ServiceImport)
+		key, _ := cache.MetaNamespaceKeyFunc(serviceImport)
+
+		if endpointControllers, found := c.endpointControllers.Load(key); found {
+			for _, endpointController := range endpointControllers.([]*EndpointController) {
+				endpointController.resync()
+			}
+		} else {
+			c.serviceImportCreatedOrUpdated(ctx, serviceImport, key)
+		}
+	}
+}
+
+func (c *ServiceImportController) serviceImportCreatedOrUpdated(ctx context.Context, serviceImport *mcsv1a1.ServiceImport,
+	key string,
+) bool {
+	// The ServiceImport watcher, the periodic reconciliation and the retries may reconcile the same ServiceImport
+	// concurrently so make the check for, and the creation of, its EndpointController atomic.
+	defer c.keyMutex.lock(key)()
+
+	if obj, found := c.endpointControllers.Load(key); found {
+		endpointControllers := obj.([]*EndpointController)
+		if !c.endpointControllersOutdated(serviceImport, endpointControllers) {
+			klog.V(log.DEBUG).InfoS("The endpoint controller is already running", "serviceImport", key)
+			return false
+		}
+
+		// The EndpointControllers are built from the ServiceImport and its Services, e.g. they publish its ports, so
+		// they're replaced to apply the changes.
+		klog.InfoS("The ServiceImport changed - restarting its endpoint controllers", "serviceImport", key)
+
+		c.endpointControllers.Delete(key)
+		c.retireEndpointControllers(ctx, key, serviceImport, endpointControllers)
+	}
+
+	if serviceImport.GetLabels()[c.keys.sourceCluster] != c.clusterID {
 		return false
 	}
 
-	annotations := serviceImport.ObjectMeta.Annotations
-	serviceNameSpace := annotations[lhconstants.OriginNamespace]
-	serviceName := annotations[lhconstants.OriginName]
+	reconcileCtx, cancel := context.WithTimeout(ctx, c.reconcileTimeout)
+	defer cancel()
 
-	endpointController, err := startEndpointController(c.localClient, c.restMapper, c.scheme,
-		serviceImport, serviceNameSpace, serviceName, c.clusterID, c.globalIngressIPCache)
+	serviceName := serviceImport.ObjectMeta.Annotations[lhconstants.OriginName]
+
+	// A ServiceImport may be backed by Services, with the same name, in multiple namespaces, each watched by its own
+	// EndpointController.
+	endpointControllers := []*EndpointController{}
+	ipFamilies := c.ipFamiliesOf(serviceImport)
+
+	for _, serviceNameSpace := range c.originNamespaces(serviceImport) {
+		endpointController, err := startEndpointController(reconcileCtx, c.localClient, c.restMapper, c.scheme, c.eventRecorder,
+			serviceImport, serviceNameSpace, serviceName, c.clusterID, c.keys, c.globalIngressIPCache, c.nodeZoneCache, c.readinessGates,
+			c.endpointMetadataKeys, c.endpointFilter, ipFamilies,
+			c.publishesNotReadyAddresses(serviceImport, serviceNameSpace, serviceName), c.serviceIPEndpoints, c.dryRun,
+			c.maxEndpointsPerSlice, c.servicePodSelector(serviceNameSpace, serviceName))
+		if err != nil {
+			reason := reconcileTimedOutReason
+			if !c.recordIfTimedOut(reconcileCtx, serviceImport, key) {
+				reason = c.endpointControllerStartFailed(serviceImport, key, err)
+			}
+
+			c.setEndpointsSynced(ctx, serviceImport.Name, serviceImport.Namespace, corev1.ConditionFalse, reason, err.Error())
+
+			// The EndpointControllers already started are stopped so they're all started again on the retry.
+			c.stopEndpointControllers(ctx, key, endpointControllers)
+
+			return true
+		}
+
+		endpointControllers = append(endpointControllers, endpointController)
+	}
+
+	c.endpointControllers.Store(key, endpointControllers)
+	c.setEndpointsSynced(ctx, serviceImport.Name, serviceImport.Namespace, corev1.ConditionTrue, endpointControllersStartedReason,
+		"The endpoints are synced to EndpointSlices")
+	c.superviseEndpointControllers(key, endpointControllers)
+
+	return false
+}
+
+// endpointControllersOutdated returns whether the given running EndpointControllers of the given ServiceImport were
+// built from a version of it that isn't equivalent or from Services whose publishNotReadyAddresses or pod selector has
+// since changed.
+func (c *ServiceImportController) endpointControllersOutdated(serviceImport *mcsv1a1.ServiceImport,
+	endpointControllers []*EndpointController,
+) bool {
+	from, err := resource.ToUnstructured(endpointControllers[0].serviceImport)
+	if err != nil {
+		klog.ErrorS(err, "Error converting the ServiceImport", "serviceImport", klog.KObj(serviceImport))
+		return true
+	}
+
+	to, err := resource.ToUnstructured(serviceImport)
 	if err != nil {
-		klog.Errorf(err.Error())
+		klog.ErrorS(err, "Error converting the ServiceImport", "serviceImport", klog.KObj(serviceImport))
 		return true
 	}
 
-	c.endpointControllers.Store(key, endpointController)
+	if !c.serviceImportsEquivalent(from, to) {
+		return true
+	}
+
+	for _, endpointController := range endpointControllers {
+		if endpointController.publishNotReadyAddresses != c.publishesNotReadyAddresses(serviceImport,
+			endpointController.serviceImportSourceNameSpace, endpointController.serviceName) {
+			return true
+		}
+
+		if endpointController.servicePodSelector != c.servicePodSelector(endpointController.serviceImportSourceNameSpace,
+			endpointController.serviceName) {
+			return true
+		}
+	}
 
 	return false
 }
 
-func (c *ServiceImportController) serviceImportDeleted(serviceImport *mcsv1a1.ServiceImport, key string) {
-	if serviceImport.GetLabels()[lhconstants.LighthouseLabelSourceCluster] != c.clusterID {
+// serviceUpdated reconciles again the ServiceImports whose EndpointControllers were built from an earlier version of
+// the given Service, i.e. with a different publishNotReadyAddresses or pod selector, so they're replaced.
+func (c *ServiceImportController) serviceUpdated(service *corev1.Service) {
+	c.endpointControllers.Range(func(key, obj interface{}) bool {
+		for _, endpointController := range obj.([]*EndpointController) {
+			if endpointController.serviceImportSourceNameSpace != service.Namespace || endpointController.serviceName != service.Name {
+				continue
+			}
+
+			if (endpointController.isHeadless && endpointController.publishNotReadyAddresses != service.Spec.PublishNotReadyAddresses) ||
+				endpointController.servicePodSelector != podSelectorOf(service) {
+				c.requeue(key.(string))
+				break
+			}
+		}
+
+		return true
+	})
+}
+
+// retireEndpointControllers stops the given EndpointControllers of the ServiceImport with the given key, which are
+// replaced as the given ServiceImport changed. The EndpointSlices of the Services still backing the ServiceImport are
+// left as is for the new EndpointControllers to adopt, the others are deleted.
+func (c *ServiceImportController) retireEndpointControllers(ctx context.Context, key string, serviceImport *mcsv1a1.ServiceImport,
+	endpointControllers []*EndpointController,
+) {
+	retained := map[string]bool{}
+
+	if serviceImport.GetLabels()[c.keys.sourceCluster] == c.clusterID {
+		for _, namespace := range c.originNamespaces(serviceImport) {
+			retained[namespace+"/"+serviceImport.GetAnnotations()[lhconstants.OriginName]] = true
+		}
+	}
+
+	for _, endpointController := range endpointControllers {
+		if retained[endpointController.serviceImportSourceNameSpace+"/"+endpointController.serviceName] {
+			endpointController.stopSyncers()
+			continue
+		}
+
+		if err := endpointController.stop(ctx); err != nil {
+			klog.ErrorS(err, "Error deleting the EndpointSlices associated with the ServiceImport", "serviceImport", key)
+		}
+	}
+}
+
+// endpointControllerInfos returns a snapshot of the running EndpointControllers, ordered by ServiceImport key and
+// service namespace. It's safe to call concurrently with the reconciliation.
+func (c *ServiceImportController) endpointControllerInfos() []EndpointControllerInfo {
+	infos := []EndpointControllerInfo{}
+
+	c.endpointControllers.Range(func(key, value interface{}) bool {
+		for _, endpointController := range value.([]*EndpointController) {
+			infos = append(infos, endpointController.info(key.(string)))
+		}
+
+		return true
+	})
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ServiceImport != infos[j].ServiceImport {
+			return infos[i].ServiceImport < infos[j].ServiceImport
+		}
+
+		return infos[i].ServiceNamespace < infos[j].ServiceNamespace
+	})
+
+	return infos
+}
+
+// superviseEndpointControllers watches the given EndpointControllers of the ServiceImport with the given key, until
+// they're stopped, to restart them all if any exits unexpectedly.
+func (c *ServiceImportController) superviseEndpointControllers(key string, endpointControllers []*EndpointController) {
+	for _, endpointController := range endpointControllers {
+		go func(endpointController *EndpointController) {
+			select {
+			case <-endpointController.exited:
+				c.endpointControllerExited(key, endpointControllers, endpointController.exitErr)
+			case <-endpointController.stopCh:
+			}
+		}(endpointController)
+	}
+}
+
+// endpointControllerExited stops the given EndpointControllers of the ServiceImport with the given key, one of which
+// exited with the given error, and reconciles the ServiceImport again to start new ones. Their EndpointSlices are left
+// as is, rather than deleted, so they remain available until the new EndpointControllers update them.
+func (c *ServiceImportController) endpointControllerExited(key string, endpointControllers []*EndpointController, err error) {
+	c.metrics.incFailure(endpointControllerExitFailure)
+	klog.ErrorS(err, "The endpoint controller exited unexpectedly - restarting it", "serviceImport", key)
+
+	unlock := c.keyMutex.lock(key)
+
+	// The ServiceImport may have been reconciled in the meantime, after its deletion and re-creation, in which case its
+	// current EndpointControllers are left running.
+	obj, found := c.endpointControllers.Load(key)
+	current := found && obj.([]*EndpointController)[0] == endpointControllers[0]
+
+	if current {
+		c.endpointControllers.Delete(key)
+	}
+
+	unlock()
+
+	if !current {
 		return
 	}
 
+	for _, endpointController := range endpointControllers {
+		endpointController.stopSyncers()
+	}
+
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	c.setEndpointsSynced(c.ctx, name, namespace, corev1.ConditionFalse, endpointControllerExitedReason,
+		fmt.Sprintf("The endpoint controller exited unexpectedly: %v", err))
+
+	c.requeue(key)
+}
+
+// requeue reconciles the ServiceImport with the given key again, asynchronously.
+func (c *ServiceImportController) requeue(key string) {
+	if c.workQueue != nil {
+		c.workQueue.Add(key)
+	} else {
+		go c.reconcileKey(c.ctx, key)
+	}
+}
+
+// endpointControllerStartFailed records the failure to start one of the ServiceImport's EndpointControllers, returning
+// the reason of the recorded event.
+func (c *ServiceImportController) endpointControllerStartFailed(serviceImport *mcsv1a1.ServiceImport, key string, err error) string {
+	reason := endpointControllerStartFailedReason
+
+	if errors.Is(err, errInvalidPodSelector) {
+		reason = invalidPodSelectorReason
+		c.metrics.incFailure(invalidPodSelectorFailure)
+	} else {
+		c.metrics.incFailure(endpointControllerStartFailure)
+	}
+
+	c.eventRecorder.Event(serviceImport, corev1.EventTypeWarning, reason, err.Error())
+	klog.ErrorS(err, "Error starting the endpoint controller", "serviceImport", key)
+
+	return reason
+}
+
+// stopEndpointControllers stops the given EndpointControllers of the ServiceImport with the given key.
+func (c *ServiceImportController) stopEndpointControllers(ctx context.Context, key string, endpointControllers []*EndpointController) {
+	for _, endpointController := range endpointControllers {
+		if err := endpointController.stop(ctx); err != nil {
+			klog.ErrorS(err, "Error deleting the EndpointSlices associated with the ServiceImport", "serviceImport", key)
+		}
+	}
+}
+
+// recordIfTimedOut records the timeout of the reconciliation of the given ServiceImport, returning true, if the given
+// reconciliation context's deadline was exceeded.
+func (c *ServiceImportController) recordIfTimedOut(reconcileCtx context.Context, serviceImport *mcsv1a1.ServiceImport,
+	key string,
+) bool {
+	if !errors.Is(reconcileCtx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+
+	c.metrics.incFailure(reconcileTimeoutFailure)
+	c.eventRecorder.Eventf(serviceImport, corev1.EventTypeWarning, reconcileTimedOutReason,
+		"The reconciliation timed out after %v", c.reconcileTimeout)
+
+	klog.ErrorS(reconcileCtx.Err(), "Timed out reconciling ServiceImport", "serviceImport", key, "timeout", c.reconcileTimeout)
+
+	return true
+}
+
+// serviceImportDeleted stops the ServiceImport's EndpointController and deletes its EndpointSlices, returning whether
+// the deletion should be retried as not all the EndpointSlices could be deleted.
+func (c *ServiceImportController) serviceImportDeleted(ctx context.Context, serviceImport *mcsv1a1.ServiceImport, key string) bool {
+	if serviceImport.GetLabels()[c.keys.sourceCluster] != c.clusterID {
+		return false
+	}
+
+	defer c.keyMutex.lock(key)()
+
+	reconcileCtx, cancel := context.WithTimeout(ctx, c.reconcileTimeout)
+	defer cancel()
+
+	var errs []error
+
 	if obj, found := c.endpointControllers.LoadAndDelete(key); found {
-		endpointController := obj.(*EndpointController)
-		endpointController.stop()
+		for _, endpointController := range obj.([]*EndpointController) {
+			if err := endpointController.stop(reconcileCtx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	} else {
+		// The EndpointControllers aren't running, either because they failed to start or because a previous attempt to
+		// delete the EndpointSlices failed, so make sure they're deleted. As when they're created, they're deleted from
+		// the origin namespaces rather than the ServiceImport's namespace.
+		for _, namespace := range c.originNamespaces(serviceImport) {
+			err := deleteEndpointSlices(reconcileCtx, c.localClient, namespace, serviceImport.GetAnnotations()[lhconstants.OriginName],
+				c.clusterID, c.keys, c.dryRun)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		err := k8serrors.NewAggregate(errs)
+
+		c.recordIfTimedOut(reconcileCtx, serviceImport, key)
+		klog.ErrorS(err, "Error deleting the EndpointSlices associated with the ServiceImport", "serviceImport", key)
+		c.setEndpointsSynced(ctx, serviceImport.Name, serviceImport.Namespace, corev1.ConditionFalse,
+			endpointSliceDeletionFailedReason, err.Error())
+
+		return true
+	}
+
+	// This is a no-op once the ServiceImport is gone but records that its endpoints are no longer synced while its
+	// deletion is pending.
+	c.setEndpointsSynced(ctx, serviceImport.Name, serviceImport.Namespace, corev1.ConditionFalse, serviceImportDeletedReason,
+		"The ServiceImport was deleted")
+
+	return false
+}
+
+// originNamespaces returns the namespaces of the Services backing the ServiceImport: those listed, comma-separated, in
+// its OriginNamespacesAnnotation if present or otherwise its single OriginNamespace.
+func (c *ServiceImportController) originNamespaces(serviceImport *mcsv1a1.ServiceImport) []string {
+	annotations := serviceImport.GetAnnotations()
+
+	list, ok := annotations[c.keys.originNamespaces]
+	if !ok {
+		return []string{annotations[lhconstants.OriginNamespace]}
+	}
+
+	namespaces := []string{}
+	seen := map[string]bool{}
+
+	for _, namespace := range strings.Split(list, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces
+}
+
+// publishesNotReadyAddresses returns whether the given headless ServiceImport's Service with the given name, in the
+// given namespace, publishes its not-ready addresses.
+func (c *ServiceImportController) publishesNotReadyAddresses(serviceImport *mcsv1a1.ServiceImport, namespace, name string) bool {
+	if c.serviceLister == nil || serviceImport.Spec.Type != mcsv1a1.Headless {
+		return false
+	}
+
+	service, found, err := c.serviceLister.GetService(name, namespace)
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving the Service", "service", klog.KRef(namespace, name))
+		return false
+	}
+
+	return found && service.Spec.PublishNotReadyAddresses
+}
+
+// servicePodSelector returns the label selector of the pods of the Service with the given name, in the given namespace,
+// or empty if it has no selector or isn't found.
+func (c *ServiceImportController) servicePodSelector(namespace, name string) string {
+	if c.serviceLister == nil {
+		return ""
+	}
+
+	service, found, err := c.serviceLister.GetService(name, namespace)
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving the Service", "service", klog.KRef(namespace, name))
+		return ""
+	}
+
+	if !found {
+		return ""
+	}
+
+	return podSelectorOf(service)
+}
+
+// podSelectorOf returns the label selector of the given Service's pods or empty if it has no selector.
+func podSelectorOf(service *corev1.Service) string {
+	if len(service.Spec.Selector) == 0 {
+		return ""
+	}
+
+	return labels.SelectorFromSet(service.Spec.Selector).String()
+}
+
+// ipFamiliesOf returns the IP families of the Service backing the ServiceImport, listed, comma-separated, in its
+// IPFamiliesAnnotation, the primary one first. Unknown families are ignored.
+func (c *ServiceImportController) ipFamiliesOf(serviceImport *mcsv1a1.ServiceImport) []corev1.IPFamily {
+	list, ok := serviceImport.GetAnnotations()[c.keys.ipFamilies]
+	if !ok {
+		return nil
+	}
+
+	families := []corev1.IPFamily{}
+	seen := map[corev1.IPFamily]bool{}
+
+	for _, family := range strings.Split(list, ",") {
+		f := corev1.IPFamily(strings.TrimSpace(family))
+		if (f == corev1.IPv4Protocol || f == corev1.IPv6Protocol) && !seen[f] {
+			seen[f] = true
+			families = append(families, f)
+		}
+	}
+
+	return families
+}
+
+// isLocalServiceImport returns whether the ServiceImport originated from this cluster. The ServiceImports synced from
+// the other clusters via the broker are ignored as their EndpointSlices are built by their own cluster's agent.
+func (c *ServiceImportController) isLocalServiceImport(obj *unstructured.Unstructured, _ syncer.Operation) bool {
+	return obj.GetLabels()[c.keys.sourceCluster] == c.clusterID
+}
+
+// serviceImportActedOnAnnotations returns the annotations of a ServiceImport that its EndpointControllers are built from.
+func (c *ServiceImportController) serviceImportActedOnAnnotations() []string {
+	return []string{
+		lhconstants.OriginName, lhconstants.OriginNamespace, c.keys.originNamespaces, c.keys.endpointPodSelector,
+		c.keys.ipFamilies,
+	}
+}
+
+// serviceImportsEquivalent returns whether the given versions of a ServiceImport are equivalent, that is, they differ
+// only in fields that the controller doesn't act on, in which case the update isn't queued. Other controllers may
+// touch a ServiceImport's annotations frequently and each update would otherwise needlessly be reconciled.
+func (c *ServiceImportController) serviceImportsEquivalent(obj1, obj2 *unstructured.Unstructured) bool {
+	for _, field := range []string{"type", "ips", "ports"} {
+		v1, _, _ := unstructured.NestedFieldNoCopy(obj1.Object, "spec", field)
+		v2, _, _ := unstructured.NestedFieldNoCopy(obj2.Object, "spec", field)
+
+		if !equality.Semantic.DeepEqual(v1, v2) {
+			return false
+		}
+	}
+
+	if obj1.GetLabels()[c.keys.sourceCluster] != obj2.GetLabels()[c.keys.sourceCluster] {
+		return false
+	}
+
+	for _, key := range c.serviceImportActedOnAnnotations() {
+		v1, ok1 := obj1.GetAnnotations()[key]
+		v2, ok2 := obj2.GetAnnotations()[key]
+
+		if ok1 != ok2 || v1 != v2 {
+			return false
+		}
 	}
+
+	return true
 }
 
 func (c *ServiceImportController) serviceImportToEndpointController(obj runtime.Object, numRequeues int,
 	op syncer.Operation,
 ) (runtime.Object, bool) {
-	serviceImport := obj.(*mcsv1a1.ServiceImport)
+	serviceImport, ok := obj.(*mcsv1a1.ServiceImport)
+	if !ok {
+		klog.ErrorS(nil, "Expected a ServiceImport", "type", fmt.Sprintf("%T", obj), "action", op)
+		return nil, false
+	}
+
 	key, _ := cache.MetaNamespaceKeyFunc(serviceImport)
 
-	klog.V(log.DEBUG).Infof("ServiceImport %q %sd", key, op)
+	klog.V(log.DEBUG).InfoS("ServiceImport changed", "serviceImport", key, "action", op)
+
+	if !c.beginReconcile() {
+		klog.V(log.DEBUG).InfoS("Ignoring ServiceImport as the controller is stopping", "serviceImport", key)
+		return nil, false
+	}
+
+	defer c.endReconcile()
 
 	if op == syncer.Create || op == syncer.Update {
-		return nil, c.serviceImportCreatedOrUpdated(serviceImport, key)
+		if c.workQueue != nil {
+			c.workQueue.Add(key)
+			return nil, false
+		}
+
+		start := time.Now()
+		failed := c.serviceImportCreatedOrUpdated(c.ctx, serviceImport, key)
+
+		if c.retryLimiter == nil {
+			c.observeReconcile(serviceImport, key, start, numRequeues, failed)
+			return nil, failed
+		}
+
+		c.observeReconcile(serviceImport, key, start, c.retryLimiter.NumRequeues(key), failed)
+		c.retryIfFailed(c.ctx, key, failed)
+
+		return nil, false
 	}
 
-	c.serviceImportDeleted(serviceImport, key)
+	// The deleted ServiceImport can't be retrieved to be reconciled again so leave the retry to the ServiceImport watcher
+	// which keeps it until it's successfully processed.
+	if c.serviceImportDeleted(c.ctx, serviceImport, key) {
+		return nil, true
+	}
+
+	c.metrics.forget(key)
+
+	if c.retryLimiter != nil {
+		c.retryLimiter.Forget(key)
+	}
 
 	return nil, false
 }
+
+// retryParameters returns the configured retry parameters, defaulting the unset ones, and whether any is set.
+func retryParameters(spec *AgentSpecification) (baseDelay, maxDelay time.Duration, qps float64, burst int, set bool) {
+	baseDelay, maxDelay, qps, burst = spec.RetryBaseDelay, spec.RetryMaxDelay, spec.RetryQPS, spec.RetryBurst
+	set = baseDelay != 0 || maxDelay != 0 || qps != 0 || burst != 0
+
+	if baseDelay == 0 {
+		baseDelay = DefaultRetryBaseDelay
+	}
+
+	if maxDelay == 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+
+	if qps == 0 {
+		qps = DefaultRetryQPS
+	}
+
+	if burst == 0 {
+		burst = DefaultRetryBurst
+	}
+
+	return baseDelay, maxDelay, qps, burst, set
+}
+
+func validateRetryParameters(spec *AgentSpecification) error {
+	baseDelay, maxDelay, qps, burst, _ := retryParameters(spec)
+
+	if baseDelay < 0 || baseDelay > maxDelay {
+		return errors.Errorf("the retry base delay %v must be positive and not greater than the max delay %v",
+			baseDelay, maxDelay)
+	}
+
+	if qps < 0 || burst < 0 {
+		return errors.Errorf("the retry QPS %v and burst %d must be positive", qps, burst)
+	}
+
+	return nil
+}
+
+// newRetryLimiter returns the rate limiter for the retries of failed ServiceImport reconciliations or nil if the
+// ServiceImports are reconciled, and the retries rate limited, by the ServiceImport watcher.
+func newRetryLimiter(spec *AgentSpecification) workqueue.RateLimiter {
+	baseDelay, maxDelay, qps, burst, set := retryParameters(spec)
+	if !set && spec.Concurrency <= 1 {
+		return nil
+	}
+
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// retryIfFailed schedules a retry of the reconciliation of the ServiceImport with the given key, subject to the retry
+// rate limiter, if it failed and otherwise resets its backoff.
+func (c *ServiceImportController) retryIfFailed(ctx context.Context, key string, failed bool) {
+	// Without a retry limiter, a ServiceImport reconciled outside of the ServiceImport watcher, that is, whose
+	// EndpointControllers are restarted, is otherwise retried by the periodic reconciliation.
+	if c.retryLimiter == nil {
+		return
+	}
+
+	if !failed {
+		c.retryLimiter.Forget(key)
+		return
+	}
+
+	if c.workQueue != nil {
+		c.workQueue.AddRateLimited(key)
+		return
+	}
+
+	delay := c.retryLimiter.When(key)
+
+	klog.V(log.DEBUG).InfoS("Retrying the reconciliation of ServiceImport", "serviceImport", key, "delay", delay)
+
+	time.AfterFunc(delay, func() {
+		c.reconcileKey(ctx, key)
+	})
+}
+
+func (c *ServiceImportController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *ServiceImportController) processNextWorkItem(ctx context.Context) bool {
+	obj, shutdown := c.workQueue.Get()
+	if shutdown {
+		return false
+	}
+
+	defer c.workQueue.Done(obj)
+
+	c.reconcileKey(ctx, obj.(string))
+
+	return true
+}
+
+// reconcileKey reconciles the ServiceImport with the given key, as currently present in the ServiceImport watcher's
+// cache, retrying if it fails.
+func (c *ServiceImportController) reconcileKey(ctx context.Context, key string) {
+	if !c.beginReconcile() {
+		return
+	}
+
+	defer c.endReconcile()
+
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+
+	obj, found, err := c.serviceImportSyncer.GetResource(name, namespace)
+	if err != nil {
+		klog.ErrorS(err, "Error retrieving ServiceImport", "serviceImport", key)
+		c.retryIfFailed(ctx, key, true)
+
+		return
+	}
+
+	if !found {
+		c.metrics.forget(key)
+
+		if c.retryLimiter != nil {
+			c.retryLimiter.Forget(key)
+		}
+
+		return
+	}
+
+	serviceImport, ok := obj.(*mcsv1a1.ServiceImport)
+	if !ok {
+		klog.ErrorS(nil, "Expected a ServiceImport", "serviceImport", key, "type", fmt.Sprintf("%T", obj))
+		return
+	}
+
+	start := time.Now()
+	failed := c.serviceImportCreatedOrUpdated(ctx, serviceImport, key)
+
+	numRequeues := 0
+	if c.retryLimiter != nil {
+		numRequeues = c.retryLimiter.NumRequeues(key)
+	}
+
+	c.observeReconcile(serviceImport, key, start, numRequeues, failed)
+	c.retryIfFailed(ctx, key, failed)
+}
+
+// observeReconcile records the outcome of a reconciliation of the given ServiceImport and, if it thereby became stuck,
+// records a Warning event on it.
+func (c *ServiceImportController) observeReconcile(serviceImport *mcsv1a1.ServiceImport, key string, start time.Time,
+	numRequeues int, failed bool,
+) {
+	if !c.metrics.observeReconcile(key, start, numRequeues, failed) {
+		return
+	}
+
+	c.eventRecorder.Eventf(serviceImport, corev1.EventTypeWarning, reconcileStuckReason,
+		"The reconciliation has been retried %d times, exceeding the threshold of %d", numRequeues, c.metrics.stuckThreshold)
+
+	klog.ErrorS(nil, "ServiceImport reconciliation is stuck", "serviceImport", key, "retries", numRequeues,
+		"threshold", c.metrics.stuckThreshold)
+}
@@ -0,0 +1,517 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/submariner-io/admiral/pkg/fake"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	fakeKubeClient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/testing"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+var _ = Describe("ServiceImportController", func() {
+	var (
+		c           *ServiceImportController
+		localClient *fake.DynamicClient
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(discovery.AddToScheme(scheme)).To(Succeed())
+		Expect(mcsv1a1.AddToScheme(scheme)).To(Succeed())
+
+		localClient = fake.NewDynamicClient(scheme)
+
+		var err error
+
+		c, err = newServiceImportController(&AgentSpecification{ClusterID: "east", Namespace: test.LocalNamespace}, nil,
+			test.GetRESTMapperFor(&mcsv1a1.ServiceImport{}, &corev1.Endpoints{}, &corev1.Pod{}, &discovery.EndpointSlice{}),
+			localClient, scheme, fakeKubeClient.NewSimpleClientset(), prometheus.NewRegistry(), nil, newMetadataKeys(""))
+		Expect(err).To(Succeed())
+	})
+
+	When("a ServiceImport is reconciled concurrently", func() {
+		It("should start exactly one EndpointController", func() {
+
+			serviceImport := &mcsv1a1.ServiceImport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "nginx-service-ns-east",
+					Namespace: test.LocalNamespace,
+					Annotations: map[string]string{
+						lhconstants.OriginName:      "nginx",
+						lhconstants.OriginNamespace: "service-ns",
+					},
+					Labels: map[string]string{
+						lhconstants.LighthouseLabelSourceCluster: "east",
+					},
+				},
+			}
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					Expect(c.serviceImportCreatedOrUpdated(context.TODO(), serviceImport, "local-ns/nginx-service-ns-east")).To(BeFalse())
+				}()
+			}
+
+			wg.Wait()
+
+			defer func() {
+				obj, _ := c.endpointControllers.Load("local-ns/nginx-service-ns-east")
+				Expect(obj.([]*EndpointController)[0].stop(context.TODO())).To(Succeed())
+			}()
+
+			endpointsWatches := 0
+
+			for _, action := range localClient.Actions() {
+				if action.GetVerb() == "watch" && action.GetResource().Resource == "endpoints" {
+					endpointsWatches++
+				}
+			}
+
+			Expect(endpointsWatches).To(Equal(1))
+		})
+	})
+
+	When("a headless ServiceImport is created and deleted", func() {
+		const key = "local-ns/nginx-service-ns-east"
+
+		var serviceImport *mcsv1a1.ServiceImport
+
+		endpointSliceClient := func() dynamic.ResourceInterface {
+			return localClient.Resource(discovery.SchemeGroupVersion.WithResource("endpointslices")).Namespace("service-ns")
+		}
+
+		expectEndpointsSynced := func(status corev1.ConditionStatus, reason string) {
+			obj := test.GetResource(localClient.Resource(serviceImportGVR).Namespace(test.LocalNamespace), serviceImport)
+			condition := endpointsSyncedOf(obj.GetAnnotations(), lhconstants.EndpointsSyncedAnnotation)
+			Expect(condition).ToNot(BeNil())
+			Expect(condition.Status).To(Equal(status))
+			Expect(*condition.Reason).To(Equal(reason))
+			Expect(condition.LastTransitionTime).ToNot(BeNil())
+		}
+
+		// The ServiceImport resides in the agent's namespace, which differs from the Service's namespace so any
+		// EndpointSlice left in either namespace is found.
+		awaitNoEndpointSlices := func() {
+			Eventually(func() int {
+				list, err := localClient.Resource(discovery.SchemeGroupVersion.WithResource("endpointslices")).List(
+					context.TODO(), metav1.ListOptions{})
+				Expect(err).To(Succeed())
+
+				return len(list.Items)
+			}, 5).Should(BeZero())
+		}
+
+		BeforeEach(func() {
+			serviceImport = &mcsv1a1.ServiceImport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "nginx-service-ns-east",
+					Namespace: test.LocalNamespace,
+					Annotations: map[string]string{
+						lhconstants.OriginName:      "nginx",
+						lhconstants.OriginNamespace: "service-ns",
+					},
+					Labels: map[string]string{
+						lhconstants.LighthouseLabelSourceCluster: "east",
+					},
+				},
+				Spec: mcsv1a1.ServiceImportSpec{Type: mcsv1a1.Headless},
+			}
+
+			test.CreateResource(localClient.Resource(corev1.SchemeGroupVersion.WithResource("endpoints")).Namespace("service-ns"),
+				&corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "service-ns"},
+					Subsets: []corev1.EndpointSubset{{
+						Addresses: []corev1.EndpointAddress{{IP: "192.168.5.1", TargetRef: &corev1.ObjectReference{Name: "one"}}},
+					}},
+				})
+		})
+
+		It("should start an EndpointController that creates the EndpointSlice and stop it to delete the EndpointSlice", func() {
+			Expect(c.serviceImportCreatedOrUpdated(context.TODO(), serviceImport, key)).To(BeFalse())
+
+			_, found := c.endpointControllers.Load(key)
+			Expect(found).To(BeTrue())
+
+			test.AwaitResource(endpointSliceClient(), "nginx-east")
+
+			_, err := localClient.Resource(discovery.SchemeGroupVersion.WithResource("endpointslices")).Namespace(
+				test.LocalNamespace).Get(context.TODO(), "nginx-east", metav1.GetOptions{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			Expect(c.serviceImportDeleted(context.TODO(), serviceImport, key)).To(BeFalse())
+
+			_, found = c.endpointControllers.Load(key)
+			Expect(found).To(BeFalse())
+
+			awaitNoEndpointSlices()
+		})
+
+		When("its EndpointControllers are started", func() {
+			It("should record the EndpointsSynced condition as True on the ServiceImport", func() {
+				test.CreateResource(localClient.Resource(serviceImportGVR).Namespace(test.LocalNamespace), serviceImport)
+
+				Expect(c.serviceImportCreatedOrUpdated(context.TODO(), serviceImport, key)).To(BeFalse())
+
+				defer func() {
+					Expect(c.serviceImportDeleted(context.TODO(), serviceImport, key)).To(BeFalse())
+				}()
+
+				expectEndpointsSynced(corev1.ConditionTrue, endpointControllersStartedReason)
+			})
+		})
+
+		When("its EndpointControllers fail to start", func() {
+			It("should record the EndpointsSynced condition as False on the ServiceImport", func() {
+				serviceImport.Annotations[lhconstants.EndpointPodSelectorAnnotation] = "app in ("
+				test.CreateResource(localClient.Resource(serviceImportGVR).Namespace(test.LocalNamespace), serviceImport)
+
+				Expect(c.serviceImportCreatedOrUpdated(context.TODO(), serviceImport, key)).To(BeTrue())
+
+				expectEndpointsSynced(corev1.ConditionFalse, invalidPodSelectorReason)
+			})
+		})
+
+		When("it's deleted while still present", func() {
+			It("should record the EndpointsSynced condition as False on the ServiceImport", func() {
+				test.CreateResource(localClient.Resource(serviceImportGVR).Namespace(test.LocalNamespace), serviceImport)
+
+				Expect(c.serviceImportCreatedOrUpdated(context.TODO(), serviceImport, key)).To(BeFalse())
+				Expect(c.serviceImportDeleted(context.TODO(), serviceImport, key)).To(BeFalse())
+
+				expectEndpointsSynced(corev1.ConditionFalse, serviceImportDeletedReason)
+			})
+		})
+
+		When("its EndpointControllers aren't running", func() {
+			It("should delete the EndpointSlices on deletion", func() {
+				Expect(c.serviceImportCreatedOrUpdated(context.TODO(), serviceImport, key)).To(BeFalse())
+				test.AwaitResource(endpointSliceClient(), "nginx-east")
+
+				// Simulate an EndpointController that failed to start so isn't registered, leaving a stale EndpointSlice.
+				obj, _ := c.endpointControllers.LoadAndDelete(key)
+				for _, endpointController := range obj.([]*EndpointController) {
+					endpointController.stopSyncers()
+				}
+
+				Expect(c.serviceImportDeleted(context.TODO(), serviceImport, key)).To(BeFalse())
+				awaitNoEndpointSlices()
+			})
+		})
+
+		When("the agent is restarted with EndpointSlices left behind by its previous run", func() {
+			endpointSlicesGVR := discovery.SchemeGroupVersion.WithResource("endpointslices")
+
+			endpointSliceNames := func() []string {
+				list, err := localClient.Resource(endpointSlicesGVR).List(context.TODO(), metav1.ListOptions{})
+				Expect(err).To(Succeed())
+
+				names := []string{}
+				for i := range list.Items {
+					names = append(names, list.Items[i].GetNamespace()+"/"+list.Items[i].GetName())
+				}
+
+				return names
+			}
+
+			createEndpointSlice := func(namespace, name, serviceName, clusterID string) {
+				labels := endpointSliceOwnerLabels(c.keys, namespace, serviceName, clusterID)
+				labels[discovery.LabelManagedBy] = lhconstants.LabelValueManagedBy
+
+				test.CreateResource(localClient.Resource(endpointSlicesGVR).Namespace(namespace), &discovery.EndpointSlice{
+					ObjectMeta:  metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+					AddressType: discovery.AddressTypeIPv4,
+				})
+			}
+
+			BeforeEach(func() {
+				c.maxEndpointsPerSlice = 1
+				serviceImport.Annotations[lhconstants.IPFamiliesAnnotation] = "IPv4,IPv6"
+
+				test.UpdateResource(localClient.Resource(corev1.SchemeGroupVersion.WithResource("endpoints")).Namespace("service-ns"),
+					&corev1.Endpoints{
+						ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "service-ns"},
+						Subsets: []corev1.EndpointSubset{{
+							Addresses: []corev1.EndpointAddress{
+								{IP: "192.168.5.1", TargetRef: &corev1.ObjectReference{Name: "one"}},
+								{IP: "192.168.5.2", TargetRef: &corev1.ObjectReference{Name: "two"}},
+								{IP: "fd00::1", TargetRef: &corev1.ObjectReference{Name: "three"}},
+							},
+						}},
+					})
+
+				test.CreateResource(localClient.Resource(mcsv1a1.SchemeGroupVersion.WithResource("serviceimports")).
+					Namespace(test.LocalNamespace), serviceImport)
+
+				createEndpointSlice("service-ns", "nginx-east", "nginx", "east")
+				createEndpointSlice("service-ns", "nginx-east.1", "nginx", "east")
+				createEndpointSlice("service-ns", "nginx-east.ipv6", "nginx", "east")
+			})
+
+			It("should update the same EndpointSlices rather than creating new ones", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				localClient.ClearActions()
+
+				Expect(c.start(ctx)).To(Succeed())
+
+				endpointSliceIPs := func(name string) func() []string {
+					return func() []string {
+						obj, err := localClient.Resource(endpointSlicesGVR).Namespace("service-ns").Get(context.TODO(), name,
+							metav1.GetOptions{})
+						Expect(err).To(Succeed())
+
+						endpointSlice := &discovery.EndpointSlice{}
+						Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, endpointSlice)).To(Succeed())
+
+						ips := []string{}
+						for i := range endpointSlice.Endpoints {
+							ips = append(ips, endpointSlice.Endpoints[i].Addresses...)
+						}
+
+						return ips
+					}
+				}
+
+				Eventually(endpointSliceIPs("nginx-east"), 5).Should(ConsistOf("192.168.5.1"))
+				Eventually(endpointSliceIPs("nginx-east.1"), 5).Should(ConsistOf("192.168.5.2"))
+				Eventually(endpointSliceIPs("nginx-east.ipv6"), 5).Should(ConsistOf("fd00::1"))
+
+				Consistently(endpointSliceNames, 500*time.Millisecond).Should(ConsistOf("service-ns/nginx-east",
+					"service-ns/nginx-east.1", "service-ns/nginx-east.ipv6"))
+
+				for _, action := range localClient.Actions() {
+					Expect(action.GetVerb() == "create" && action.GetResource().Resource == "endpointslices").To(BeFalse(),
+						"unexpected EndpointSlice creation %#v", action)
+				}
+			})
+
+			It("should delete only those with no corresponding ServiceImport", func() {
+				createEndpointSlice("service-ns", "other-east", "other", "east")
+				createEndpointSlice("other-ns", "nginx-east", "nginx", "east")
+				createEndpointSlice("service-ns", "nginx-west", "nginx", "west")
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				Expect(c.start(ctx)).To(Succeed())
+
+				expected := []string{"service-ns/nginx-east", "service-ns/nginx-east.1", "service-ns/nginx-east.ipv6", "service-ns/nginx-west"}
+				Eventually(endpointSliceNames, 5).Should(ConsistOf(expected))
+				Consistently(endpointSliceNames, 500*time.Millisecond).Should(ConsistOf(expected))
+
+				deleted := []string{}
+
+				for _, action := range localClient.Actions() {
+					if action.GetVerb() == "delete" && action.GetResource().Resource == "endpointslices" {
+						deleted = append(deleted, action.GetNamespace()+"/"+action.(testing.DeleteAction).GetName())
+					}
+				}
+
+				Expect(deleted).To(ConsistOf("service-ns/other-east", "other-ns/nginx-east"))
+			})
+
+			It("should not delete those outside the watched namespaces", func() {
+				createEndpointSlice("other-ns", "nginx-east", "nginx", "east")
+
+				c.watchNamespaces = []string{"service-ns"}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				Expect(c.start(ctx)).To(Succeed())
+
+				expected := []string{"service-ns/nginx-east", "service-ns/nginx-east.1", "service-ns/nginx-east.ipv6", "other-ns/nginx-east"}
+				Eventually(endpointSliceNames, 5).Should(ConsistOf(expected))
+				Consistently(endpointSliceNames, 500*time.Millisecond).Should(ConsistOf(expected))
+			})
+		})
+
+		When("its EndpointController exits unexpectedly", func() {
+			It("should restart it", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				test.CreateResource(localClient.Resource(mcsv1a1.SchemeGroupVersion.WithResource("serviceimports")).
+					Namespace(test.LocalNamespace), serviceImport)
+				Expect(c.start(ctx)).To(Succeed())
+
+				var exited *EndpointController
+
+				Eventually(func() bool {
+					obj, found := c.endpointControllers.Load(key)
+					if found {
+						exited = obj.([]*EndpointController)[0]
+					}
+
+					return found
+				}, 5).Should(BeTrue())
+
+				test.AwaitResource(endpointSliceClient(), "nginx-east")
+
+				func() {
+					defer exited.recoverPanic()
+					panic("simulated")
+				}()
+
+				Eventually(func() *EndpointController {
+					obj, found := c.endpointControllers.Load(key)
+					if !found {
+						return nil
+					}
+
+					return obj.([]*EndpointController)[0]
+				}, 5).ShouldNot(Or(BeNil(), BeIdenticalTo(exited)))
+
+				Expect(exited.stopCh).To(BeClosed())
+				Expect(exited.exitErr).To(HaveOccurred())
+				test.AwaitResource(endpointSliceClient(), "nginx-east")
+			})
+		})
+
+		When("it isn't a local ServiceImport", func() {
+			It("should not start an EndpointController", func() {
+				serviceImport.Labels[lhconstants.LighthouseLabelSourceCluster] = "west"
+
+				Expect(c.serviceImportCreatedOrUpdated(context.TODO(), serviceImport, key)).To(BeFalse())
+
+				_, found := c.endpointControllers.Load(key)
+				Expect(found).To(BeFalse())
+			})
+		})
+	})
+
+	When("the retry state of a ServiceImport that no longer exists is left behind", func() {
+		const key = "local-ns/nginx-service-ns-east"
+
+		isRetrying := func() bool {
+			_, ok := c.metrics.retrying.Load(key)
+			return ok
+		}
+
+		It("should eventually be swept", func() {
+			c.retryStateMaxAge = 0
+			c.retryStateSweepInterval = 10 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			Expect(c.start(ctx)).To(Succeed())
+
+			c.metrics.observeReconcile(key, time.Now(), 1, true)
+
+			Eventually(isRetrying).Should(BeFalse())
+		})
+
+		It("should not be swept before its maximum age", func() {
+			c.metrics.observeReconcile(key, time.Now(), 1, true)
+
+			Expect(c.metrics.sweep(time.Minute, func(string) bool { return false })).To(BeEmpty())
+			Expect(isRetrying()).To(BeTrue())
+
+			Expect(c.metrics.sweep(0, func(string) bool { return true })).To(BeEmpty())
+			Expect(isRetrying()).To(BeTrue())
+
+			Expect(c.metrics.sweep(0, func(string) bool { return false })).To(Equal([]string{key}))
+			Expect(isRetrying()).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("serviceImportsEquivalent", func() {
+	var serviceImport *mcsv1a1.ServiceImport
+
+	BeforeEach(func() {
+		serviceImport = &mcsv1a1.ServiceImport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "nginx-service-ns-east",
+				Namespace: test.LocalNamespace,
+				Annotations: map[string]string{
+					lhconstants.OriginName:      "nginx",
+					lhconstants.OriginNamespace: "service-ns",
+				},
+				Labels: map[string]string{lhconstants.LighthouseLabelSourceCluster: "east"},
+			},
+			Spec: mcsv1a1.ServiceImportSpec{
+				Type:  mcsv1a1.ClusterSetIP,
+				IPs:   []string{"10.253.9.1"},
+				Ports: []mcsv1a1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80}},
+			},
+		}
+	})
+
+	DescribeTable("should return whether the ServiceImports differ in fields the controller acts on",
+		func(update func(*mcsv1a1.ServiceImport), expected bool) {
+			updated := serviceImport.DeepCopy()
+			update(updated)
+
+			c := &ServiceImportController{keys: newMetadataKeys("")}
+			Expect(c.serviceImportsEquivalent(test.ToUnstructured(serviceImport), test.ToUnstructured(updated))).To(Equal(expected))
+		},
+		Entry("when an unrelated annotation changes", func(si *mcsv1a1.ServiceImport) {
+			si.Annotations["touched-by"] = "another-controller"
+		}, true),
+		Entry("when the status changes", func(si *mcsv1a1.ServiceImport) {
+			si.Status.Clusters = []mcsv1a1.ClusterStatus{{Cluster: "east"}}
+		}, true),
+		Entry("when the type changes", func(si *mcsv1a1.ServiceImport) {
+			si.Spec.Type = mcsv1a1.Headless
+		}, false),
+		Entry("when the IPs change", func(si *mcsv1a1.ServiceImport) {
+			si.Spec.IPs = []string{"10.253.9.2"}
+		}, false),
+		Entry("when the ports change", func(si *mcsv1a1.ServiceImport) {
+			si.Spec.Ports[0].Protocol = corev1.ProtocolUDP
+		}, false),
+		Entry("when an origin annotation changes", func(si *mcsv1a1.ServiceImport) {
+			si.Annotations[lhconstants.OriginNamespace] = "other-ns"
+		}, false),
+		Entry("when the endpoint pod selector annotation is added", func(si *mcsv1a1.ServiceImport) {
+			si.Annotations[lhconstants.EndpointPodSelectorAnnotation] = ""
+		}, false),
+		Entry("when the source cluster label changes", func(si *mcsv1a1.ServiceImport) {
+			si.Labels[lhconstants.LighthouseLabelSourceCluster] = "west"
+		}, false),
+	)
+})
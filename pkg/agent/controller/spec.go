@@ -0,0 +1,125 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/pkg/errors"
+	lhconstants "github.com/submariner-io/lighthouse/pkg/constants"
+	validations "k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Validate checks that the AgentSpecification is usable, returning an error describing the first invalid field.
+func (s *AgentSpecification) Validate() error {
+	if s.ClusterID == "" {
+		return errors.New("the ClusterID must be set")
+	}
+
+	if errs := validations.IsDNS1123Label(s.ClusterID); len(errs) > 0 {
+		return errors.Errorf("%s is not a valid ClusterID %v", s.ClusterID, errs)
+	}
+
+	if errs := validations.IsValidLabelValue(s.ClusterID); len(errs) > 0 {
+		return errors.Errorf("%s is not a valid ClusterID %v", s.ClusterID, errs)
+	}
+
+	if s.Namespace == "" {
+		return errors.New("the Namespace must be set")
+	}
+
+	if errs := validations.IsDNS1123Label(s.Namespace); len(errs) > 0 {
+		return errors.Errorf("%s is not a valid Namespace %v", s.Namespace, errs)
+	}
+
+	if s.LeaderElectionNamespace != "" {
+		if errs := validations.IsDNS1123Label(s.LeaderElectionNamespace); len(errs) > 0 {
+			return errors.Errorf("%s is not a valid LeaderElectionNamespace %v", s.LeaderElectionNamespace, errs)
+		}
+	}
+
+	if s.LeaderElectionLeaseName != "" {
+		if errs := validations.IsDNS1123Subdomain(s.LeaderElectionLeaseName); len(errs) > 0 {
+			return errors.Errorf("%s is not a valid LeaderElectionLeaseName %v", s.LeaderElectionLeaseName, errs)
+		}
+	}
+
+	if s.ServiceTypeConflictPolicy != "" && s.ServiceTypeConflictPolicy != FirstExporterWins &&
+		s.ServiceTypeConflictPolicy != ClusterSetIPWins {
+		return errors.Errorf("%q is not a valid service type conflict policy - must be %q or %q", s.ServiceTypeConflictPolicy,
+			FirstExporterWins, ClusterSetIPWins)
+	}
+
+	if s.EndpointMode != "" && s.EndpointMode != EndpointModePods && s.EndpointMode != EndpointModeGateway {
+		return errors.Errorf("%q is not a valid endpoint mode - must be %q or %q", s.EndpointMode, EndpointModePods,
+			EndpointModeGateway)
+	}
+
+	if s.ServiceIPEndpoints && s.EndpointMode == EndpointModePods {
+		return errors.Errorf("the deprecated ServiceIPEndpoints conflicts with the %q endpoint mode", s.EndpointMode)
+	}
+
+	if s.Concurrency < 0 {
+		return errors.Errorf("the concurrency %d must not be negative", s.Concurrency)
+	}
+
+	if s.ShutdownDrainTimeout < 0 {
+		return errors.Errorf("the shutdown drain timeout %v must not be negative", s.ShutdownDrainTimeout)
+	}
+
+	if s.StartupRetryAttempts < 0 {
+		return errors.Errorf("the startup retry attempts %d must not be negative", s.StartupRetryAttempts)
+	}
+
+	if s.ReconcileTimeout < 0 {
+		return errors.Errorf("the reconcile timeout %v must not be negative", s.ReconcileTimeout)
+	}
+
+	if s.StuckRequeueThreshold < 0 {
+		return errors.Errorf("the stuck requeue threshold %d must not be negative", s.StuckRequeueThreshold)
+	}
+
+	if s.MaxEndpointsPerSlice < 0 || s.MaxEndpointsPerSlice > MaxEndpointsPerSliceLimit {
+		return errors.Errorf("the maximum endpoints per slice %d must be between 0 and %d", s.MaxEndpointsPerSlice,
+			MaxEndpointsPerSliceLimit)
+	}
+
+	for _, namespace := range s.WatchNamespaces {
+		if errs := validations.IsDNS1123Label(namespace); len(errs) > 0 {
+			return errors.Errorf("%s is not a valid watch namespace %v", namespace, errs)
+		}
+	}
+
+	if err := lhconstants.ValidateLabelPrefix(s.LabelPrefix); err != nil {
+		return err
+	}
+
+	return validateRetryParameters(s)
+}
+
+// endpointMode returns the effective EndpointMode, mapping the deprecated ServiceIPEndpoints to EndpointModeGateway if
+// the EndpointMode isn't set.
+func (s *AgentSpecification) endpointMode() string {
+	switch {
+	case s.EndpointMode != "":
+		return s.EndpointMode
+	case s.ServiceIPEndpoints:
+		return EndpointModeGateway
+	default:
+		return EndpointModePods
+	}
+}
@@ -0,0 +1,144 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/syncer/test"
+	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+)
+
+var _ = Describe("AgentSpecification validation", func() {
+	newSpec := func(mutate func(spec *controller.AgentSpecification)) *controller.AgentSpecification {
+		spec := &controller.AgentSpecification{
+			ClusterID: clusterID1,
+			Namespace: test.LocalNamespace,
+		}
+
+		mutate(spec)
+
+		return spec
+	}
+
+	DescribeTable("should succeed",
+		func(mutate func(spec *controller.AgentSpecification)) {
+			Expect(newSpec(mutate).Validate()).To(Succeed())
+		},
+		Entry("with only the required fields", func(spec *controller.AgentSpecification) {}),
+		Entry("with a 63 character ClusterID", func(spec *controller.AgentSpecification) {
+			spec.ClusterID = strings.Repeat("a", 63)
+		}),
+		Entry("with the periodic reconciliation disabled", func(spec *controller.AgentSpecification) {
+			spec.ReconcileInterval = -1
+		}),
+		Entry("with valid tunables", func(spec *controller.AgentSpecification) {
+			spec.Concurrency = 4
+			spec.ReconcileInterval = time.Minute
+			spec.ShutdownDrainTimeout = time.Second
+			spec.ServiceTypeConflictPolicy = controller.ClusterSetIPWins
+			spec.LeaderElectionLeaseName = "lighthouse.agent"
+			spec.LeaderElectionNamespace = "leases"
+			spec.LabelPrefix = "mcs.example.com/"
+			spec.EndpointMode = controller.EndpointModeGateway
+		}),
+		Entry("with the deprecated ServiceIPEndpoints and the gateway EndpointMode", func(spec *controller.AgentSpecification) {
+			spec.ServiceIPEndpoints = true
+			spec.EndpointMode = controller.EndpointModeGateway
+		}),
+		Entry("with a MaxEndpointsPerSlice of the EndpointSlice API maximum", func(spec *controller.AgentSpecification) {
+			spec.MaxEndpointsPerSlice = controller.MaxEndpointsPerSliceLimit
+		}),
+	)
+
+	DescribeTable("should fail",
+		func(mutate func(spec *controller.AgentSpecification)) {
+			Expect(newSpec(mutate).Validate()).ToNot(Succeed())
+		},
+		Entry("with an empty ClusterID", func(spec *controller.AgentSpecification) {
+			spec.ClusterID = ""
+		}),
+		Entry("with a too long ClusterID", func(spec *controller.AgentSpecification) {
+			spec.ClusterID = strings.Repeat("a", 64)
+		}),
+		Entry("with illegal characters in the ClusterID", func(spec *controller.AgentSpecification) {
+			spec.ClusterID = "east_cluster"
+		}),
+		Entry("with an upper case ClusterID", func(spec *controller.AgentSpecification) {
+			spec.ClusterID = "East"
+		}),
+		Entry("with an empty Namespace", func(spec *controller.AgentSpecification) {
+			spec.Namespace = ""
+		}),
+		Entry("with a too long Namespace", func(spec *controller.AgentSpecification) {
+			spec.Namespace = strings.Repeat("n", 64)
+		}),
+		Entry("with illegal characters in the Namespace", func(spec *controller.AgentSpecification) {
+			spec.Namespace = "submariner.operator"
+		}),
+		Entry("with illegal characters in the LeaderElectionNamespace", func(spec *controller.AgentSpecification) {
+			spec.LeaderElectionNamespace = "lease/ns"
+		}),
+		Entry("with illegal characters in the LeaderElectionLeaseName", func(spec *controller.AgentSpecification) {
+			spec.LeaderElectionLeaseName = "lighthouse_agent"
+		}),
+		Entry("with an unknown ServiceTypeConflictPolicy", func(spec *controller.AgentSpecification) {
+			spec.ServiceTypeConflictPolicy = "LastExporter"
+		}),
+		Entry("with an unknown EndpointMode", func(spec *controller.AgentSpecification) {
+			spec.EndpointMode = "nodes"
+		}),
+		Entry("with the deprecated ServiceIPEndpoints and the pods EndpointMode", func(spec *controller.AgentSpecification) {
+			spec.ServiceIPEndpoints = true
+			spec.EndpointMode = controller.EndpointModePods
+		}),
+		Entry("with a negative Concurrency", func(spec *controller.AgentSpecification) {
+			spec.Concurrency = -1
+		}),
+		Entry("with a negative ShutdownDrainTimeout", func(spec *controller.AgentSpecification) {
+			spec.ShutdownDrainTimeout = -time.Second
+		}),
+		Entry("with a negative ReconcileTimeout", func(spec *controller.AgentSpecification) {
+			spec.ReconcileTimeout = -time.Second
+		}),
+		Entry("with a MaxEndpointsPerSlice exceeding the EndpointSlice API maximum", func(spec *controller.AgentSpecification) {
+			spec.MaxEndpointsPerSlice = controller.MaxEndpointsPerSliceLimit + 1
+		}),
+		Entry("with illegal characters in a watch namespace", func(spec *controller.AgentSpecification) {
+			spec.WatchNamespaces = []string{"default", "team_a"}
+		}),
+		Entry("with a negative StuckRequeueThreshold", func(spec *controller.AgentSpecification) {
+			spec.StuckRequeueThreshold = -1
+		}),
+		Entry("with a label prefix not ending with a slash", func(spec *controller.AgentSpecification) {
+			spec.LabelPrefix = "mcs.example.com"
+		}),
+		Entry("with a label prefix that isn't a DNS subdomain", func(spec *controller.AgentSpecification) {
+			spec.LabelPrefix = "mcs_example/"
+		}),
+		Entry("with a retry base delay greater than the max delay", func(spec *controller.AgentSpecification) {
+			spec.RetryBaseDelay = time.Minute
+			spec.RetryMaxDelay = time.Second
+		}),
+	)
+})
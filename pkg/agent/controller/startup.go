@@ -0,0 +1,104 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+const DefaultStartupRetryAttempts = 5
+
+// StartupBackoff returns the backoff with which the API operations performed on startup are retried, as configured by
+// the given AgentSpecification.
+func StartupBackoff(spec *AgentSpecification) wait.Backoff {
+	attempts := spec.StartupRetryAttempts
+	if attempts == 0 {
+		attempts = DefaultStartupRetryAttempts
+	}
+
+	return wait.Backoff{
+		Steps:    attempts,
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Cap:      30 * time.Second,
+	}
+}
+
+// RetryTransientErrors runs the given operation, retrying it with the given backoff for as long as it fails with an
+// error that may be transient, eg if the API server is briefly unavailable. The last error is returned if the backoff
+// is exhausted.
+func RetryTransientErrors(backoff wait.Backoff, operation func() error) error {
+	return retry.OnError(backoff, isTransientError, operation) // nolint:wrapcheck // Let the caller wrap
+}
+
+// retryOnConflict runs the given write operation, which must retrieve the latest version of the resource it writes,
+// promptly retrying it if it fails with a conflict, eg when another component or a resync wrote the resource in the
+// meantime. Other errors are returned as is so the caller's rate-limited requeue applies.
+func retryOnConflict(operation func() error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, operation) // nolint:wrapcheck // Let the caller wrap
+}
+
+// awaitMCSResources waits, with the startup backoff, for the ServiceExport and ServiceImport resources to be served by
+// the API server, that is, for their CRDs to be installed and established, so their syncers aren't started to then
+// fail to watch them indefinitely, eg if the agent is installed along with the CRDs. An error naming the missing
+// resources is returned if they don't appear before the backoff is exhausted.
+func (a *Controller) awaitMCSResources() error {
+	err := RetryTransientErrors(a.startupBackoff, func() error {
+		resources, err := a.kubeClientSet.Discovery().ServerResourcesForGroupVersion(mcsv1a1.GroupVersion.String())
+		if err != nil {
+			klog.InfoS("Waiting for the multi-cluster services resources to be served", "error", err.Error())
+			return errors.Wrapf(err, "error discovering the %s resources", mcsv1a1.GroupVersion.String())
+		}
+
+		served := map[string]bool{}
+		for i := range resources.APIResources {
+			served[resources.APIResources[i].Name] = true
+		}
+
+		missing := []string{}
+
+		for _, name := range []string{"serviceexports", "serviceimports"} {
+			if !served[name] {
+				missing = append(missing, name)
+			}
+		}
+
+		if len(missing) > 0 {
+			klog.InfoS("Waiting for the multi-cluster services resources to be served", "missing", missing)
+			return errors.Errorf("the %s resources %v aren't served", mcsv1a1.GroupVersion.String(), missing)
+		}
+
+		return nil
+	})
+
+	return errors.Wrap(err, "the multi-cluster services CRDs aren't installed")
+}
+
+func isTransientError(err error) bool {
+	return !apierrors.IsForbidden(err) && !apierrors.IsUnauthorized(err) && !apierrors.IsInvalid(err) &&
+		!apierrors.IsBadRequest(err) && !apierrors.IsMethodNotSupported(err) && !apierrors.IsAlreadyExists(err)
+}
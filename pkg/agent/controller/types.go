@@ -19,21 +19,33 @@ limitations under the License.
 package controller
 
 import (
+	"context"
 	"sync"
+	"time"
 
+	"github.com/submariner-io/admiral/pkg/federate"
 	"github.com/submariner-io/admiral/pkg/syncer"
 	"github.com/submariner-io/admiral/pkg/syncer/broker"
 	"github.com/submariner-io/admiral/pkg/watcher"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
 type Controller struct {
 	clusterID               string
 	globalnetEnabled        bool
+	conflictPolicy          string
 	namespace               string
 	kubeClientSet           kubernetes.Interface
 	serviceExportClient     dynamic.NamespaceableResourceInterface
@@ -41,7 +53,32 @@ type Controller struct {
 	serviceImportSyncer     *broker.Syncer
 	endpointSliceSyncer     *broker.Syncer
 	serviceSyncer           syncer.Interface
+	serviceLister           ServiceLister
 	serviceImportController *ServiceImportController
+	leaseName               string
+	leaseNamespace          string
+	ready                   int32
+	startupBackoff          wait.Backoff
+	keys                    *metadataKeys
+	// watchNamespaces are the namespaces watched by the agent or nil if all are.
+	watchNamespaces map[string]bool
+	// endpointsSynced holds the EndpointsSynced condition of each cluster exporting a service, by service key then
+	// cluster ID, as recorded on the ServiceImports synced to and from the broker.
+	endpointsSynced      map[string]map[string]mcsv1a1.ServiceExportCondition
+	endpointsSyncedMutex sync.Mutex
+}
+
+// ServiceLister retrieves the Service backing a ServiceExport.
+type ServiceLister interface {
+	GetService(name, namespace string) (*corev1.Service, bool, error)
+}
+
+// EndpointFilter returns whether the endpoint backed by the given pod is published in the service's EndpointSlices.
+type EndpointFilter func(pod *corev1.Pod) bool
+
+// syncerServiceLister is the default ServiceLister backed by the Service syncer's informer cache.
+type syncerServiceLister struct {
+	syncer syncer.Interface
 }
 
 type AgentSpecification struct {
@@ -49,13 +86,136 @@ type AgentSpecification struct {
 	Namespace        string
 	GlobalnetEnabled bool `split_words:"true"`
 	Uninstall        bool
+	ReadinessGates   []string `split_words:"true"`
+	// EndpointMetadataKeys are the pod label or annotation keys whose values are published, per endpoint, in the
+	// EndpointMetadataAnnotation of the exported EndpointSlices.
+	EndpointMetadataKeys []string `split_words:"true"`
+	// ReconcileInterval is the interval at which all the local ServiceImports are periodically re-synced, as a safety net
+	// against missed events and EndpointSlices deleted out of band, in addition to the event-driven reconciliation. If
+	// zero, DefaultReconcileInterval is used. If negative, the periodic re-sync is disabled.
+	ReconcileInterval time.Duration `split_words:"true"`
+	// ServiceIPEndpoints, if set, causes the EndpointSlice of an exported ClusterSetIP service to contain a single
+	// endpoint with the service IP from the ServiceImport instead of the addresses of the backing pods.
+	//
+	// Deprecated: set EndpointMode to EndpointModeGateway instead. ServiceIPEndpoints is only honored if EndpointMode
+	// is unset, and setting it along with the EndpointModePods EndpointMode is rejected.
+	ServiceIPEndpoints bool `split_words:"true"`
+	// EndpointMode determines the endpoints of the EndpointSlice of an exported ClusterSetIP service. It is either
+	// EndpointModePods, the addresses of the backing pods, or EndpointModeGateway, a single endpoint with the service
+	// IP from the ServiceImport, which is the service's global IP with Globalnet, so the traffic is routed via the
+	// gateway rather than to pod IPs that may not be routable from the other clusters. If unset, it's
+	// EndpointModeGateway if the deprecated ServiceIPEndpoints is set and EndpointModePods otherwise.
+	EndpointMode string `split_words:"true"`
+	// ShutdownDrainTimeout is the maximum time to wait, on shutdown, for in-flight ServiceImport reconciliations to
+	// complete before the EndpointControllers are stopped. If zero, DefaultShutdownDrainTimeout is used.
+	ShutdownDrainTimeout time.Duration `split_words:"true"`
+	// RetryBaseDelay, RetryMaxDelay, RetryQPS and RetryBurst, if any is set, configure the rate limiting of the retries
+	// of failed ServiceImport reconciliations: the per-ServiceImport exponential backoff starts at RetryBaseDelay and
+	// is capped at RetryMaxDelay, and the overall retry rate is limited to RetryQPS with bursts of RetryBurst. Unset
+	// parameters default to the DefaultRetry values. If none is set, the retries are rate limited by the ServiceImport
+	// watcher's work queue.
+	RetryBaseDelay time.Duration `split_words:"true"`
+	RetryMaxDelay  time.Duration `split_words:"true"`
+	RetryQPS       float64       `split_words:"true"`
+	RetryBurst     int           `split_words:"true"`
+	// Concurrency is the number of workers reconciling the ServiceImports concurrently. If less than 2, the
+	// ServiceImports are reconciled one at a time by the ServiceImport watcher.
+	Concurrency int
+	// HTTPServerAddress is the listen address of the agent's HTTP server exposing the metrics and the /healthz and
+	// /readyz probes. If empty, ":8082" is used.
+	HTTPServerAddress string `split_words:"true"`
+	// DryRun, if set, causes the EndpointSlices to be created, updated and deleted as dry runs, validated and
+	// authorized by the API server but not persisted, and the intended changes to be logged. EndpointSlices are thus
+	// neither exported nor removed.
+	DryRun bool `split_words:"true"`
+	// StartupRetryAttempts is the maximum number of attempts of the API operations performed on startup, which are
+	// retried with an exponential backoff if they fail transiently. If zero, DefaultStartupRetryAttempts is used.
+	StartupRetryAttempts int `split_words:"true"`
+	// MaxEndpointsPerSlice is the maximum number of endpoints in an exported EndpointSlice - the endpoints of a service
+	// exceeding it are split across additional EndpointSlices. It can't exceed MaxEndpointsPerSliceLimit. If zero,
+	// DefaultMaxEndpointsPerSlice, the default of the Kubernetes EndpointSlice controller, is used.
+	MaxEndpointsPerSlice int `split_words:"true"`
+	// PublishTopology, if set, causes the zone of each exported endpoint, from the topology.kubernetes.io/zone label of
+	// the node of its backing pod, to be published in the endpoint's zone and hints for same-zone routing. Endpoints
+	// whose node has no zone label are published without.
+	PublishTopology bool `split_words:"true"`
+	// ReconcileTimeout is the maximum duration of the reconciliation of a ServiceImport, after which it's abandoned and
+	// retried. If zero, DefaultReconcileTimeout is used.
+	ReconcileTimeout time.Duration `split_words:"true"`
+	// WatchNamespaces, if set, restricts the namespaces whose Services can be exported, and into which the EndpointSlices
+	// of imported services are synced, to those listed so the agent doesn't need cluster-wide watch access to them. If
+	// empty, all namespaces are watched.
+	WatchNamespaces []string `split_words:"true"`
+	// LeaderElection, if set, causes the agent to be run via RunWithLeaderElection so only one of multiple replicas
+	// runs the controllers at a time.
+	LeaderElection bool `split_words:"true"`
+	// LeaderElectionLeaseName is the name of the Lease used to elect the agent replica that runs the controllers. If
+	// empty, DefaultLeaderElectionLeaseName is used.
+	LeaderElectionLeaseName string `split_words:"true"`
+	// LeaderElectionNamespace is the namespace of the leader election Lease. If empty, Namespace is used.
+	LeaderElectionNamespace string `split_words:"true"`
+	// ServiceTypeConflictPolicy determines which export wins when clusters export a service with conflicting
+	// ServiceImport types. It is either FirstExporterWins (the default) or ClusterSetIPWins.
+	ServiceTypeConflictPolicy string `split_words:"true"`
+	// LabelPrefix is the prefix, a DNS subdomain followed by a "/", of the keys of the Lighthouse labels and annotations
+	// set on the generated ServiceImports and EndpointSlices. It must be the same in all the clusters, as the agents read
+	// those of each other's, and in the DNS servers' label_prefix. If empty, DefaultLabelPrefix is used.
+	LabelPrefix string `split_words:"true"`
+	// StuckRequeueThreshold is the number of retries of a failing ServiceImport reconciliation beyond which the
+	// ServiceImport is reported as stuck, until it's successfully reconciled. If zero, DefaultStuckRequeueThreshold is
+	// used.
+	StuckRequeueThreshold int `split_words:"true"`
+}
+
+const (
+	DefaultReconcileInterval     = 10 * time.Minute
+	DefaultShutdownDrainTimeout  = 30 * time.Second
+	DefaultMaxEndpointsPerSlice  = 100
+	DefaultReconcileTimeout      = 30 * time.Second
+	DefaultStuckRequeueThreshold = 50
+)
+
+// MaxEndpointsPerSliceLimit is the maximum number of endpoints in an EndpointSlice allowed by the EndpointSlice API.
+const MaxEndpointsPerSliceLimit = 1000
+
+// Defaults of the AgentSpecification Retry parameters, identical to the ServiceImport watcher's work queue rate limiting.
+const (
+	DefaultRetryBaseDelay = 5 * time.Millisecond
+	DefaultRetryMaxDelay  = 30 * time.Second
+	DefaultRetryQPS       = 10
+	DefaultRetryBurst     = 100
+)
+
+// Values of AgentSpecification.ServiceTypeConflictPolicy.
+const (
+	// FirstExporterWins resolves a service type conflict in favor of the cluster whose ServiceExport is oldest, ties
+	// being broken by cluster ID.
+	FirstExporterWins = "FirstExporter"
+
+	// ClusterSetIPWins resolves a service type conflict in favor of the clusters exporting the service as ClusterSetIP.
+	ClusterSetIPWins = "ClusterSetIP"
+)
+
+// Values of AgentSpecification.EndpointMode.
+const (
+	// EndpointModePods publishes the addresses of the pods backing an exported service.
+	EndpointModePods = "pods"
+
+	// EndpointModeGateway publishes the service IP of an exported ClusterSetIP service.
+	EndpointModeGateway = "gateway"
+)
+
+// ClusterCondition is a ServiceExport condition reported by the cluster with the given ID.
+type ClusterCondition struct {
+	ClusterID string
+	Condition mcsv1a1.ServiceExportCondition
 }
 
 // The ServiceImportController listens for ServiceImport resources created in the target namespace
 // and creates an EndpointController in response. The EndpointController will use the app label as filter
 // to listen only for the endpoints event related to ServiceImport created.
 type ServiceImportController struct {
-	serviceSyncer        syncer.Interface
+	serviceLister        ServiceLister
 	localClient          dynamic.Interface
 	restMapper           meta.RESTMapper
 	serviceImportSyncer  syncer.Interface
@@ -63,12 +223,49 @@ type ServiceImportController struct {
 	clusterID            string
 	scheme               *runtime.Scheme
 	globalIngressIPCache *globalIngressIPCache
+	readinessGates       []string
+	endpointMetadataKeys []string
+	reconcileInterval    time.Duration
+	serviceIPEndpoints   bool
+	metrics              *serviceImportMetrics
+	drainTimeout         time.Duration
+	stopMutex            sync.Mutex
+	stopping             bool
+	inFlight             sync.WaitGroup
+	stopped              chan struct{}
+	eventBroadcaster     record.EventBroadcaster
+	eventRecorder        record.EventRecorder
+	eventSink            record.EventSink
+	retryLimiter         workqueue.RateLimiter
+	keyMutex             keyedMutex
+	concurrency          int
+	workQueue            workqueue.RateLimitingInterface
+	dryRun               bool
+	maxEndpointsPerSlice int
+	nodeZoneCache        *nodeZoneCache
+	reconcileTimeout     time.Duration
+	// retryStateMaxAge is the age of its last failed reconciliation beyond which the retry state of a ServiceImport that
+	// no longer exists is swept, every retryStateSweepInterval.
+	retryStateMaxAge        time.Duration
+	retryStateSweepInterval time.Duration
+	// ctx is the context the controller was started with, used by the ServiceImport watcher's callbacks which aren't
+	// passed one.
+	ctx            context.Context
+	endpointFilter EndpointFilter
+	keys           *metadataKeys
+	// watchNamespaces, if set, are the only namespaces the EndpointSlices are created in.
+	watchNamespaces []string
 }
 
 // Each EndpointController listens for the endpoints that backs a service and have a ServiceImport
 // It will create an endpoint slice corresponding to an endpoint object and set the owner references
-// to ServiceImport. The app label from the endpoint will be added to endpoint slice as well.
+// to ServiceImport. The EndpointSlices are created in the service's namespace, serviceImportSourceNameSpace, rather
+// than in the ServiceImport's namespace, and are deleted from that same namespace. They're named deterministically, after
+// the service, its namespace if the ServiceImport is backed by Services in multiple namespaces, and the cluster ID, so
+// those created before an agent restart are updated rather than duplicated.
 type EndpointController struct {
+	// serviceImport is the version of the ServiceImport the EndpointController was built from.
+	serviceImport                *mcsv1a1.ServiceImport
 	serviceImportUID             types.UID
 	clusterID                    string
 	serviceImportName            string
@@ -76,10 +273,67 @@ type EndpointController struct {
 	serviceImportSourceNameSpace string
 	stopCh                       chan struct{}
 	stopOnce                     sync.Once
+	exited                       chan struct{}
+	exitOnce                     sync.Once
+	exitErr                      error
 	isHeadless                   bool
+	serviceIP                    string
+	servicePorts                 []mcsv1a1.ServicePort
 	localClient                  dynamic.Interface
 	ingressIPClient              dynamic.NamespaceableResourceInterface
 	globalIngressIPCache         *globalIngressIPCache
+	nodeZoneCache                *nodeZoneCache
+	readinessGates               []corev1.PodConditionType
+	podSelector                  labels.Selector
+	metadataKeys                 []string
+	podSyncer                    syncer.Interface
+	endpointsSyncer              syncer.Interface
+	federator                    federate.Federator
+	endpointsMutex               sync.Mutex
+	endpoints                    *corev1.Endpoints
+	dryRun                       bool
+	serviceImportLabel           string
+	maxEndpointsPerSlice         int
+	// addressTypes are the address types of a dual-stack service's EndpointSlices, the primary one first, or empty for
+	// a single-stack service.
+	addressTypes     []discovery.AddressType
+	extraSlicesMutex sync.Mutex
+	// extraSliceNames are the names of the additional EndpointSlices last distributed, or nil if not yet known.
+	extraSliceNames map[string]bool
+	// importPorts are the ports declared by the ServiceImport, which take precedence over those of the Endpoints.
+	importPorts         []mcsv1a1.ServicePort
+	eventRecorder       record.EventRecorder
+	eventTarget         runtime.Object
+	portDivergenceMutex sync.Mutex
+	// portDivergence describes the divergence last reported between the ServiceImport's and the Endpoints' ports.
+	portDivergence string
+	endpointFilter EndpointFilter
+	// publishNotReadyAddresses is set if the headless service publishes its not-ready addresses, as of when the
+	// EndpointController was built.
+	publishNotReadyAddresses bool
+	// servicePodSelector is the label selector of the service's pods, which restricts the pods watched, as of when the
+	// EndpointController was built, or empty if the service has no selector so all the pods in its namespace are.
+	servicePodSelector string
+	syncInfoMutex      sync.Mutex
+	// numEndpointSlices and numEndpoints are the numbers of EndpointSlices, and endpoints in them, last distributed, at
+	// lastSync.
+	numEndpointSlices int
+	numEndpoints      int
+	lastSync          time.Time
+	keys              *metadataKeys
+}
+
+// EndpointControllerInfo is a snapshot of a running EndpointController's state, for debugging.
+type EndpointControllerInfo struct {
+	// ServiceImport is the namespace/name key of the ServiceImport.
+	ServiceImport    string       `json:"serviceImport"`
+	ServiceNamespace string       `json:"serviceNamespace"`
+	ServiceName      string       `json:"serviceName"`
+	ClusterID        string       `json:"clusterID"`
+	UID              types.UID    `json:"uid"`
+	EndpointSlices   int          `json:"endpointSlices"`
+	Endpoints        int          `json:"endpoints"`
+	LastSync         *metav1.Time `json:"lastSync,omitempty"`
 }
 
 type globalIngressIPCache struct {
@@ -88,3 +342,10 @@ type globalIngressIPCache struct {
 	byPod     sync.Map
 	watcher   watcher.Interface
 }
+
+// nodeZoneCache caches the zone of each node, from its topology.kubernetes.io/zone label, to publish the zone of the
+// endpoints backed by pods on the node.
+type nodeZoneCache struct {
+	byNode  sync.Map
+	watcher watcher.Interface
+}
@@ -20,6 +20,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -31,15 +32,18 @@ import (
 	"github.com/submariner-io/admiral/pkg/syncer/broker"
 	"github.com/submariner-io/admiral/pkg/util"
 	"github.com/submariner-io/lighthouse/pkg/agent/controller"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/klog"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 )
 
+const defaultHTTPServerAddress = ":8082"
+
 var (
 	masterURL  string
 	kubeConfig string
@@ -86,7 +90,15 @@ func main() {
 		klog.Fatalf("Error building clientset: %s", err.Error())
 	}
 
-	restMapper, err := util.BuildRestMapper(cfg)
+	var restMapper meta.RESTMapper
+
+	// Building the RESTMapper performs API discovery so retry if the API server is briefly unavailable.
+	err = controller.RetryTransientErrors(controller.StartupBackoff(&agentSpec), func() error {
+		var err error
+		restMapper, err = util.BuildRestMapper(cfg)
+
+		return err // nolint:wrapcheck // No need to wrap
+	})
 	if err != nil {
 		klog.Fatal(err.Error())
 	}
@@ -118,7 +130,7 @@ func main() {
 	if agentSpec.Uninstall {
 		klog.Info("Uninstalling lighthouse")
 
-		err := lightHouseAgent.Cleanup()
+		err := lightHouseAgent.Cleanup(ctx)
 		if err != nil {
 			klog.Fatalf("Error cleaning up the lighthouse agent controller: %+v", err)
 		}
@@ -126,18 +138,22 @@ func main() {
 		return
 	}
 
-	if err := lightHouseAgent.Start(ctx.Done()); err != nil {
-		klog.Fatalf("Failed to start lighthouse agent: %v", err)
-	}
+	httpServer := startHTTPServer(agentSpec.HTTPServerAddress, lightHouseAgent)
 
-	httpServer := startHTTPServer()
+	if agentSpec.LeaderElection {
+		runWithLeaderElection(ctx, lightHouseAgent)
+	} else {
+		if err := lightHouseAgent.Start(ctx); err != nil {
+			klog.Fatalf("Failed to start lighthouse agent: %v", err)
+		}
 
-	<-ctx.Done()
+		<-ctx.Done()
+	}
 
 	klog.Info("All controllers stopped or exited. Stopping main loop")
 
 	if err := httpServer.Shutdown(context.TODO()); err != nil {
-		klog.Errorf("Error shutting down metrics HTTP server: %v", err)
+		klog.Errorf("Error shutting down HTTP server: %v", err)
 	}
 }
 
@@ -147,14 +163,55 @@ func init() {
 		"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 }
 
-func startHTTPServer() *http.Server {
-	srv := &http.Server{Addr: ":8082"}
+func runWithLeaderElection(ctx context.Context, lightHouseAgent *controller.Controller) {
+	identity, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("Error determining the leader election identity: %v", err)
+	}
+
+	err = lightHouseAgent.RunWithLeaderElection(ctx, identity)
+	if errors.Is(err, controller.ErrLeadershipLost) {
+		// The controllers can't be restarted so exit and let the replica be restarted as a standby.
+		klog.Fatalf("Lighthouse agent %q lost the leader election", identity)
+	}
+
+	if err != nil {
+		klog.Fatalf("Failed to run lighthouse agent: %v", err)
+	}
+}
+
+func startHTTPServer(addr string, lightHouseAgent *controller.Controller) *http.Server {
+	if addr == "" {
+		addr = defaultHTTPServerAddress
+	}
+
+	srv := &http.Server{Addr: addr}
 
 	http.Handle("/metrics", promhttp.Handler())
 
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if lightHouseAgent.Ready() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	http.HandleFunc("/debug/endpoint-controllers", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(lightHouseAgent.EndpointControllers()); err != nil {
+			klog.Errorf("Error encoding the endpoint controllers: %v", err)
+		}
+	})
+
 	go func() {
 		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			klog.Errorf("Error starting metrics server: %v", err)
+			klog.Errorf("Error starting HTTP server: %v", err)
 		}
 	}()
 
@@ -28,4 +28,18 @@ const (
 	LabelValueManagedBy                = "lighthouse-agent.submariner.io"
 	MCSLabelServiceName                = "multicluster.kubernetes.io/service-name"
 	MCSLabelSourceCluster              = "multicluster.kubernetes.io/source-cluster"
+	IPFamilyPolicyAnnotation           = "lighthouse.submariner.io/ip-family-policy"
+	IPFamiliesAnnotation               = "lighthouse.submariner.io/ip-families"
+	ClusterSetTrafficPolicyAnnotation  = "lighthouse.submariner.io/clusterset-traffic-policy"
+	EndpointPodSelectorAnnotation      = "lighthouse.submariner.io/endpoint-pod-selector"
+	ExportTimestampAnnotation          = "lighthouse.submariner.io/export-timestamp"
+	EndpointMetadataAnnotation         = "lighthouse.submariner.io/endpoint-metadata"
+	OriginNamespacesAnnotation         = "lighthouse.submariner.io/origin-namespaces"
+	LabelServiceImportName             = "lighthouse.submariner.io/serviceImportName"
+	EndpointsSyncedAnnotation          = "lighthouse.submariner.io/endpoints-synced"
+	EndpointExcludeAnnotation          = "lighthouse.submariner.io/exclude"
 )
+
+// ClusterSetTrafficPolicyLocal is the value of the ClusterSetTrafficPolicyAnnotation, set on an exported Service, that
+// restricts DNS answers for the service to the querying cluster's own endpoints.
+const ClusterSetTrafficPolicyLocal = "Local"
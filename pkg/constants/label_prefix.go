@@ -0,0 +1,58 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package constants
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultLabelPrefix is the prefix of the keys of the Lighthouse labels and annotations above. The agents and the DNS
+// servers may be configured with another prefix for those they generate and read back, which must be the same in all
+// of them.
+const DefaultLabelPrefix = "lighthouse.submariner.io/"
+
+// WithLabelPrefix returns the given Lighthouse label or annotation key under the given prefix instead of
+// DefaultLabelPrefix. The key is returned as is if the prefix is empty or it isn't under DefaultLabelPrefix.
+func WithLabelPrefix(prefix, key string) string {
+	if prefix == "" || !strings.HasPrefix(key, DefaultLabelPrefix) {
+		return key
+	}
+
+	return prefix + strings.TrimPrefix(key, DefaultLabelPrefix)
+}
+
+// ValidateLabelPrefix checks that the keys under the given label prefix, if set, are valid label and annotation keys.
+func ValidateLabelPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+
+	if !strings.HasSuffix(prefix, "/") {
+		return errors.Errorf("the label prefix %q must end with a \"/\"", prefix)
+	}
+
+	if errs := validation.IsQualifiedName(prefix + "sourceName"); len(errs) > 0 {
+		return errors.Errorf("%s is not a valid label prefix %v", prefix, errs)
+	}
+
+	return nil
+}